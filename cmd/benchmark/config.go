@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"group48.ttk4145.ntnu/elevators/internal/traffic"
+)
+
+// Benchmark describes the traffic and the configurations that are compared
+type Benchmark struct {
+	// Nodes is the number of elevators of the simulated cluster.
+	Nodes int `json:"nodes"`
+
+	// DurationS is the time in seconds during which passengers arrive.
+	DurationS float64 `json:"duration_s"`
+
+	// DrainS is the time in seconds after the last arrival after which the undelivered passengers are given up.
+	DrainS float64 `json:"drain_s"`
+
+	// PassengersPerMinute is the mean arrival rate of the passengers.
+	PassengersPerMinute float64 `json:"passengers_per_minute"`
+
+	// Seed seeds the generated traffic. All configurations are run with the same traffic.
+	Seed int64 `json:"seed"`
+
+	// Profile is the name of a predefined origin-destination matrix: "uniform", "up_peak" or "down_peak".
+	// It is ignored if a matrix is given.
+	Profile string `json:"profile"`
+
+	// Matrix is the origin-destination matrix, where each entry is the relative number of passengers
+	// travelling from the floor of the row to the floor of the column.
+	Matrix *traffic.Matrix `json:"od_matrix"`
+
+	// Configurations are the configurations of the nodes that are compared.
+	Configurations []Configuration `json:"configurations"`
+}
+
+// Configuration is a named set of config values that are set on all nodes, e.g. another assigner
+type Configuration struct {
+	Name     string                     `json:"name"`
+	Settings map[string]json.RawMessage `json:"settings"`
+}
+
+// LoadBenchmark loads the benchmark from a file
+func LoadBenchmark(filename string) (*Benchmark, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	b := &Benchmark{
+		Nodes:               3,
+		DurationS:           300,
+		DrainS:              120,
+		PassengersPerMinute: 4,
+		Seed:                1,
+		Profile:             "uniform",
+	}
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(b); err != nil {
+		return nil, err
+	}
+
+	if b.Nodes < 1 {
+		return nil, fmt.Errorf("nodes: at least one node is needed")
+	}
+	if len(b.Configurations) == 0 {
+		b.Configurations = []Configuration{{Name: "default"}}
+	}
+	if _, err := b.OdMatrix(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// OdMatrix returns the origin-destination matrix of the benchmark
+func (b *Benchmark) OdMatrix() (traffic.Matrix, error) {
+	if b.Matrix != nil {
+		if err := b.Matrix.Validate(); err != nil {
+			return traffic.Matrix{}, fmt.Errorf("od_matrix: %w", err)
+		}
+		return *b.Matrix, nil
+	}
+	m, ok := traffic.Profiles[b.Profile]
+	if !ok {
+		return traffic.Matrix{}, fmt.Errorf("profile: unknown profile %q", b.Profile)
+	}
+	return m, nil
+}
@@ -0,0 +1,202 @@
+// benchmark measures how well a simulated cluster of elevators serves generated passenger traffic.
+//
+// The passengers arrive as a Poisson process with trips drawn from an origin-destination matrix.
+// The same traffic is run against a fresh cluster for every configuration of the benchmark file,
+// e.g. with another assigner or another hysteresis, and the wait times, travel times
+// and floors traveled by the elevators are reported side by side.
+//
+// Usage:
+//
+//	go run ./cmd/benchmark benchmarks/uniform.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+	"group48.ttk4145.ntnu/elevators/internal/traffic"
+)
+
+// result is the report of one configuration
+type result struct {
+	Configuration string
+	Report        traffic.Report
+}
+
+// resultJson is a result as written to the JSON file, with the times in milliseconds
+type resultJson struct {
+	Configuration  string  `json:"configuration"`
+	Passengers     int     `json:"passengers"`
+	Delivered      int     `json:"delivered"`
+	AvgWaitMs      int64   `json:"avg_wait_ms"`
+	MaxWaitMs      int64   `json:"max_wait_ms"`
+	AvgTravelMs    int64   `json:"avg_travel_ms"`
+	MaxTravelMs    int64   `json:"max_travel_ms"`
+	FloorsTraveled float64 `json:"floors_traveled"`
+}
+
+func toResultJson(r result) resultJson {
+	return resultJson{
+		Configuration:  r.Configuration,
+		Passengers:     r.Report.Passengers,
+		Delivered:      r.Report.Delivered,
+		AvgWaitMs:      r.Report.AvgWait.Milliseconds(),
+		MaxWaitMs:      r.Report.MaxWait.Milliseconds(),
+		AvgTravelMs:    r.Report.AvgTravel.Milliseconds(),
+		MaxTravelMs:    r.Report.MaxTravel.Milliseconds(),
+		FloorsTraveled: r.Report.Traveled,
+	}
+}
+
+func main() {
+	binary := flag.String("bin", "", "Path of the elevator executable. Built from ./cmd/elevator if empty")
+	basePort := flag.Int("port", 20000, "Broadcast port of the nodes. The following ports are used by the simulators and the APIs")
+	warmup := flag.Duration("warmup", 3*time.Second, "Time the nodes get to start before the passengers arrive")
+	travelTime := flag.Duration("travel", 2*time.Second, "Time the simulated elevators need from one floor to the next")
+	jsonPath := flag.String("json", "", "Also write the reports as JSON to this file")
+	verbose := flag.Bool("v", false, "Print the progress")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %v [-bin path] [-port n] [-json path] [-v] benchmark.json\n", os.Args[0])
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	benchmark, err := LoadBenchmark(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid benchmark: %v\n", err)
+		os.Exit(2)
+	}
+	matrix, _ := benchmark.OdMatrix()
+	duration := time.Duration(benchmark.DurationS * float64(time.Second))
+	drain := time.Duration(benchmark.DrainS * float64(time.Second))
+	arrivals := traffic.Generate(rand.New(rand.NewSource(benchmark.Seed)), benchmark.PassengersPerMinute, matrix, duration)
+	fmt.Printf("%d passengers within %v on %d elevators, %d configuration(s)\n", len(arrivals), duration, benchmark.Nodes, len(benchmark.Configurations))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *binary == "" {
+		path, err := build()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to build the elevator: %v\n", err)
+			os.Exit(2)
+		}
+		defer os.RemoveAll(filepath.Dir(path))
+		*binary = path
+	}
+
+	elevatorConfig := simulator.DefaultConfig()
+	elevatorConfig.TravelTime = *travelTime
+
+	results := make([]result, 0, len(benchmark.Configurations))
+	for _, c := range benchmark.Configurations {
+		log.Printf("[benchmark] Running configuration %q", c.Name)
+		report, err := run(ctx, simulator.ClusterConfig{
+			Binary:   *binary,
+			BasePort: *basePort,
+			Nodes:    benchmark.Nodes,
+			Elevator: elevatorConfig,
+			Settings: c.Settings,
+		}, *warmup, benchmark.Seed, arrivals, drain)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration %q failed: %v\n", c.Name, err)
+			os.Exit(1)
+		}
+		results = append(results, result{Configuration: c.Name, Report: report})
+	}
+
+	printResults(os.Stdout, results)
+	if *jsonPath != "" {
+		res := make([]resultJson, 0, len(results))
+		for _, r := range results {
+			res = append(res, toResultJson(r))
+		}
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*jsonPath, b, 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %v: %v\n", *jsonPath, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// run runs the traffic against a fresh cluster with the given config
+//
+// The passengers choose the hall panels with their own random source, seeded like the traffic,
+// so that every configuration sees the same presses.
+func run(ctx context.Context, config simulator.ClusterConfig, warmup time.Duration, seed int64, arrivals []traffic.Arrival, drain time.Duration) (traffic.Report, error) {
+	dir, err := os.MkdirTemp("", "benchmark-")
+	if err != nil {
+		return traffic.Report{}, err
+	}
+	defer os.RemoveAll(dir)
+	config.Dir = dir
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cluster, err := simulator.StartCluster(ctx, config)
+	if err != nil {
+		return traffic.Report{}, err
+	}
+	defer cluster.Close()
+
+	select {
+	case <-time.After(warmup):
+	case <-ctx.Done():
+		return traffic.Report{}, ctx.Err()
+	}
+	return traffic.Run(ctx, cluster, rand.New(rand.NewSource(seed)), arrivals, drain)
+}
+
+// printResults prints the reports of all configurations as a table
+func printResults(w io.Writer, results []result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "configuration\tdelivered\twait avg\twait max\ttravel avg\ttravel max\tfloors traveled\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%v\t%d/%d\t%v\t%v\t%v\t%v\t%.1f\t\n",
+			r.Configuration,
+			r.Report.Delivered, r.Report.Passengers,
+			r.Report.AvgWait.Round(100*time.Millisecond),
+			r.Report.MaxWait.Round(100*time.Millisecond),
+			r.Report.AvgTravel.Round(100*time.Millisecond),
+			r.Report.MaxTravel.Round(100*time.Millisecond),
+			r.Report.Traveled)
+	}
+	tw.Flush()
+}
+
+// build builds the elevator executable into a temporary directory and returns its path
+func build() (string, error) {
+	dir, err := os.MkdirTemp("", "elevator-")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "elevator")
+	cmd := exec.Command("go", "build", "-o", path, "./cmd/elevator")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return path, nil
+}
@@ -1,33 +1,121 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"group48.ttk4145.ntnu/elevators/internal/api"
+	"group48.ttk4145.ntnu/elevators/internal/audit"
 	"group48.ttk4145.ntnu/elevators/internal/comms"
 	"group48.ttk4145.ntnu/elevators/internal/driver"
 	"group48.ttk4145.ntnu/elevators/internal/elevatorio"
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
+	doormonitor "group48.ttk4145.ntnu/elevators/internal/monitors/door"
 	enginemonitor "group48.ttk4145.ntnu/elevators/internal/monitors/engine"
+	floormonitor "group48.ttk4145.ntnu/elevators/internal/monitors/floor"
 	obstructionmonitor "group48.ttk4145.ntnu/elevators/internal/monitors/obstruction"
 	healthmonitor "group48.ttk4145.ntnu/elevators/internal/monitors/peers"
 	"group48.ttk4145.ntnu/elevators/internal/orders"
+	"group48.ttk4145.ntnu/elevators/internal/processpair"
 	"group48.ttk4145.ntnu/elevators/internal/requests"
 )
 
+// shutdownTimeout is the time main waits for the modules to exit after a shutdown signal.
+// The driver may need to travel to the next floor before it can stop.
+const shutdownTimeout = time.Second * 10
+
+// modules keeps track of the running modules, so that main can wait for them to exit on shutdown
+var modules sync.WaitGroup
+
 // channelBufferSize can be used to control the buffer size of the channels
 // Without buffer the channels will block until the message is received
 // This can lead to deadlocks when modules are waiting for each other
-const channelBufferSize = 10
+var channelBufferSize = 10
 
 func main() {
 	configPath := flag.String("config", "configs/config.json", "Path to config file")
+	isBackup := flag.Bool("backup", false, "Run as backup of a primary process and take over when it dies")
 	flag.Parse()
 
 	config := LoadConfig(*configPath)
+	localId := elevator.Id(config.LocalPeerId)
+	partitionPolicy, err := partition.ParsePolicy(config.PartitionPolicy)
+	if err != nil {
+		log.Fatalf("[main] Invalid config: %v", err)
+	}
+	confirmationPolicy, err := config.ConfirmationPolicy()
+	if err != nil {
+		log.Fatalf("[main] Invalid config: %v", err)
+	}
+
+	// The context is cancelled on SIGINT or SIGTERM, which makes all modules exit gracefully.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A backup process waits until the primary process dies and continues with its latest snapshot.
+	// Afterwards, it is the primary itself and spawns a new backup.
+	restored := processpair.Snapshot{}
+	if *isBackup {
+		var isTakingOver bool
+		restored, isTakingOver = processpair.RunBackup(ctx, config.ProcessPairPort)
+		if !isTakingOver {
+			return
+		}
+	}
+
+	// The audit log records every status change of a request and every request cleared by the driver.
+	// It is shared by the [requests] and [driver] module and disabled if no path is configured.
+	var auditLog *audit.Logger
+	if config.AuditLog != "" {
+		auditLog, err = audit.New(config.AuditLog, localId, config.AuditLogMaxBytes, config.AuditLogFiles)
+		if err != nil {
+			log.Fatalf("[main] Failed to open audit log: %v", err)
+		}
+	}
+
+	startModules(ctx, config, *configPath, partitionPolicy, confirmationPolicy, restored, auditLog)
+
+	// Block until a shutdown signal is received
+	<-ctx.Done()
+	log.Printf("[main] Shutting down")
+
+	exited := make(chan bool)
+	go func() {
+		modules.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+		log.Printf("[main] All modules exited")
+	case <-time.After(shutdownTimeout):
+		log.Printf("[main] Not all modules exited within %v", shutdownTimeout)
+	}
+	auditLog.Close()
+}
+
+// startModules connects the modules with channels and starts them, see startModule
+//
+// A backup that took over starts the modules with the restored snapshot of the crashed process.
+func startModules(
+	ctx context.Context,
+	config *Config,
+	configPath string,
+	partitionPolicy partition.Policy,
+	confirmationPolicy requests.ConfirmationPolicy,
+	restored processpair.Snapshot,
+	auditLog *audit.Logger) {
+
 	localId := elevator.Id(config.LocalPeerId)
 
 	// The channels are structured as follows:
@@ -40,21 +128,53 @@ func main() {
 	floorSensorToMotorMonitor := make(chan message.FloorArrival, channelBufferSize)
 	obstructionSwitchUpdateToDriver := make(chan message.Obstruction, channelBufferSize)
 	obstructionSwitchUpdateToMonitor := make(chan message.Obstruction, channelBufferSize)
+	obstructionSwitchUpdateToDoorMonitor := make(chan message.Obstruction, channelBufferSize)
+	floorSensorReadingToFloorMonitor := make(chan message.FloorSensorReading, channelBufferSize)
 
 	// These channels are responsible to transport all updates concerning requests.
 	// All modules that want to update the state of a request should send a message to requestStateUpdateToRequest.
 	// These are:
 	// 	- [elevatorio] When a button is pressed on the elevator it sends a unconfirmed request to the [request] module
+	// 	  A double press of a cab button cancels the cab call by sending it with absent status
+	// 	- [api] When a call is injected over HTTP it sends a unconfirmed request to the [request] module
+	// 	- [api] When a cab call is cancelled over HTTP it sends a request with absent status to the [request] module
 	// 	- [driver] When a request is resolved by the local elevator is sends a request with absent status to the [request] module
 	// 	- [comms] When the local peer receives a request from another peer it sends a request to the [request] module
-	// The [request] module then updates the state of the request and sends a notification to the [orders] and [comms] module.
+	// The [request] module then updates the state of the request and sends a notification to the [orders], [comms] and [api] module.
 	requestStateUpdateToRequest := make(chan message.RequestState, channelBufferSize)
 	requestStateNotifyToOrders := make(chan message.RequestState, channelBufferSize)
 	requestStateNotifyToComms := make(chan message.RequestState, channelBufferSize)
+	requestStateNotifyToProcessPair := make(chan message.RequestState, channelBufferSize)
+	requestStateNotifyToApi := make(chan message.RequestState, channelBufferSize)
+
+	// This channel is responsible for telling the [requests] module that the local peer has synced with the other peers.
+	// The [comms] module sends a message once a peer answered the join with a snapshot or the join timed out.
+	syncUpdateToRequests := make(chan message.Synced, channelBufferSize)
 
 	// This channel is responsible for sending newly calculated orders from the [orders] module to the [driver] module.
 	// Messages are only sent when the orders have changed.
 	orderUpdates := make(chan message.ServiceOrder, channelBufferSize)
+	orderUpdatesToProcessPair := make(chan message.ServiceOrder, channelBufferSize)
+
+	// This channel is responsible for sending the estimated arrivals of the hall calls from the [orders] module to the [comms] module.
+	// Messages are sent every time the orders are calculated, so that the peers always share the latest estimates.
+	estimateUpdates := make(chan message.HallCallEstimates, channelBufferSize)
+
+	// This channel is responsible for sending the estimates received from the peers from the [comms] module to the [orders] module.
+	// The [orders] module keeps a hall call with the elevator that claims it in its estimates, so that all peers keep the same hall calls.
+	peerEstimateUpdates := make(chan message.PeerEstimates, channelBufferSize)
+
+	// This channel is responsible for sending the explanation of the hall call assignments from the [orders] module to the [api] module.
+	// Messages are only sent when the explanation is enabled in the config.
+	decisionUpdates := make(chan message.AssignmentDecisions, channelBufferSize)
+
+	// This channel is responsible for sending the stale hall calls detected by the watchdog of the [orders] module to the [api] module.
+	// Messages are sent every time the orders are calculated.
+	staleUpdates := make(chan message.StaleCalls, channelBufferSize)
+
+	// This channel is responsible for sending the elevator states, alive peers and orders of all elevators from the [orders] module to the [api] module.
+	// Messages are sent every time the orders are calculated and streamed to the web dashboard.
+	clusterUpdates := make(chan message.ClusterState, channelBufferSize)
 
 	// These channels are responsible for sending updates concerning the state of the elevator.
 	// The [driver] module sends updates to the [orders] and [comms] module.
@@ -62,9 +182,21 @@ func main() {
 	elevatorStateUpdateToOrders := make(chan message.ElevatorState, channelBufferSize)
 	elevatorStateUpdateToComms := make(chan message.ElevatorState, channelBufferSize)
 	elevatorStateUpdateToEngineMonitor := make(chan message.ElevatorState, channelBufferSize)
+	elevatorStateUpdateToDoorMonitor := make(chan message.ElevatorState, channelBufferSize)
+	elevatorStateUpdateToFloorMonitor := make(chan message.ElevatorState, channelBufferSize)
+	elevatorStateUpdateToProcessPair := make(chan message.ElevatorState, channelBufferSize)
+
+	// This channel is responsible for telling the [driver] module to nudge the door closed.
+	// The [doormonitor] module sends a message when a passenger keeps the door from closing too often.
+	doorNudgeToDriver := make(chan message.DoorNudge, channelBufferSize)
+
+	// This channel is responsible for telling the [driver] module to halt the elevator.
+	// The [floormonitor] module sends a message when the floor sensor reports an impossible sequence of floors.
+	sensorFaultToDriver := make(chan message.FloorSensorFault, channelBufferSize)
 
 	// These channels are responsible for sending updates concerning the aliveness of the peers.
 	// The [comms] module send heartbeats to the [healthmonitor] module if it receives messages from another peer.
+	// The monitors and the [api] module (simulated faults) report the faults of the local elevator on the same channel.
 	// If the health of peer changes (i.e a peer has died or a new peer has joined),
 	// the [healthmonitor] module sends a notification to the [requests], [comms], and [orders] module.
 	alivePeersUpdate := make(chan message.PeerSignal, channelBufferSize)
@@ -72,36 +204,68 @@ func main() {
 	alivePeersNotifyToRequests := make(chan message.ActivePeers, channelBufferSize)
 	alivePeersNotifyToComms := make(chan message.ActivePeers, channelBufferSize)
 
+	// This channel is responsible for cutting the local peer off from the network for testing.
+	// The [api] module sends a message when a network fault is simulated or cleared.
+	networkFaultToComms := make(chan message.NetworkFault, channelBufferSize)
+
+	// These channels are responsible for injecting faults into the network and the elevator hardware for testing.
+	// The [api] module sends the faults to the [comms] and [elevatorio] module every time they are changed.
+	commsFaultsToComms := make(chan message.CommsFaults, channelBufferSize)
+	ioFaultsToElevatorio := make(chan message.IoFaults, channelBufferSize)
+
 	// The [elevatorio] module is responsible for communicating with the elevator hardware.
 	// It produces outputs:
 	//  - Updates to the [request] module (unconfirmed requests) when a button is pressed
 	//  - Updates to the [driver] module (floor sensor and obstruction switch) when the hardware is triggered
 	//  - Updates to the [enginemonitor] module (floor sensor) hwen the hardware is triggered
+	//  - Notifications to the [healthmonitor] module when the connection to the hardware is lost or restored
+	// The faults injected by the [api] module are applied to the readings and the motor.
 	elevatorio.Init(config.ElevatorAddr, localId)
-	go elevatorio.PollNewRequests(requestStateUpdateToRequest)
-	go elevatorio.PollFloorSensor(floorSensorToDriver)
-	go elevatorio.PollFloorSensor(floorSensorToMotorMonitor)
-	go elevatorio.PollObstructionSwitch(obstructionSwitchUpdateToDriver)
-	go elevatorio.PollObstructionSwitch(obstructionSwitchUpdateToMonitor)
+	go elevatorio.InjectFaults(ctx, ioFaultsToElevatorio)
+	go elevatorio.PollConnection(ctx, alivePeersUpdate)
+	go elevatorio.PollNewRequests(ctx, requestStateUpdateToRequest)
+	go elevatorio.PollFloorSensor(ctx, floorSensorToDriver)
+	go elevatorio.PollFloorSensor(ctx, floorSensorToMotorMonitor)
+	go elevatorio.PollObstructionSwitch(ctx, obstructionSwitchUpdateToDriver)
+	go elevatorio.PollObstructionSwitch(ctx, obstructionSwitchUpdateToMonitor)
+	go elevatorio.PollObstructionSwitch(ctx, obstructionSwitchUpdateToDoorMonitor)
+	go elevatorio.PollFloorSensorReadings(ctx, floorSensorReadingToFloorMonitor)
 
 	// The [driver] module is responsible for controlling the elevator hardware.
 	// It takes as input:
 	// 	- Updates from the elevator hardware (floor sensor, obstruction switch)
 	// 	- Updates from the [orders] module (new orders)
+	// 	- Updates from the [doormonitor] module (nudge the door closed)
+	// 	- Updates from the [floormonitor] module (halt the elevator)
 	// It produces outputs:
 	//  - Updates to the [request] module (resolved requests) when a request is resolved
 	//  - Updates to the [comms] and [order] module (elevator state) based on a polling rate
-	//  - Sends a heartbeat update to the [healthmonitor] module to indicate that the local peer is dead, due to failure
-	go driver.RunDriver(
-		obstructionSwitchUpdateToDriver,
-		floorSensorToDriver,
-		orderUpdates,
-		requestStateUpdateToRequest,
-		elevatorStateUpdateToComms,
-		elevatorStateUpdateToOrders,
-		elevatorStateUpdateToEngineMonitor,
-		localId,
-	)
+	//  - Sends a heartbeat update to the [healthmonitor] module to indicate that the local peer is dead, when no floor is found at startup
+	//  - Updates to the [processpair] module (elevator state) based on a polling rate
+	//  - Records in the audit log when a request is resolved
+	// A backup that took over starts with the state and order of the crashed process.
+	startModule(func() {
+		driver.RunDriver(
+			ctx,
+			obstructionSwitchUpdateToDriver,
+			floorSensorToDriver,
+			orderUpdates,
+			doorNudgeToDriver,
+			sensorFaultToDriver,
+			requestStateUpdateToRequest,
+			elevatorStateUpdateToComms,
+			elevatorStateUpdateToOrders,
+			elevatorStateUpdateToEngineMonitor,
+			elevatorStateUpdateToDoorMonitor,
+			elevatorStateUpdateToFloorMonitor,
+			elevatorStateUpdateToProcessPair,
+			alivePeersUpdate,
+			restored.State,
+			restored.Order,
+			auditLog,
+			localId,
+		)
+	})
 
 	// The [requests] module is responsible for managing the state of the requests.
 	// This includes the acknowledgment of other peers to ensure redundancy.
@@ -110,15 +274,29 @@ func main() {
 	// 	- Updates from the [driver] module (absent requests) which are triggered by the local elevator when a request is resolved
 	// 	- Updates from the [comms] module (requests from other peers)
 	//  - Updates from the [healthmonitor] module (peer aliveness) to determine acknowledgment status
+	//  - Updates from the [comms] module (sync status) as requests are only confirmed once the local peer is synced
+	// The confirmation policy defines how many alive peers must acknowledge a hall or cab request before it is confirmed.
+	// While the network is partitioned, the partition policy decides whether hall and destination requests are confirmed.
 	// It produces outputs:
-	//  - Notifications to the [orders] and [comms] module when the state of a request has changed
-	go requests.RunRequestServer(
-		localId,
-		requestStateUpdateToRequest,
-		alivePeersNotifyToRequests,
-		requestStateNotifyToComms,
-		requestStateNotifyToOrders,
-	)
+	//  - Notifications to the [orders], [comms] and [api] module when the state of a request has changed
+	//  - Records in the audit log when the state of a request has changed
+	startModule(func() {
+		requests.RunRequestServer(
+			ctx,
+			localId,
+			confirmationPolicy,
+			partitionPolicy,
+			restored.Requests,
+			auditLog,
+			requestStateUpdateToRequest,
+			alivePeersNotifyToRequests,
+			syncUpdateToRequests,
+			requestStateNotifyToComms,
+			requestStateNotifyToOrders,
+			requestStateNotifyToProcessPair,
+			requestStateNotifyToApi,
+		)
+	})
 
 	// The [orders] module is responsible for managing the orders and calculating the orders for the local elevator.
 	// An order includes all requests that should be handled by the local elevator.
@@ -126,28 +304,67 @@ func main() {
 	// 	- Updates from the [requests] module (request state updates)
 	// 	- Updates from the [driver] and [comms] module (local and external elevator state updates)
 	// 	- Updates from the [healthmonitor] module (peer aliveness) to exclude dead peers from the order calculations
+	// 	- Updates from the [comms] module (estimates of the peers) to keep hall calls with the elevator that claims them
+	// While the network is partitioned, the partition policy decides whether hall calls take part in the order calculations.
 	// It produces outputs:
 	//  - Updates to the [driver] module (new orders) when the orders have changed
-	go orders.RunOrderServer(
-		localId,
-		requestStateNotifyToOrders,
-		elevatorStateUpdateToOrders,
-		alivePeersNotifyToOrders,
-		orderUpdates,
-	)
+	//  - Updates to the [comms] module (estimated arrivals of the hall calls) when the orders are calculated
+	//  - Updates to the [api] module (explanation of the assignments) when the orders are calculated
+	//  - Updates to the [api] module (stale hall calls) when the orders are calculated
+	//  - Updates to the [api] module (elevator states, alive peers and orders of all elevators) when the orders are calculated
+	// A confirmed hall call that is not served within the stale threshold raises an alarm.
+	// The elevator assigned to it gives it up, and all peers move it to another elevator once they receive the estimates.
+	startModule(func() {
+		orders.RunOrderServer(
+			ctx,
+			localId,
+			config.Assigner,
+			time.Duration(config.AssignmentHysteresisMs)*time.Millisecond,
+			config.ExplainAssignments,
+			time.Duration(config.StaleCallTimeoutMs)*time.Millisecond,
+			partitionPolicy,
+			requestStateNotifyToOrders,
+			elevatorStateUpdateToOrders,
+			peerEstimateUpdates,
+			alivePeersNotifyToOrders,
+			orderUpdates,
+			orderUpdatesToProcessPair,
+			estimateUpdates,
+			decisionUpdates,
+			staleUpdates,
+			clusterUpdates,
+		)
+	})
 
 	// The [healthmonitor] module is responsible for monitoring the health of the peers.
 	// It takes as input:
 	// 	- Updates from the [comms] module (peer heartbeats) to store the last time a peer was seen
 	// It produces outputs:
 	//  - Notifications to the [requests] and [orders] module when the aliveness of a peer has changed (death or new peer)
-	go healthmonitor.RunMonitor(
-		localId,
-		alivePeersUpdate,
-		alivePeersNotifyToRequests,
-		alivePeersNotifyToOrders,
-		alivePeersNotifyToComms,
-	)
+	//  - Notifications to the [orders] module when a peer is suspected to have died, so that its hall calls are reassigned early
+	//  - Notifications to the [requests] and [orders] module whether the network is partitioned, given the size of the cluster
+	startModule(func() {
+		healthmonitor.RunMonitor(
+			ctx,
+			localId,
+			config.ClusterSize,
+			config.PhiSuspectThreshold,
+			config.PhiDeadThreshold,
+			alivePeersUpdate,
+			alivePeersNotifyToRequests,
+			alivePeersNotifyToOrders,
+			alivePeersNotifyToComms,
+		)
+	})
+
+	// An elevator in maintenance is taken out of service from the start.
+	// The peers are told the reason, so that they exclude it immediately.
+	if config.Maintenance {
+		select {
+		case alivePeersUpdate <- message.PeerSignal{Id: localId, Alive: false, Health: elevator.Maintenance}:
+		case <-ctx.Done():
+		}
+	}
 
 	// The [enginemonitor] module is responsible for monitoring the health of the engine
 	// It takes as input:
@@ -155,12 +372,15 @@ func main() {
 	//  - Updated from the [driver] module (state) to register that the elevator should be moving
 	// It produced ouputs:
 	// 	- Notification to the [healthmonitor] module when state of the engine changed (dead <-> alive)
-	go enginemonitor.RunEngineMonitor(
-		localId,
-		floorSensorToMotorMonitor,
-		elevatorStateUpdateToEngineMonitor,
-		alivePeersUpdate,
-	)
+	startModule(func() {
+		enginemonitor.RunEngineMonitor(
+			ctx,
+			localId,
+			floorSensorToMotorMonitor,
+			elevatorStateUpdateToEngineMonitor,
+			alivePeersUpdate,
+		)
+	})
 
 	// The [obstruct] module is responsible for monitoring the the status of the obstruction switch
 	// If obstructed for a long period of time we consider ourselv not functional
@@ -168,11 +388,52 @@ func main() {
 	//  - Updated from the [elevio] module (obstruction) to register obstruction
 	// It produced ouputs:
 	// 	- Notification to the [healthmonitor] module when state of perma interruption changes
-	go obstructionmonitor.RunObstructionMonitor(
-		localId,
-		obstructionSwitchUpdateToMonitor,
-		alivePeersUpdate,
-	)
+	startModule(func() {
+		obstructionmonitor.RunObstructionMonitor(
+			ctx,
+			localId,
+			obstructionSwitchUpdateToMonitor,
+			alivePeersUpdate,
+		)
+	})
+
+	// The [doormonitor] module is responsible for monitoring that the door actually closes
+	// It takes as input:
+	//  - Updated from the [elevio] module (obstruction) to count how often the door reopens
+	//  - Updated from the [driver] module (state) to register how long the door is open
+	// It produced ouputs:
+	// 	- Notification to the [driver] module when the door should be nudged closed
+	// 	- Notification to the [healthmonitor] module with a door fault when the door is stuck open
+	startModule(func() {
+		doormonitor.RunDoorMonitor(
+			ctx,
+			localId,
+			config.DoorNudgeReopenings,
+			time.Duration(config.DoorStuckTimeoutMs)*time.Millisecond,
+			obstructionSwitchUpdateToDoorMonitor,
+			elevatorStateUpdateToDoorMonitor,
+			doorNudgeToDriver,
+			alivePeersUpdate,
+		)
+	})
+
+	// The [floormonitor] module is responsible for checking that the readings of the floor sensor are plausible
+	// It takes as input:
+	//  - Updated from the [elevio] module (raw floor sensor readings) to check the sequence of floors
+	//  - Updated from the [driver] module (state) to register the direction of travel
+	// It produced ouputs:
+	// 	- Notification to the [driver] module when the elevator must be halted
+	// 	- Notification to the [healthmonitor] module with a sensor fault
+	startModule(func() {
+		floormonitor.RunFloorMonitor(
+			ctx,
+			localId,
+			floorSensorReadingToFloorMonitor,
+			elevatorStateUpdateToFloorMonitor,
+			sensorFaultToDriver,
+			alivePeersUpdate,
+		)
+	})
 
 	// The [comms] module is responsible for handling the communication between the peers.
 	// This includes sending the local elevator state and all information about about the requests of the local and external peers.
@@ -180,23 +441,88 @@ func main() {
 	// It takes as input:
 	// 	- Updates from the [driver] module (local elevator state) which are cached and propagated to the other peers
 	// 	- Updates from the [requests] module (request state updates) which are cached and propagated to the other peers
+	// 	- Updates from the [orders] module (estimated arrivals of the hall calls) which are propagated to the other peers
+	// 	- Updates from the [api] module (simulated network fault) which stop all broadcasts while active
+	// 	- Updates from the [api] module (injected network faults) which are applied to all received broadcasts
 	// It produces outputs:
 	//  - Notifications to the [orders] and [requests] module when an external peer has a different state of a request
 	//  - Notifications to the [orders] module about the elevator state of the external peers
+	//  - Notifications to the [orders] module about the estimates of the external peers
 	//  - Notifications to the [healthmonitor] module to update the aliveness of the peers
-	go comms.RunComms(
-		localId,
-		config.LocalPort,
-		elevatorStateUpdateToComms,
-		requestStateNotifyToComms,
-		alivePeersNotifyToComms,
-		elevatorStateUpdateToOrders,
-		requestStateUpdateToRequest,
-		alivePeersUpdate,
-	)
-
-	// Block forever
-	select {}
+	//  - Notifications to the [requests] module once the local peer has synced with the other peers after joining
+	startModule(func() {
+		comms.RunComms(
+			ctx,
+			localId,
+			config.LocalPort,
+			elevatorStateUpdateToComms,
+			requestStateNotifyToComms,
+			alivePeersNotifyToComms,
+			estimateUpdates,
+			networkFaultToComms,
+			commsFaultsToComms,
+			elevatorStateUpdateToOrders,
+			peerEstimateUpdates,
+			requestStateUpdateToRequest,
+			alivePeersUpdate,
+			syncUpdateToRequests,
+		)
+	})
+
+	// The [api] module is responsible for exposing the information of the local node over HTTP.
+	// It also serves a web dashboard that streams the information over a WebSocket.
+	// It takes as input:
+	// 	- Updates from the [orders] module (explanation of the assignments, stale hall calls, states, alive peers and orders)
+	// 	- Updates from the [requests] module (request state updates)
+	// It produces outputs:
+	//  - Updates to the [requests] module (unconfirmed requests) when a call is injected
+	//  - Updates to the [requests] module (absent cab requests) when a cab call is cancelled
+	//  - Updates to the [healthmonitor] module (faults of the local elevator) when a fault is simulated
+	//  - Updates to the [comms] module when a network fault is simulated
+	//  - Updates to the [comms] and [elevatorio] module when the injected faults are changed
+	startModule(func() {
+		api.RunApiServer(
+			ctx,
+			localId,
+			config.ApiAddr,
+			decisionUpdates,
+			staleUpdates,
+			clusterUpdates,
+			requestStateNotifyToApi,
+			requestStateUpdateToRequest,
+			alivePeersUpdate,
+			networkFaultToComms,
+			commsFaultsToComms,
+			ioFaultsToElevatorio,
+		)
+	})
+
+	// The [processpair] module is responsible for keeping a backup process ready to take over the local elevator.
+	// It takes as input:
+	// 	- Updates from the [driver] module (local elevator state)
+	// 	- Updates from the [orders] module (local orders)
+	// 	- Updates from the [requests] module (request state updates)
+	// It produces outputs:
+	//  - Snapshots of the local node to the backup process over a local socket
+	startModule(func() {
+		processpair.RunPrimary(
+			ctx,
+			config.ProcessPairPort,
+			[]string{"-config", configPath, "-backup"},
+			elevatorStateUpdateToProcessPair,
+			orderUpdatesToProcessPair,
+			requestStateNotifyToProcessPair,
+		)
+	})
+}
+
+// startModule runs the module as a goroutine and keeps track of it in modules
+func startModule(module func()) {
+	modules.Add(1)
+	go func() {
+		defer modules.Done()
+		module()
+	}()
 }
 
 type Config struct {
@@ -208,6 +534,91 @@ type Config struct {
 
 	// LocalPort is the port the local [comms] module listens to and sends broadcasts on.
 	LocalPort int `json:"local_port"`
+
+	// Assigner is the path of the executable the [orders] module calculates the orders with.
+	// The hall_request_assigner of the repo is used if empty.
+	Assigner string `json:"assigner"`
+
+	// AssignmentHysteresisMs is the time in milliseconds another elevator must arrive earlier
+	// at a hall call before the [orders] module moves the hall call to it.
+	AssignmentHysteresisMs int `json:"assignment_hysteresis_ms"`
+
+	// StaleCallTimeoutMs is the time in milliseconds after which a confirmed hall call that is not served raises an alarm
+	// and is moved away from its assigned elevator. The watchdog is disabled if zero.
+	StaleCallTimeoutMs int `json:"stale_call_timeout_ms"`
+
+	// AuditLog is the path of the JSONL file the status changes of the requests are written to. The audit log is disabled if empty.
+	AuditLog string `json:"audit_log"`
+
+	// AuditLogMaxBytes is the size in bytes at which the audit log is rotated.
+	AuditLogMaxBytes int64 `json:"audit_log_max_bytes"`
+
+	// AuditLogFiles is the number of rotated audit logs that are kept.
+	AuditLogFiles int `json:"audit_log_files"`
+
+	// ExplainAssignments enables the calculation of the cost of every candidate elevator for each hall call.
+	ExplainAssignments bool `json:"explain_assignments"`
+
+	// ApiAddr is the address the [api] module serves the HTTP API on. The API is disabled if empty.
+	ApiAddr string `json:"api_addr"`
+
+	// PhiSuspectThreshold is the suspicion level above which the [healthmonitor] module suspects a peer to have died.
+	PhiSuspectThreshold float64 `json:"phi_suspect_threshold"`
+
+	// PhiDeadThreshold is the suspicion level above which the [healthmonitor] module considers a peer dead.
+	PhiDeadThreshold float64 `json:"phi_dead_threshold"`
+
+	// DoorNudgeReopenings is the number of times the door may reopen due to an obstruction before it is nudged closed.
+	DoorNudgeReopenings int `json:"door_nudge_reopenings"`
+
+	// DoorStuckTimeoutMs is the time in milliseconds after which an open door is reported as a door fault.
+	DoorStuckTimeoutMs int `json:"door_stuck_timeout_ms"`
+
+	// Maintenance takes the local elevator out of service, e.g. while an operator works on it.
+	Maintenance bool `json:"maintenance"`
+
+	// ProcessPairPort is the local port the primary process streams its snapshots to the backup process on.
+	// The process pair is disabled if zero.
+	ProcessPairPort int `json:"process_pair_port"`
+
+	// ClusterSize is the number of elevators the cluster consists of. It is used to detect network partitions.
+	// If zero, the number of elevators seen since the start is used instead.
+	ClusterSize int `json:"cluster_size"`
+
+	// PartitionPolicy decides which calls are served while the network is partitioned.
+	// It is one of "serve_all" (default), "majority" or "cab_only".
+	PartitionPolicy string `json:"partition_policy"`
+
+	// HallConfirmation is the quorum needed to confirm hall and destination calls.
+	HallConfirmation QuorumConfig `json:"hall_confirmation"`
+
+	// CabConfirmation is the quorum needed to confirm cab calls.
+	CabConfirmation QuorumConfig `json:"cab_confirmation"`
+}
+
+// QuorumConfig defines how many alive peers must acknowledge a request before the [requests] module confirms it.
+type QuorumConfig struct {
+	// Rule is one of "all_alive", "majority" or "n_of_m".
+	Rule string `json:"rule"`
+
+	// N is the number of acknowledgements needed by the rule "n_of_m".
+	N int `json:"n"`
+
+	// AllowAlone lets the local elevator confirm requests without the acknowledgement of another peer.
+	AllowAlone bool `json:"allow_alone"`
+}
+
+// ConfirmationPolicy converts the quorums of the config to the confirmation policy of the [requests] module
+func (c *Config) ConfirmationPolicy() (requests.ConfirmationPolicy, error) {
+	hall, err := requests.ParseQuorum(c.HallConfirmation.Rule, c.HallConfirmation.N, c.HallConfirmation.AllowAlone)
+	if err != nil {
+		return requests.ConfirmationPolicy{}, fmt.Errorf("hall_confirmation: %w", err)
+	}
+	cab, err := requests.ParseQuorum(c.CabConfirmation.Rule, c.CabConfirmation.N, c.CabConfirmation.AllowAlone)
+	if err != nil {
+		return requests.ConfirmationPolicy{}, fmt.Errorf("cab_confirmation: %w", err)
+	}
+	return requests.ConfirmationPolicy{Hall: hall, Cab: cab}, nil
 }
 
 // LoadConfig loads the configuration from a file
@@ -219,7 +630,17 @@ func LoadConfig(filename string) *Config {
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
-	config := &Config{}
+	config := &Config{
+		PhiSuspectThreshold: healthmonitor.DefaultSuspectThreshold,
+		PhiDeadThreshold:    healthmonitor.DefaultDeadThreshold,
+		DoorNudgeReopenings: 3,
+		DoorStuckTimeoutMs:  20000,
+		StaleCallTimeoutMs:  60000,
+		AuditLogMaxBytes:    10 * 1024 * 1024,
+		AuditLogFiles:       5,
+		HallConfirmation:    QuorumConfig{Rule: "all_alive"},
+		CabConfirmation:     QuorumConfig{Rule: "all_alive", AllowAlone: true},
+	}
 	err = decoder.Decode(config)
 	if err != nil {
 		log.Fatalf("[main] Failed to decode config file: %v", err)
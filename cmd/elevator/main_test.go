@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
+	"group48.ttk4145.ntnu/elevators/internal/processpair"
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+// TestShutdown checks that all modules return once the context is done, even if they are busy sending to each other
+//
+// The elevator IO connects to the simulated elevator only once per process, so the test can not be repeated with -count.
+func TestShutdown(t *testing.T) {
+	// Without buffers, every send blocks until the receiver picks it up.
+	// A module that sends to a module that already returned blocks forever unless it stops when the context is done.
+	defer func(size int) { channelBufferSize = size }(channelBufferSize)
+	channelBufferSize = 0
+
+	// The simulated elevator outlives the node, as the driver stops at the next floor when shutting down
+	simCtx, stopSim := context.WithCancel(context.Background())
+	defer stopSim()
+	simConfig := simulator.DefaultConfig()
+	simConfig.TravelTime = 200 * time.Millisecond
+	sim := simulator.New(simConfig)
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go sim.Serve(simCtx, listener)
+
+	// The assigner assigns no orders, the modules still exchange the requests and states
+	dir := t.TempDir()
+	assigner := filepath.Join(dir, "assigner")
+	if err := os.WriteFile(assigner, []byte("#!/bin/sh\necho '{}'\n"), 0o755); err != nil {
+		t.Fatalf("failed to write the assigner: %v", err)
+	}
+	configPath := filepath.Join(dir, "config.json")
+	configJson := fmt.Sprintf(`{
+		"elevator_addr": %q,
+		"local_peer_id": 1,
+		"local_port": %d,
+		"assigner": %q,
+		"cluster_size": 1,
+		"hall_confirmation": {"rule": "all_alive", "allow_alone": true}
+	}`, listener.Addr().String(), freeUdpPort(t), assigner)
+	if err := os.WriteFile(configPath, []byte(configJson), 0o644); err != nil {
+		t.Fatalf("failed to write the config: %v", err)
+	}
+	config := LoadConfig(configPath)
+	partitionPolicy, err := partition.ParsePolicy(config.PartitionPolicy)
+	if err != nil {
+		t.Fatalf("invalid partition policy: %v", err)
+	}
+	confirmationPolicy, err := config.ConfirmationPolicy()
+	if err != nil {
+		t.Fatalf("invalid confirmation policy: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startModules(ctx, config, configPath, partitionPolicy, confirmationPolicy, processpair.Snapshot{}, nil)
+
+	sim.Press(elevator.HallUp, 2)
+	sim.Press(elevator.Cab, 3)
+	time.Sleep(2 * time.Second)
+	cancel()
+
+	exited := make(chan bool)
+	go func() {
+		modules.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected all modules to return after the context is done")
+	}
+}
+
+// freeUdpPort returns a UDP port that is currently not in use
+func freeUdpPort(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
@@ -0,0 +1,75 @@
+// elevtop shows the state of the whole cluster in the terminal.
+//
+// It listens passively to the broadcasts of the peers on the comms port and renders the shaft of every elevator,
+// the hall and cab requests as seen by each peer, the assignments of the hall calls and when each peer was last seen.
+// elevtop never transmits, so the peers do not know about it and it takes no part in the confirmation of requests.
+//
+// Usage:
+//
+//	go run ./cmd/elevtop -port 15444
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/comms"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// ANSI escape sequences used to draw the screen
+const (
+	clearScreen = "\033[H\033[2J"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+)
+
+func main() {
+	port := flag.Int("port", 15444, "Port the peers broadcast on (local_port in the config)")
+	refresh := flag.Duration("refresh", 250*time.Millisecond, "Interval between two redraws")
+	lostAfter := flag.Duration("lost", 2*time.Second, "Time without a broadcast after which a peer is shown as lost")
+	noColor := flag.Bool("nocolor", false, "Disable colors")
+	flag.Parse()
+
+	// The log output of the observer would scramble the screen
+	log.SetOutput(io.Discard)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	observations := make(chan message.PeerObservation, 10)
+	go comms.RunObserver(ctx, *port, observations)
+
+	peers := make(map[elevator.Id]message.PeerObservation)
+	redraw := time.NewTicker(*refresh)
+	defer redraw.Stop()
+
+	fmt.Print(hideCursor)
+	defer fmt.Print(showCursor)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case obs := <-observations:
+			if obs.Left {
+				delete(peers, obs.Source)
+				continue
+			}
+			peers[obs.Source] = obs
+
+		case now := <-redraw.C:
+			s := screen{port: *port, now: now, lostAfter: *lostAfter, color: !*noColor, peers: peers}
+			fmt.Print(clearScreen + s.render())
+		}
+	}
+}
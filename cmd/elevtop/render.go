@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// ANSI escape sequences used to color the screen
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorDim    = "\033[2m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// screen renders one frame from the latest observation of every peer
+type screen struct {
+	port      int
+	now       time.Time
+	lostAfter time.Duration
+	color     bool
+	peers     map[elevator.Id]message.PeerObservation
+}
+
+func (s screen) render() string {
+	var b strings.Builder
+	ids := s.sortedIds()
+
+	fmt.Fprintf(&b, "%v  port %v  %v  %v peers  (Ctrl-C to quit)\n\n",
+		s.paint(colorBold, "elevtop"), s.port, s.now.Format("15:04:05"), len(ids))
+	if len(ids) == 0 {
+		b.WriteString("Waiting for broadcasts...\n")
+		return b.String()
+	}
+
+	s.renderPeers(&b, ids)
+	s.renderShafts(&b, ids)
+	s.renderHallCalls(&b, ids)
+	s.renderCabCalls(&b, ids)
+	return b.String()
+}
+
+// renderPeers renders the health, state and last broadcast of every peer
+func (s screen) renderPeers(b *strings.Builder, ids []elevator.Id) {
+	fmt.Fprintf(b, "%v\n", s.paint(colorBold, "PEERS"))
+	fmt.Fprintf(b, "  %-4v %-16v %-10v %-6v %-14v %v\n", "id", "health", "last seen", "floor", "behavior", "direction")
+	for _, id := range ids {
+		p := s.peers[id]
+		age := s.now.Sub(p.Time)
+		seen := fmt.Sprintf("%.1fs", age.Seconds())
+		if age > s.lostAfter {
+			seen = s.paint(colorRed, fmt.Sprintf("%-10v", seen+" lost"))
+		} else {
+			seen = fmt.Sprintf("%-10v", seen)
+		}
+		health := fmt.Sprintf("%-16v", p.Health)
+		if p.Health != elevator.Operational {
+			health = s.paint(colorRed, health)
+		}
+		fmt.Fprintf(b, "  %-4v %v %v %-6v %-14v %v\n", id, health, seen, p.State.Floor, p.State.Behavior, p.State.Direction)
+	}
+	b.WriteString("\n")
+}
+
+// renderShafts renders a shaft diagram with the car of every elevator at its floor
+//
+// The car shows the direction while moving, an open door as ] [ and an unknown position as ?.
+func (s screen) renderShafts(b *strings.Builder, ids []elevator.Id) {
+	fmt.Fprintf(b, "%v\n", s.paint(colorBold, "SHAFTS"))
+	b.WriteString("      ")
+	for _, id := range ids {
+		fmt.Fprintf(b, " %-5v", id)
+	}
+	b.WriteString("\n")
+	for f := elevator.NumFloors - 1; f >= 0; f-- {
+		fmt.Fprintf(b, "  F%-3v", f)
+		for _, id := range ids {
+			state := s.peers[id].State
+			if state.Floor != f {
+				b.WriteString(" |   |")
+				continue
+			}
+			fmt.Fprintf(b, " |%v|", s.car(state))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
+
+func (s screen) car(state elevator.State) string {
+	switch {
+	case state.Behavior == elevator.Initializing:
+		return s.paint(colorYellow, " ? ")
+	case state.Behavior == elevator.DoorOpen:
+		return s.paint(colorGreen, "] [")
+	case state.Direction == elevator.Up:
+		return s.paint(colorBold, " ^ ")
+	case state.Direction == elevator.Down:
+		return s.paint(colorBold, " v ")
+	}
+	return "[=]"
+}
+
+// renderHallCalls renders the status of the hall calls in the registry of every peer,
+// together with the assigned elevator and the estimated arrival calculated by the peer
+func (s screen) renderHallCalls(b *strings.Builder, ids []elevator.Id) {
+	fmt.Fprintf(b, "%v  status per peer, > assigned elevator and estimated arrival\n", s.paint(colorBold, "HALL CALLS"))
+	b.WriteString("      ")
+	for _, id := range ids {
+		fmt.Fprintf(b, " %-28v", fmt.Sprintf("peer %v", id))
+	}
+	b.WriteString("\n")
+
+	for f := elevator.NumFloors - 1; f >= 0; f-- {
+		fmt.Fprintf(b, "  F%-3v", f)
+		for _, id := range ids {
+			p := s.peers[id]
+			up := s.hallCall(p, request.Hall{Floor: f, Direction: request.Up})
+			down := s.hallCall(p, request.Hall{Floor: f, Direction: request.Down})
+			fmt.Fprintf(b, " %v %v ", up, down)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
+
+// hallCall renders one hall call with a width of 13 characters
+func (s screen) hallCall(p message.PeerObservation, hall request.Hall) string {
+	arrow := "^"
+	if hall.Direction == request.Down {
+		arrow = "v"
+	}
+	status := statusOf(p, hall)
+	assignment := ""
+	for _, e := range p.Estimates {
+		if e.Floor == hall.Floor && e.Direction == hall.Direction {
+			assignment = fmt.Sprintf(">%v %.0fs", e.Elevator, e.Eta.Seconds())
+		}
+	}
+	return fmt.Sprintf("%v%v%-11v", arrow, s.status(status), assignment)
+}
+
+// renderCabCalls renders the cab calls of every elevator as reported by the elevator itself.
+// A * marks a cab call that another peer sees with a different status.
+func (s screen) renderCabCalls(b *strings.Builder, ids []elevator.Id) {
+	fmt.Fprintf(b, "%v  as reported by the elevator, * if another peer disagrees\n", s.paint(colorBold, "CAB CALLS"))
+	b.WriteString("      ")
+	for _, id := range ids {
+		fmt.Fprintf(b, " %-5v", id)
+	}
+	b.WriteString("\n")
+
+	for f := elevator.NumFloors - 1; f >= 0; f-- {
+		fmt.Fprintf(b, "  F%-3v", f)
+		for _, id := range ids {
+			cab := request.Cab{Id: id, Floor: f}
+			own := statusOf(s.peers[id], cab)
+			mark := " "
+			for _, other := range ids {
+				if statusOf(s.peers[other], cab) != own {
+					mark = "*"
+				}
+			}
+			fmt.Fprintf(b, " %v%v   ", s.status(own), mark)
+		}
+		b.WriteString("\n")
+	}
+}
+
+// status renders a request status as a single colored letter
+func (s screen) status(st request.Status) string {
+	switch st {
+	case request.Confirmed:
+		return s.paint(colorGreen, st.String())
+	case request.Unconfirmed:
+		return s.paint(colorYellow, st.String())
+	case request.Unknown:
+		return s.paint(colorDim, st.String())
+	}
+	return st.String()
+}
+
+func (s screen) paint(color, text string) string {
+	if !s.color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func (s screen) sortedIds() []elevator.Id {
+	ids := make([]elevator.Id, 0, len(s.peers))
+	for id := range s.peers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// statusOf returns the status of the request in the registry of the peer
+func statusOf(p message.PeerObservation, o request.Origin) request.Status {
+	for _, req := range p.Requests {
+		if req.Origin == o {
+			return req.Status
+		}
+	}
+	return request.Unknown
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"group48.ttk4145.ntnu/elevators/internal/requests"
+)
+
+// Config contains the settings of the node config that influence the decisions of the replayed modules.
+// The other settings of the config file are ignored.
+type Config struct {
+	// LocalPeerId is the id of the node that wrote the audit log.
+	LocalPeerId int `json:"local_peer_id"`
+
+	// PartitionPolicy decides which calls are served while the network is partitioned.
+	PartitionPolicy string `json:"partition_policy"`
+
+	// HallConfirmation is the quorum needed to confirm hall and destination calls.
+	HallConfirmation QuorumConfig `json:"hall_confirmation"`
+
+	// CabConfirmation is the quorum needed to confirm cab calls.
+	CabConfirmation QuorumConfig `json:"cab_confirmation"`
+}
+
+// QuorumConfig defines how many alive peers must acknowledge a request before the requests module confirms it.
+type QuorumConfig struct {
+	Rule       string `json:"rule"`
+	N          int    `json:"n"`
+	AllowAlone bool   `json:"allow_alone"`
+}
+
+// ConfirmationPolicy converts the quorums of the config to the confirmation policy of the requests module
+func (c *Config) ConfirmationPolicy() (requests.ConfirmationPolicy, error) {
+	hall, err := requests.ParseQuorum(c.HallConfirmation.Rule, c.HallConfirmation.N, c.HallConfirmation.AllowAlone)
+	if err != nil {
+		return requests.ConfirmationPolicy{}, fmt.Errorf("hall_confirmation: %w", err)
+	}
+	cab, err := requests.ParseQuorum(c.CabConfirmation.Rule, c.CabConfirmation.N, c.CabConfirmation.AllowAlone)
+	if err != nil {
+		return requests.ConfirmationPolicy{}, fmt.Errorf("cab_confirmation: %w", err)
+	}
+	return requests.ConfirmationPolicy{Hall: hall, Cab: cab}, nil
+}
+
+// LoadConfig loads the configuration from a file with the same defaults as the elevator
+func LoadConfig(filename string) *Config {
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Fatalf("[replay] Failed to open config file: %v", err)
+	}
+	defer file.Close()
+
+	config := &Config{
+		HallConfirmation: QuorumConfig{Rule: "all_alive"},
+		CabConfirmation:  QuorumConfig{Rule: "all_alive", AllowAlone: true},
+	}
+	if err := json.NewDecoder(file).Decode(config); err != nil {
+		log.Fatalf("[replay] Failed to decode config file: %v", err)
+	}
+	return config
+}
@@ -0,0 +1,351 @@
+// replay reproduces the decisions of one node offline from its audit log.
+//
+// The audit log records the inputs of the requests module (received requests, alive peers and the end of the join handshake)
+// and of the driver (orders, floor arrivals, closed doors and halts) together with their decisions (transitions and clears).
+// The inputs are fed into the requests module, the cache of the order server and the driver FSM in the recorded order,
+// and the reproduced decisions are compared step by step against the recorded ones.
+//
+// Usage:
+//
+//	go run ./cmd/replay -config configs/config.json audit.jsonl.2 audit.jsonl.1 audit.jsonl
+//
+// The rotated files must be given from the oldest to the newest. The replay exits with status 1 if a decision differs.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/audit"
+	"group48.ttk4145.ntnu/elevators/internal/driver"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+	"group48.ttk4145.ntnu/elevators/internal/orders"
+	"group48.ttk4145.ntnu/elevators/internal/requests"
+)
+
+// Module constants name the modules whose decisions are replayed
+const (
+	moduleRequests = "requests"
+	moduleDriver   = "driver"
+)
+
+// step is one recorded input of a module together with the decisions the module made in response
+type step struct {
+	module string
+	input  audit.Record
+	logged []audit.Record
+}
+
+func main() {
+	configPath := flag.String("config", "configs/config.json", "Path to the config file of the node that wrote the audit log")
+	verbose := flag.Bool("v", false, "Print every step, not only the mismatches")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %v [-config path] [-v] audit.jsonl...\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	config := LoadConfig(*configPath)
+	node := elevator.Id(config.LocalPeerId)
+	policy, err := partition.ParsePolicy(config.PartitionPolicy)
+	if err != nil {
+		log.Fatalf("[replay] Invalid config: %v", err)
+	}
+	confirmation, err := config.ConfirmationPolicy()
+	if err != nil {
+		log.Fatalf("[replay] Invalid config: %v", err)
+	}
+
+	records := make([]audit.Record, 0)
+	for _, path := range flag.Args() {
+		rs, err := readRecords(path)
+		if err != nil {
+			log.Fatalf("[replay] Failed to read %v: %v", path, err)
+		}
+		records = append(records, rs...)
+	}
+	steps := splitSteps(node, records)
+
+	// The modules log to stdout as well, which would drown the result of the replay
+	log.SetOutput(io.Discard)
+
+	var requestDecisions, driverDecisions bytes.Buffer
+	requestReplayer := requests.NewReplayer(node, confirmation, policy, audit.NewWriter(&requestDecisions, node))
+	driverReplayer := driver.NewReplayer(node, audit.NewWriter(&driverDecisions, node))
+	cacheReplayer := orders.NewCacheReplayer(node, policy)
+
+	mismatches, findings := 0, 0
+	for i, s := range steps {
+		var replayed []audit.Record
+		var notes []string
+
+		switch s.module {
+		case moduleRequests:
+			for _, req := range replayRequests(requestReplayer, s.input) {
+				cacheReplayer.AddRequest(req)
+			}
+			if s.input.Kind == audit.KindPeers {
+				cacheReplayer.ProcessActivePeers(toActivePeers(s.input))
+			}
+			replayed = decisions(&requestDecisions)
+		case moduleDriver:
+			if s.input.Kind == audit.KindOrder {
+				notes = cacheReplayer.CheckOrder(toServiceOrder(s.input))
+			}
+			replayDriver(driverReplayer, s.input)
+			replayed = decisions(&driverDecisions)
+		}
+
+		isMatch := equalDecisions(s.logged, replayed)
+		if !isMatch {
+			mismatches++
+		}
+		findings += len(notes)
+		if isMatch && len(notes) == 0 && !*verbose {
+			continue
+		}
+
+		fmt.Printf("step %v %v %v %v\n", i, s.input.Time.Format(time.RFC3339Nano), s.module, describe(s.input))
+		if !isMatch {
+			fmt.Printf("  MISMATCH\n")
+		}
+		for _, r := range s.logged {
+			fmt.Printf("  - logged   %v\n", describe(r))
+		}
+		for _, r := range replayed {
+			fmt.Printf("  + replayed %v\n", describe(r))
+		}
+		for _, n := range notes {
+			fmt.Printf("  ! order    %v\n", n)
+		}
+	}
+
+	fmt.Printf("Replayed %v steps of node %v: %v mismatches, %v order findings\n", len(steps), node, mismatches, findings)
+	if mismatches > 0 {
+		os.Exit(1)
+	}
+}
+
+// readRecords reads the records of a JSONL audit log
+func readRecords(path string) ([]audit.Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]audit.Record, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// splitSteps groups the decisions with the latest preceding input of the same module
+//
+// Decisions recorded before the first input of a module, e.g. of requests restored from a crashed process,
+// form a step without input, which the replay can not reproduce.
+func splitSteps(node elevator.Id, records []audit.Record) []step {
+	steps := make([]step, 0)
+	latest := map[string]int{moduleRequests: -1, moduleDriver: -1}
+
+	for _, r := range records {
+		if r.Node != int(node) {
+			log.Printf("[replay] Skipping record of node %v", r.Node)
+			continue
+		}
+		module := moduleOf(r.Kind)
+		if module == "" {
+			log.Printf("[replay] Skipping record of unknown kind %q", r.Kind)
+			continue
+		}
+		if !audit.IsDecision(r.Kind) {
+			steps = append(steps, step{module: module, input: r})
+			latest[module] = len(steps) - 1
+			continue
+		}
+		if latest[module] == -1 {
+			steps = append(steps, step{module: module, input: audit.Record{Time: r.Time, Kind: "start"}})
+			latest[module] = len(steps) - 1
+		}
+		steps[latest[module]].logged = append(steps[latest[module]].logged, r)
+	}
+	return steps
+}
+
+// moduleOf returns the module that wrote a record of the kind
+func moduleOf(kind string) string {
+	switch kind {
+	case audit.KindTransition, audit.KindInput, audit.KindPeers, audit.KindSynced:
+		return moduleRequests
+	case audit.KindClear, audit.KindOrder, audit.KindFloor, audit.KindInitialized, audit.KindDoorClosed, audit.KindHalt:
+		return moduleDriver
+	}
+	return ""
+}
+
+// replayRequests feeds an input into the requests module and returns the requests it sends to the other modules
+func replayRequests(r *requests.Replayer, input audit.Record) []request.Request {
+	switch input.Kind {
+	case audit.KindInput:
+		if input.Origin == nil {
+			fmt.Fprintf(os.Stderr, "[replay] Skipping input without origin\n")
+			return nil
+		}
+		origin, err := audit.FromOrigin(*input.Origin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[replay] Skipping input: %v\n", err)
+			return nil
+		}
+		msg := message.RequestState{
+			Source:  elevator.Id(input.Source),
+			Request: request.Request{Origin: origin, Status: audit.ParseStatus(input.NewStatus)},
+		}
+		return []request.Request{r.Process(input.Time, msg)}
+	case audit.KindPeers:
+		r.ProcessActivePeers(input.Time, toActivePeers(input))
+	case audit.KindSynced:
+		return r.SetSynced(input.Time)
+	}
+	return nil
+}
+
+// replayDriver feeds an input into the driver FSM
+func replayDriver(r *driver.Replayer, input audit.Record) {
+	switch input.Kind {
+	case audit.KindOrder:
+		r.Order(toServiceOrder(input))
+	case audit.KindFloor:
+		if input.Floor != nil {
+			r.Floor(elevator.Floor(*input.Floor))
+		}
+	case audit.KindInitialized:
+		if input.Floor != nil {
+			r.Initialized(elevator.Floor(*input.Floor))
+		}
+	case audit.KindDoorClosed:
+		r.DoorClosed()
+	case audit.KindHalt:
+		r.Halt()
+	}
+}
+
+func toActivePeers(r audit.Record) message.ActivePeers {
+	peers := make([]elevator.Id, 0, len(r.Peers))
+	for _, id := range r.Peers {
+		peers = append(peers, elevator.Id(id))
+	}
+	return message.ActivePeers{Peers: peers, Partitioned: r.Partitioned, InMajority: r.InMajority}
+}
+
+func toServiceOrder(r audit.Record) message.ServiceOrder {
+	var order elevator.Order
+	for f := 0; f < len(r.Order) && f < len(order); f++ {
+		order[f] = r.Order[f]
+	}
+	destinations := make([]request.Destination, 0, len(r.Destinations))
+	for _, o := range r.Destinations {
+		origin, err := audit.FromOrigin(o)
+		if d, ok := origin.(request.Destination); err == nil && ok {
+			destinations = append(destinations, d)
+		}
+	}
+	return message.ServiceOrder{Order: order, Destinations: destinations}
+}
+
+// decisions returns the decisions written to the buffer since the last call and empties the buffer
+func decisions(buf *bytes.Buffer) []audit.Record {
+	res := make([]audit.Record, 0)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		var r audit.Record
+		if line == "" || json.Unmarshal([]byte(line), &r) != nil {
+			continue
+		}
+		if audit.IsDecision(r.Kind) {
+			res = append(res, r)
+		}
+	}
+	buf.Reset()
+	return res
+}
+
+// equalDecisions compares the decisions, ignoring the time and the order they were made in.
+// The order within a step is not deterministic, e.g. for the requests confirmed at the end of the join handshake.
+func equalDecisions(logged, replayed []audit.Record) bool {
+	if len(logged) != len(replayed) {
+		return false
+	}
+	l, r := describeAll(logged), describeAll(replayed)
+	for i := range l {
+		if l[i] != r[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func describeAll(records []audit.Record) []string {
+	res := make([]string, 0, len(records))
+	for _, r := range records {
+		res = append(res, describe(r))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// describe returns a readable representation of a record without its time
+func describe(r audit.Record) string {
+	var b strings.Builder
+	b.WriteString(r.Kind)
+	if r.Origin != nil {
+		fmt.Fprintf(&b, " %v", describeOrigin(*r.Origin))
+	}
+	switch r.Kind {
+	case audit.KindTransition:
+		fmt.Fprintf(&b, " from %v: %v -> %v ledger %v", r.Source, r.OldStatus, r.NewStatus, r.Ledger)
+	case audit.KindInput:
+		fmt.Fprintf(&b, " from %v: %v", r.Source, r.NewStatus)
+	case audit.KindPeers:
+		fmt.Fprintf(&b, " %v partitioned %v in majority %v", r.Peers, r.Partitioned, r.InMajority)
+	case audit.KindFloor, audit.KindInitialized:
+		if r.Floor != nil {
+			fmt.Fprintf(&b, " %v", *r.Floor)
+		}
+	case audit.KindOrder:
+		fmt.Fprintf(&b, " %v destinations %v", r.Order, len(r.Destinations))
+	}
+	return b.String()
+}
+
+func describeOrigin(o audit.Origin) string {
+	switch {
+	case o.Cab != nil:
+		return fmt.Sprintf("%v %v of elevator %v", o.Type, o.Floor, *o.Cab)
+	case o.To != nil:
+		return fmt.Sprintf("%v %v to %v", o.Type, o.Floor, *o.To)
+	default:
+		return fmt.Sprintf("%v %v %v", o.Type, o.Floor, o.Direction)
+	}
+}
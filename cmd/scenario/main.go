@@ -0,0 +1,148 @@
+// scenario runs end-to-end acceptance tests of a cluster of elevators.
+//
+// Every scenario file describes a timeline of events for a multi-node simulation and the expectations that must hold
+// (see the scenario package for the format). For every elevator, a simulated elevator and a node process are started,
+// the timeline is played and the expectations are checked against the recorded simulation.
+//
+// Usage:
+//
+//	go run ./cmd/scenario scenarios/*.scn
+//
+// The configs and logs of the nodes are written to a temporary directory per scenario, which is kept if a scenario fails.
+// The command exits with status 1 if an expectation of any scenario failed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/scenario"
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+func main() {
+	binary := flag.String("bin", "", "Path of the elevator executable. Built from ./cmd/elevator if empty")
+	basePort := flag.Int("port", 20000, "Broadcast port of the nodes. The following ports are used by the simulators and the APIs")
+	warmup := flag.Duration("warmup", 3*time.Second, "Time the nodes get to start before the timeline starts")
+	travelTime := flag.Duration("travel", 2*time.Second, "Time the simulated elevators need from one floor to the next")
+	keep := flag.Bool("keep", false, "Keep the configs and logs of the nodes of passed scenarios as well")
+	verbose := flag.Bool("v", false, "Print the events while they are played")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %v [-bin path] [-port n] [-keep] [-v] scenario...\n", os.Args[0])
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *binary == "" {
+		path, err := build()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to build the elevator: %v\n", err)
+			os.Exit(2)
+		}
+		defer os.RemoveAll(filepath.Dir(path))
+		*binary = path
+	}
+
+	simConfig := simulator.DefaultConfig()
+	simConfig.TravelTime = *travelTime
+
+	isFailed := false
+	for _, path := range flag.Args() {
+		passed, err := run(ctx, path, scenario.Runner{
+			Binary:    *binary,
+			BasePort:  *basePort,
+			Warmup:    *warmup,
+			Simulator: simConfig,
+		}, *keep)
+		if err != nil {
+			fmt.Printf("ERROR %v: %v\n", path, err)
+		}
+		isFailed = isFailed || !passed || err != nil
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if isFailed {
+		os.Exit(1)
+	}
+}
+
+// run runs one scenario file, prints its results and returns true if all expectations passed
+func run(ctx context.Context, path string, runner scenario.Runner, keep bool) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	s, err := scenario.Parse(file)
+	file.Close()
+	if err != nil {
+		return false, err
+	}
+	if s.Name == "" {
+		s.Name = filepath.Base(path)
+	}
+
+	dir, err := os.MkdirTemp("", "scenario-")
+	if err != nil {
+		return false, err
+	}
+	runner.Dir = dir
+
+	fmt.Printf("=== %v (%d nodes, %v)\n", s.Name, s.Nodes, s.End())
+	results, err := runner.Run(ctx, s)
+	if err != nil {
+		fmt.Printf("    logs in %v\n", dir)
+		return false, err
+	}
+
+	passed := true
+	for _, r := range results {
+		verdict := "PASS"
+		if !r.Passed {
+			verdict = "FAIL"
+			passed = false
+		}
+		fmt.Printf("    %v  t=%v %v: %v\n", verdict, r.Expectation.At, r.Expectation.Text, r.Detail)
+	}
+
+	if passed && !keep {
+		os.RemoveAll(dir)
+	} else {
+		fmt.Printf("    logs in %v\n", dir)
+	}
+	return passed, nil
+}
+
+// build builds the elevator executable into a temporary directory and returns its path
+func build() (string, error) {
+	dir, err := os.MkdirTemp("", "elevator-")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "elevator")
+	cmd := exec.Command("go", "build", "-o", path, "./cmd/elevator")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return path, nil
+}
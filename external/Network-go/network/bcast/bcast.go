@@ -2,17 +2,25 @@ package bcast
 
 import (
 	"Network-go/network/conn"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"reflect"
 )
 
-const bufSize = 1024
+// Local change: upstream uses 1024, which is too small for the broadcasts of the comms module. See FORK.md
+const bufSize = 4096
 
 // Encodes received values from `chans` into type-tagged JSON, then broadcasts
 // it on `port`
 func Transmitter(port int, chans ...interface{}) {
+	TransmitterContext(context.Background(), port, chans...)
+}
+
+// Like Transmitter, but returns and closes the connection when `ctx` is done
+// Local change: not part of upstream. See FORK.md
+func TransmitterContext(ctx context.Context, port int, chans ...interface{}) {
 	checkArgs(chans...)
 	typeNames := make([]string, len(chans))
 	selectCases := make([]reflect.SelectCase, len(typeNames))
@@ -24,10 +32,20 @@ func Transmitter(port int, chans ...interface{}) {
 		typeNames[i] = reflect.TypeOf(ch).Elem().String()
 	}
 
+	// The last select case is the cancellation of the context
+	selectCases = append(selectCases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(ctx.Done()),
+	})
+
 	conn := conn.DialBroadcastUDP(port)
+	defer conn.Close()
 	addr, _ := net.ResolveUDPAddr("udp4", fmt.Sprintf("255.255.255.255:%d", port))
 	for {
 		chosen, value, _ := reflect.Select(selectCases)
+		if chosen == len(chans) {
+			return
+		}
 		jsonstr, _ := json.Marshal(value.Interface())
 		ttj, _ := json.Marshal(typeTaggedJSON{
 			TypeId: typeNames[chosen],
@@ -47,6 +65,12 @@ func Transmitter(port int, chans ...interface{}) {
 // Matches type-tagged JSON received on `port` to element types of `chans`, then
 // sends the decoded value on the corresponding channel
 func Receiver(port int, chans ...interface{}) {
+	ReceiverContext(context.Background(), port, chans...)
+}
+
+// Like Receiver, but returns and closes the connection when `ctx` is done
+// Local change: not part of upstream. See FORK.md
+func ReceiverContext(ctx context.Context, port int, chans ...interface{}) {
 	checkArgs(chans...)
 	chansMap := make(map[string]interface{})
 	for _, ch := range chans {
@@ -55,8 +79,16 @@ func Receiver(port int, chans ...interface{}) {
 
 	var buf [bufSize]byte
 	conn := conn.DialBroadcastUDP(port)
+	go func() {
+		// Closing the connection unblocks the pending read
+		<-ctx.Done()
+		conn.Close()
+	}()
 	for {
 		n, _, e := conn.ReadFrom(buf[0:])
+		if ctx.Err() != nil {
+			return
+		}
 		if e != nil {
 			fmt.Printf("bcast.Receiver(%d, ...):ReadFrom() failed: \"%+v\"\n", port, e)
 		}
@@ -73,6 +105,9 @@ func Receiver(port int, chans ...interface{}) {
 			Dir:  reflect.SelectSend,
 			Chan: reflect.ValueOf(ch),
 			Send: reflect.Indirect(v),
+		}, {
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(ctx.Done()),
 		}})
 	}
 }
@@ -0,0 +1,517 @@
+// api is a module that exposes the information of the local node over HTTP as JSON.
+//
+// It also serves a web dashboard, which streams the elevator states, request statuses, alive peers and orders over a WebSocket.
+// Apart from injecting and cancelling calls, simulating faults and injecting faults into the network and the hardware,
+// the module only observes the system
+// and does not take part in the request or order handling.
+package api
+
+import (
+	_ "embed"
+
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// publishInterval is the minimum time between two updates streamed to the dashboards.
+// Changes within the interval are combined into a single update.
+const publishInterval = time.Millisecond * 100
+
+// dashboardHtml is the web dashboard served on the root path
+//
+//go:embed web/index.html
+var dashboardHtml []byte
+
+// simulatedFaults maps the names used by the API to the faults that can be simulated on the local elevator
+var simulatedFaults = map[string]elevator.Health{
+	"maintenance": elevator.Maintenance,
+	"engine":      elevator.EngineFault,
+	"sensor":      elevator.SensorFault,
+	"door":        elevator.DoorFault,
+	"obstructed":  elevator.Obstructed,
+}
+
+// networkFault is the name used by the API for cutting the local peer off from the network
+const networkFault = "network"
+
+// RunApiServer should be run as a goroutine and serves the latest information of the local node.
+//
+// It listens for updates from the other modules and stores the latest version of them.
+// If addr is empty, the HTTP server is not started, but the updates are still consumed
+// so that the sending modules never block.
+// The HTTP server is shut down when the context is done.
+// Cab calls of the local elevator are cancelled by sending them as absent to the [requests] module,
+// which cancels an unconfirmed cab call once it is confirmed.
+// Calls injected over HTTP are sent as unconfirmed to the [requests] module, like a button press.
+// This includes destination calls, which are entered on a keypad at the pickup floor instead of a button.
+// The elevator to board for a destination call is served with the requests once the orders are calculated.
+// Simulated faults are reported to the [healthmonitor] module like a fault detected by the monitors,
+// which takes the local elevator out of service until the fault is cleared again.
+// A simulated network fault is sent to the [comms] module instead, which stops sending and receiving broadcasts.
+// Injected faults of the network are sent to the [comms] module and those of the hardware to the [elevatorio] module.
+// Changes of the requests and of the cluster are streamed to the connected dashboards at most every publish interval.
+func RunApiServer(
+	ctx context.Context,
+	local elevator.Id,
+	addr string,
+	fromOrders <-chan message.AssignmentDecisions,
+	staleFromOrders <-chan message.StaleCalls,
+	clusterFromOrders <-chan message.ClusterState,
+	fromRequests <-chan message.RequestState,
+	toRequests chan<- message.RequestState,
+	toHealthMonitor chan<- message.PeerSignal,
+	toComms chan<- message.NetworkFault,
+	chaosToComms chan<- message.CommsFaults,
+	chaosToElevatorio chan<- message.IoFaults) {
+
+	status := newNodeStatus()
+
+	if addr == "" {
+		log.Printf("[api] No address configured, the API is disabled")
+	} else {
+		go serve(ctx, addr, local, status, toRequests, toHealthMonitor, toComms, chaosToComms, chaosToElevatorio)
+	}
+
+	publish := time.NewTicker(publishInterval)
+	defer publish.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[api] Shutting down")
+			return
+
+		case msg := <-fromOrders:
+			status.setDecisions(msg.Decisions)
+
+		case msg := <-staleFromOrders:
+			status.setStaleCalls(msg)
+
+		case msg := <-clusterFromOrders:
+			status.setCluster(msg)
+
+		case msg := <-fromRequests:
+			status.setRequest(msg.Request)
+
+		case <-publish.C:
+			status.publish(local)
+		}
+	}
+}
+
+// nodeStatus stores the latest information of the local node
+//
+// It is shared between the module routine, which writes the information,
+// and the HTTP handlers, which read it. Thus, the access is guarded by a mutex.
+type nodeStatus struct {
+	mtx       sync.Mutex
+	decisions []message.AssignmentDecision
+	stale     message.StaleCalls
+	cluster   message.ClusterState
+	requests  map[request.Origin]request.Status
+	// faults contains the simulated faults of the local elevator
+	faults map[elevator.Health]bool
+	// isIsolated is true if the local peer is cut off from the network by a simulated network fault
+	isIsolated bool
+	// commsFaults and ioFaults are the faults injected into the network and the hardware
+	commsFaults message.CommsFaults
+	ioFaults    message.IoFaults
+
+	// subscribers are the channels of the connected dashboards.
+	// Each holds at most the latest update, so that a slow dashboard skips updates instead of blocking the module.
+	subscribers map[chan []byte]bool
+	// isChanged is true if the dashboard changed since it was last published
+	isChanged bool
+}
+
+func newNodeStatus() *nodeStatus {
+	return &nodeStatus{
+		decisions:   make([]message.AssignmentDecision, 0),
+		requests:    make(map[request.Origin]request.Status),
+		faults:      make(map[elevator.Health]bool),
+		subscribers: make(map[chan []byte]bool),
+	}
+}
+
+func (s *nodeStatus) setDecisions(d []message.AssignmentDecision) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.decisions = d
+}
+
+func (s *nodeStatus) getDecisions() []message.AssignmentDecision {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.decisions
+}
+
+func (s *nodeStatus) setStaleCalls(stale message.StaleCalls) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.stale = stale
+}
+
+func (s *nodeStatus) getStaleCalls() message.StaleCalls {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.stale
+}
+
+func (s *nodeStatus) setCluster(c message.ClusterState) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.cluster = c
+	s.isChanged = true
+}
+
+func (s *nodeStatus) setRequest(req request.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.requests[req.Origin] = req.Status
+	s.isChanged = true
+}
+
+func (s *nodeStatus) setFault(h elevator.Health, isActive bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if isActive {
+		s.faults[h] = true
+	} else {
+		delete(s.faults, h)
+	}
+	s.isChanged = true
+}
+
+func (s *nodeStatus) setIsolated(isIsolated bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.isIsolated = isIsolated
+	s.isChanged = true
+}
+
+func (s *nodeStatus) setChaos(comms message.CommsFaults, io message.IoFaults) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.commsFaults = comms
+	s.ioFaults = io
+}
+
+func (s *nodeStatus) getChaos() chaosJson {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return toChaosJson(s.commsFaults, s.ioFaults)
+}
+
+// dashboard returns the dashboard of the local node as JSON
+func (s *nodeStatus) dashboard(local elevator.Id) []byte {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.dashboardLocked(local)
+}
+
+func (s *nodeStatus) dashboardLocked(local elevator.Id) []byte {
+	b, err := json.Marshal(toDashboardJson(local, s.cluster, s.requests, s.faults, s.isIsolated))
+	if err != nil {
+		log.Printf("[api] Failed to encode dashboard: %v", err)
+	}
+	return b
+}
+
+// subscribe registers a dashboard that receives every published update
+func (s *nodeStatus) subscribe() chan []byte {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	c := make(chan []byte, 1)
+	s.subscribers[c] = true
+	return c
+}
+
+func (s *nodeStatus) unsubscribe(c chan []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.subscribers, c)
+}
+
+// publish sends the dashboard to all subscribers if it changed since the last publish
+func (s *nodeStatus) publish(local elevator.Id) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.isChanged || len(s.subscribers) == 0 {
+		return
+	}
+	s.isChanged = false
+
+	b := s.dashboardLocked(local)
+	for c := range s.subscribers {
+		// Replace an update the dashboard has not picked up yet
+		select {
+		case <-c:
+		default:
+		}
+		c <- b
+	}
+}
+
+// serve starts the HTTP server with all endpoints of the API and the dashboard
+func serve(
+	ctx context.Context,
+	addr string,
+	local elevator.Id,
+	status *nodeStatus,
+	toRequests chan<- message.RequestState,
+	toHealthMonitor chan<- message.PeerSignal,
+	toComms chan<- message.NetworkFault,
+	chaosToComms chan<- message.CommsFaults,
+	chaosToElevatorio chan<- message.IoFaults) {
+
+	// sendRequest passes a request to the [requests] module unless the client gives up first
+	sendRequest := func(w http.ResponseWriter, r *http.Request, req request.Request) {
+		select {
+		case toRequests <- message.RequestState{Source: local, Request: req}:
+			log.Printf("[api] Sent %v to the requests module", req)
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+		}
+	}
+
+	// injectChaos passes the injected faults to the [comms] and [elevatorio] modules unless the client gives up first
+	injectChaos := func(w http.ResponseWriter, r *http.Request, comms message.CommsFaults, io message.IoFaults) {
+		select {
+		case chaosToComms <- comms:
+		case <-r.Context().Done():
+			return
+		}
+		select {
+		case chaosToElevatorio <- io:
+		case <-r.Context().Done():
+			return
+		}
+		status.setChaos(comms, io)
+		log.Printf("[api] Injected faults: %+v", toChaosJson(comms, io))
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	// updateChaos decodes the injected faults from the body onto c and injects them
+	updateChaos := func(w http.ResponseWriter, r *http.Request, c chaosJson) {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&c); err != nil {
+			http.Error(w, "invalid faults: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		comms, io, err := fromChaosJson(c)
+		if err != nil {
+			http.Error(w, "invalid faults: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		injectChaos(w, r, comms, io)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardHtml)
+	})
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(status.dashboard(local))
+	})
+	mux.HandleFunc("GET /api/ws", func(w http.ResponseWriter, r *http.Request) {
+		streamDashboard(ctx, w, r, local, status)
+	})
+	mux.HandleFunc("GET /api/decisions", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, toDecisionsJson(status.getDecisions()))
+	})
+	mux.HandleFunc("GET /api/stale", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, toStaleJson(status.getStaleCalls()))
+	})
+	mux.HandleFunc("DELETE /api/cab/{floor}", func(w http.ResponseWriter, r *http.Request) {
+		floor, err := strconv.Atoi(r.PathValue("floor"))
+		if err != nil || floor < 0 || floor >= int(elevator.NumFloors) {
+			http.Error(w, "invalid floor", http.StatusBadRequest)
+			return
+		}
+
+		sendRequest(w, r, request.NewCabRequest(elevator.Floor(floor), local, request.Absent))
+	})
+	mux.HandleFunc("POST /api/cab/{floor}", func(w http.ResponseWriter, r *http.Request) {
+		floor, err := strconv.Atoi(r.PathValue("floor"))
+		if err != nil || floor < 0 || floor >= int(elevator.NumFloors) {
+			http.Error(w, "invalid floor", http.StatusBadRequest)
+			return
+		}
+		sendRequest(w, r, request.NewCabRequest(elevator.Floor(floor), local, request.Unconfirmed))
+	})
+	mux.HandleFunc("POST /api/hall/{floor}/{direction}", func(w http.ResponseWriter, r *http.Request) {
+		floor, err := strconv.Atoi(r.PathValue("floor"))
+		if err != nil || floor < 0 || floor >= int(elevator.NumFloors) {
+			http.Error(w, "invalid floor", http.StatusBadRequest)
+			return
+		}
+		var direction request.Direction
+		switch r.PathValue("direction") {
+		case "up":
+			direction = request.Up
+		case "down":
+			direction = request.Down
+		default:
+			http.Error(w, "invalid direction", http.StatusBadRequest)
+			return
+		}
+		sendRequest(w, r, request.NewHallRequest(elevator.Floor(floor), direction, request.Unconfirmed))
+	})
+	mux.HandleFunc("POST /api/destination/{from}/{to}", func(w http.ResponseWriter, r *http.Request) {
+		from, fromErr := strconv.Atoi(r.PathValue("from"))
+		to, toErr := strconv.Atoi(r.PathValue("to"))
+		if fromErr != nil || toErr != nil {
+			http.Error(w, "invalid floor", http.StatusBadRequest)
+			return
+		}
+		req := request.NewDestinationRequest(elevator.Floor(from), elevator.Floor(to), request.Unconfirmed)
+		if d := req.Origin.(request.Destination); !d.IsValid() {
+			http.Error(w, "invalid destination", http.StatusBadRequest)
+			return
+		}
+		sendRequest(w, r, req)
+	})
+	mux.HandleFunc("GET /api/chaos", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, status.getChaos())
+	})
+	mux.HandleFunc("PUT /api/chaos", func(w http.ResponseWriter, r *http.Request) {
+		updateChaos(w, r, chaosJson{})
+	})
+	mux.HandleFunc("PATCH /api/chaos", func(w http.ResponseWriter, r *http.Request) {
+		// The fields missing in the body keep their current value
+		updateChaos(w, r, status.getChaos())
+	})
+	mux.HandleFunc("DELETE /api/chaos", func(w http.ResponseWriter, r *http.Request) {
+		injectChaos(w, r, message.CommsFaults{}, message.IoFaults{})
+	})
+	mux.HandleFunc("/api/fault/"+networkFault, func(w http.ResponseWriter, r *http.Request) {
+		isActive, ok := faultMethod(w, r)
+		if !ok {
+			return
+		}
+
+		select {
+		case toComms <- message.NetworkFault{Isolated: isActive}:
+			status.setIsolated(isActive)
+			log.Printf("[api] Simulated network fault: %v", isActive)
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/api/fault/{fault}", func(w http.ResponseWriter, r *http.Request) {
+		health, ok := simulatedFaults[r.PathValue("fault")]
+		if !ok {
+			http.Error(w, "unknown fault", http.StatusNotFound)
+			return
+		}
+		isActive, ok := faultMethod(w, r)
+		if !ok {
+			return
+		}
+
+		select {
+		case toHealthMonitor <- message.PeerSignal{Id: local, Alive: !isActive, Health: health}:
+			status.setFault(health, isActive)
+			log.Printf("[api] Simulated fault %v: %v", health, isActive)
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+		}
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	log.Printf("[api] Serving API on %v", addr)
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("[api] The API server stopped: %v", err)
+	}
+}
+
+// faultMethod returns true if the request sets a fault (POST) and false if it clears it (DELETE)
+//
+// Any other method is answered with an error, and ok is false.
+func faultMethod(w http.ResponseWriter, r *http.Request) (isActive bool, ok bool) {
+	switch r.Method {
+	case http.MethodPost:
+		return true, true
+	case http.MethodDelete:
+		return false, true
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false, false
+	}
+}
+
+// streamDashboard sends the dashboard over a WebSocket, first in full and then on every published change
+func streamDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request, local elevator.Id, status *nodeStatus) {
+	if !isWebsocketHandshake(r) {
+		http.Error(w, "expected a websocket handshake", http.StatusBadRequest)
+		return
+	}
+	conn, err := upgradeWebsocket(w, r)
+	if err != nil {
+		log.Printf("[api] Failed to open websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	updates := status.subscribe()
+	defer status.unsubscribe(updates)
+	log.Printf("[api] Dashboard connected from %v", r.RemoteAddr)
+
+	// The client only sends control frames, which are handled by a separate routine
+	closed := make(chan bool)
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := conn.ReadFrame()
+			if err != nil || opcode == opClose {
+				return
+			}
+			if opcode == opPing {
+				conn.WritePong(payload)
+			}
+		}
+	}()
+
+	if err := conn.WriteText(status.dashboard(local)); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			log.Printf("[api] Dashboard disconnected from %v", r.RemoteAddr)
+			return
+		case b := <-updates:
+			if err := conn.WriteText(b); err != nil {
+				log.Printf("[api] Failed to stream the dashboard: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// writeJson writes the value as JSON to the response
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[api] Failed to encode response: %v", err)
+	}
+}
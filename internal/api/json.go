@@ -0,0 +1,341 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// The json types define the format of the API responses.
+// They are separate from the internal messages to keep the API readable and stable.
+
+type decisionJson struct {
+	Floor         int    `json:"floor"`
+	Direction     string `json:"direction"`
+	Elevator      int    `json:"elevator"`
+	Reason        string `json:"reason"`
+	Reassignments int    `json:"reassignments"`
+	// Costs maps the id of each candidate elevator to its estimated arrival in seconds
+	Costs map[string]float64 `json:"costs"`
+}
+
+func toDecisionsJson(decisions []message.AssignmentDecision) []decisionJson {
+	res := make([]decisionJson, 0, len(decisions))
+	for _, d := range decisions {
+		costs := make(map[string]float64)
+		for _, c := range d.Candidates {
+			costs[strconv.Itoa(int(c.Elevator))] = c.Cost.Seconds()
+		}
+		res = append(res, decisionJson{
+			Floor:         int(d.Floor),
+			Direction:     directionToString(d.Direction),
+			Elevator:      int(d.Elevator),
+			Reason:        d.Reason,
+			Reassignments: d.Reassignments,
+			Costs:         costs,
+		})
+	}
+	return res
+}
+
+type staleCallJson struct {
+	Floor     int    `json:"floor"`
+	Direction string `json:"direction"`
+	// Age is the time since the hall call was confirmed in seconds
+	Age   float64 `json:"age"`
+	Level int     `json:"level"`
+	// Elevator is the id of the assigned elevator or null if no elevator is assigned
+	Elevator *int  `json:"elevator"`
+	Excluded []int `json:"excluded"`
+}
+
+type staleJson struct {
+	Calls         []staleCallJson `json:"calls"`
+	Alarms        int             `json:"alarms"`
+	Reassignments int             `json:"reassignments"`
+}
+
+func toStaleJson(stale message.StaleCalls) staleJson {
+	res := staleJson{
+		Calls:         make([]staleCallJson, 0, len(stale.Calls)),
+		Alarms:        stale.Alarms,
+		Reassignments: stale.Reassignments,
+	}
+	for _, c := range stale.Calls {
+		excluded := make([]int, 0, len(c.Excluded))
+		for _, id := range c.Excluded {
+			excluded = append(excluded, int(id))
+		}
+		call := staleCallJson{
+			Floor:     int(c.Floor),
+			Direction: directionToString(c.Direction),
+			Age:       c.Age.Seconds(),
+			Level:     c.Level,
+			Excluded:  excluded,
+		}
+		if c.IsAssigned {
+			id := int(c.Elevator)
+			call.Elevator = &id
+		}
+		res.Calls = append(res.Calls, call)
+	}
+	return res
+}
+
+func directionToString(d request.Direction) string {
+	if d == request.Up {
+		return "up"
+	}
+	return "down"
+}
+
+type elevatorJson struct {
+	Id        int    `json:"id"`
+	Floor     int    `json:"floor"`
+	Behavior  string `json:"behavior"`
+	Direction string `json:"direction"`
+	Alive     bool   `json:"alive"`
+	Suspected bool   `json:"suspected"`
+	// Order contains the hall up, hall down and cab order of each floor
+	Order [][3]bool `json:"order"`
+}
+
+type requestJson struct {
+	// Type is one of "hall", "cab" or "destination"
+	Type  string `json:"type"`
+	Floor int    `json:"floor"`
+	// Direction is set for hall calls
+	Direction string `json:"direction,omitempty"`
+	// Elevator is set for cab calls
+	Elevator *int `json:"elevator,omitempty"`
+	// To is set for destination calls
+	To *int `json:"to,omitempty"`
+	// Board is the elevator to board, set for destination calls once the pickup is assigned
+	Board *int `json:"board,omitempty"`
+	// Status is one of "absent", "unconfirmed" or "confirmed"
+	Status string `json:"status"`
+}
+
+type dashboardJson struct {
+	Local     int            `json:"local"`
+	Floors    int            `json:"floors"`
+	Elevators []elevatorJson `json:"elevators"`
+	Requests  []requestJson  `json:"requests"`
+	// Faults contains the names of the simulated faults of the local elevator
+	Faults []string `json:"faults"`
+}
+
+func toDashboardJson(
+	local elevator.Id,
+	cluster message.ClusterState,
+	requests map[request.Origin]request.Status,
+	faults map[elevator.Health]bool,
+	isIsolated bool,
+) dashboardJson {
+	res := dashboardJson{
+		Local:     int(local),
+		Floors:    int(elevator.NumFloors),
+		Elevators: make([]elevatorJson, 0, len(cluster.States)),
+		Requests:  make([]requestJson, 0, len(requests)),
+		Faults:    make([]string, 0, len(faults)),
+	}
+
+	isAlive := make(map[elevator.Id]bool)
+	for _, id := range cluster.Alive {
+		isAlive[id] = true
+	}
+	isSuspected := make(map[elevator.Id]bool)
+	for _, id := range cluster.Suspected {
+		isSuspected[id] = true
+	}
+	for id, s := range cluster.States {
+		order := make([][3]bool, elevator.NumFloors)
+		for f := range order {
+			order[f] = cluster.Orders[id][f]
+		}
+		res.Elevators = append(res.Elevators, elevatorJson{
+			Id:        int(id),
+			Floor:     int(s.Floor),
+			Behavior:  s.Behavior.String(),
+			Direction: s.Direction.String(),
+			Alive:     isAlive[id],
+			Suspected: isSuspected[id],
+			Order:     order,
+		})
+	}
+	sort.Slice(res.Elevators, func(i, j int) bool { return res.Elevators[i].Id < res.Elevators[j].Id })
+
+	for o, s := range requests {
+		if s == request.Unknown {
+			continue
+		}
+		req := toRequestJson(o, s)
+		if d, ok := o.(request.Destination); ok {
+			if id, ok := cluster.Boardings[d]; ok {
+				board := int(id)
+				req.Board = &board
+			}
+		}
+		res.Requests = append(res.Requests, req)
+	}
+	sort.Slice(res.Requests, func(i, j int) bool {
+		a, b := res.Requests[i], res.Requests[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Floor != b.Floor {
+			return a.Floor < b.Floor
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		if intOrZero(a.Elevator) != intOrZero(b.Elevator) {
+			return intOrZero(a.Elevator) < intOrZero(b.Elevator)
+		}
+		return intOrZero(a.To) < intOrZero(b.To)
+	})
+
+	for name, h := range simulatedFaults {
+		if faults[h] {
+			res.Faults = append(res.Faults, name)
+		}
+	}
+	if isIsolated {
+		res.Faults = append(res.Faults, networkFault)
+	}
+	sort.Strings(res.Faults)
+	return res
+}
+
+func toRequestJson(o request.Origin, s request.Status) requestJson {
+	res := requestJson{Floor: int(o.GetFloor()), Status: statusToString(s)}
+	switch o := o.(type) {
+	case request.Hall:
+		res.Type = "hall"
+		res.Direction = directionToString(o.Direction)
+	case request.Cab:
+		res.Type = "cab"
+		id := int(o.Id)
+		res.Elevator = &id
+	case request.Destination:
+		res.Type = "destination"
+		to := int(o.To)
+		res.To = &to
+	}
+	return res
+}
+
+func statusToString(s request.Status) string {
+	switch s {
+	case request.Absent:
+		return "absent"
+	case request.Unconfirmed:
+		return "unconfirmed"
+	case request.Confirmed:
+		return "confirmed"
+	}
+	return "unknown"
+}
+
+func intOrZero(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// chaosJson is the format of the injected faults, which is both returned and accepted by the API
+type chaosJson struct {
+	Comms commsFaultsJson `json:"comms"`
+	Io    ioFaultsJson    `json:"io"`
+}
+
+type commsFaultsJson struct {
+	DropPercent      float64 `json:"drop_percent"`
+	DuplicatePercent float64 `json:"duplicate_percent"`
+	ReorderPercent   float64 `json:"reorder_percent"`
+	DelayMs          int     `json:"delay_ms"`
+	JitterMs         int     `json:"jitter_ms"`
+	BlockedPeers     []int   `json:"blocked_peers"`
+}
+
+type ioFaultsJson struct {
+	StuckFloorSensor  bool `json:"stuck_floor_sensor"`
+	StalledMotor      bool `json:"stalled_motor"`
+	ObstructionFlapMs int  `json:"obstruction_flap_ms"`
+}
+
+func toChaosJson(comms message.CommsFaults, io message.IoFaults) chaosJson {
+	blocked := make([]int, 0, len(comms.BlockedPeers))
+	for _, id := range comms.BlockedPeers {
+		blocked = append(blocked, int(id))
+	}
+	return chaosJson{
+		Comms: commsFaultsJson{
+			DropPercent:      comms.DropPercent,
+			DuplicatePercent: comms.DuplicatePercent,
+			ReorderPercent:   comms.ReorderPercent,
+			DelayMs:          int(comms.Delay.Milliseconds()),
+			JitterMs:         int(comms.Jitter.Milliseconds()),
+			BlockedPeers:     blocked,
+		},
+		Io: ioFaultsJson{
+			StuckFloorSensor:  io.StuckFloorSensor,
+			StalledMotor:      io.StalledMotor,
+			ObstructionFlapMs: int(io.ObstructionFlap.Milliseconds()),
+		},
+	}
+}
+
+// fromChaosJson returns the injected faults, or an error naming an invalid field
+func fromChaosJson(c chaosJson) (message.CommsFaults, message.IoFaults, error) {
+	percents := map[string]float64{
+		"drop_percent":      c.Comms.DropPercent,
+		"duplicate_percent": c.Comms.DuplicatePercent,
+		"reorder_percent":   c.Comms.ReorderPercent,
+	}
+	for name, p := range percents {
+		if p < 0 || p > 100 {
+			return message.CommsFaults{}, message.IoFaults{}, fmt.Errorf("comms.%v: %v is not between 0 and 100", name, p)
+		}
+	}
+	durations := map[string]int{
+		"comms.delay_ms":         c.Comms.DelayMs,
+		"comms.jitter_ms":        c.Comms.JitterMs,
+		"io.obstruction_flap_ms": c.Io.ObstructionFlapMs,
+	}
+	for name, ms := range durations {
+		if ms < 0 {
+			return message.CommsFaults{}, message.IoFaults{}, fmt.Errorf("%v: %v is negative", name, ms)
+		}
+	}
+
+	blocked := make([]elevator.Id, 0, len(c.Comms.BlockedPeers))
+	for _, id := range c.Comms.BlockedPeers {
+		if id < 0 || id > math.MaxUint8 {
+			return message.CommsFaults{}, message.IoFaults{}, fmt.Errorf("comms.blocked_peers: %v is not a valid id", id)
+		}
+		blocked = append(blocked, elevator.Id(id))
+	}
+
+	comms := message.CommsFaults{
+		DropPercent:      c.Comms.DropPercent,
+		DuplicatePercent: c.Comms.DuplicatePercent,
+		ReorderPercent:   c.Comms.ReorderPercent,
+		Delay:            time.Duration(c.Comms.DelayMs) * time.Millisecond,
+		Jitter:           time.Duration(c.Comms.JitterMs) * time.Millisecond,
+		BlockedPeers:     blocked,
+	}
+	io := message.IoFaults{
+		StuckFloorSensor: c.Io.StuckFloorSensor,
+		StalledMotor:     c.Io.StalledMotor,
+		ObstructionFlap:  time.Duration(c.Io.ObstructionFlapMs) * time.Millisecond,
+	}
+	return comms, io, nil
+}
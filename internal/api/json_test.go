@@ -0,0 +1,66 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+func TestChaosJson(t *testing.T) {
+	comms := message.CommsFaults{
+		DropPercent:  20,
+		Delay:        100 * time.Millisecond,
+		Jitter:       30 * time.Millisecond,
+		BlockedPeers: []elevator.Id{1, 2},
+	}
+	io := message.IoFaults{StalledMotor: true, ObstructionFlap: 500 * time.Millisecond}
+
+	gotComms, gotIo, err := fromChaosJson(toChaosJson(comms, io))
+	if err != nil {
+		t.Fatalf("expected valid faults, got %v", err)
+	}
+	if !reflect.DeepEqual(gotComms, comms) || gotIo != io {
+		t.Errorf("expected %+v and %+v, got %+v and %+v", comms, io, gotComms, gotIo)
+	}
+
+	invalid := []chaosJson{
+		{Comms: commsFaultsJson{DropPercent: 101}},
+		{Comms: commsFaultsJson{ReorderPercent: -1}},
+		{Comms: commsFaultsJson{DelayMs: -5}},
+		{Comms: commsFaultsJson{BlockedPeers: []int{256}}},
+		{Io: ioFaultsJson{ObstructionFlapMs: -1}},
+	}
+	for _, c := range invalid {
+		if _, _, err := fromChaosJson(c); err == nil {
+			t.Errorf("expected %+v to be invalid", c)
+		}
+	}
+}
+
+func TestDashboardJsonBoarding(t *testing.T) {
+	assigned := request.Destination{From: 1, To: 3}
+	pending := request.Destination{From: 2, To: 0}
+	cluster := message.ClusterState{Boardings: map[request.Destination]elevator.Id{assigned: 2}}
+	requests := map[request.Origin]request.Status{assigned: request.Confirmed, pending: request.Unconfirmed}
+
+	res := toDashboardJson(1, cluster, requests, map[elevator.Health]bool{}, false)
+	if len(res.Requests) != 2 {
+		t.Fatalf("expected 2 requests, got %+v", res.Requests)
+	}
+	for _, r := range res.Requests {
+		switch r.Floor {
+		case int(assigned.From):
+			if r.Board == nil || *r.Board != 2 {
+				t.Errorf("expected the destination call to board elevator 2, got %v", r.Board)
+			}
+		case int(pending.From):
+			if r.Board != nil {
+				t.Errorf("expected no elevator to board for the unassigned destination call, got %v", *r.Board)
+			}
+		}
+	}
+}
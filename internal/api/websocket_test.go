@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Example of the opening handshake in RFC 6455
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("expected the accept key of the RFC, got %v", got)
+	}
+}
+
+func TestWebsocketFrames(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	conn := &websocketConn{conn: server, rw: bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))}
+
+	// A masked ping of the client with the payload "Hello", as in the examples of RFC 6455
+	go client.Write([]byte{0x89, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58})
+	opcode, payload, err := conn.ReadFrame()
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if opcode != opPing || string(payload) != "Hello" {
+		t.Errorf("expected a ping with Hello, got opcode %v with %q", opcode, payload)
+	}
+
+	// A text frame that needs the 16 bit length
+	text := bytes.Repeat([]byte("a"), 300)
+	go conn.WriteText(text)
+	frame := make([]byte, 4+len(text))
+	if _, err := io.ReadFull(client, frame); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if frame[0] != 0x81 || frame[1] != 126 || int(frame[2])<<8|int(frame[3]) != len(text) {
+		t.Errorf("unexpected header % x", frame[:4])
+	}
+	if !bytes.Equal(frame[4:], text) {
+		t.Errorf("unexpected payload")
+	}
+}
@@ -0,0 +1,394 @@
+// audit writes every state transition of the requests to a rotating JSONL file for post-incident analysis.
+//
+// Besides the decisions of the modules (transitions and clears), the inputs of the requests module and the driver
+// are recorded as events, so that the decisions can be reproduced offline by cmd/replay.
+//
+// Each line of the file is one JSON record. When the file exceeds its maximum size, it is renamed to <path>.1,
+// the older files are shifted to <path>.2, <path>.3 and so on, and the oldest file is removed.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// Kind constants describe what caused a record.
+const (
+	// KindTransition is a status change of a request in the requests module
+	KindTransition = "transition"
+	// KindClear is a request cleared by the local driver after serving it
+	KindClear = "clear"
+
+	// KindInput is a request message processed by the requests module
+	KindInput = "input"
+	// KindPeers is an update of the alive peers processed by the requests module
+	KindPeers = "peers"
+	// KindSynced is the end of the join handshake processed by the requests module
+	KindSynced = "synced"
+
+	// KindOrder is a new order received by the driver
+	KindOrder = "order"
+	// KindFloor is a floor arrival received by the driver
+	KindFloor = "floor"
+	// KindInitialized is the driver starting at a floor without having to search for one
+	KindInitialized = "initialized"
+	// KindDoorClosed is the door timer of the driver closing the door
+	KindDoorClosed = "door_closed"
+	// KindHalt is the driver halting due to a floor sensor fault
+	KindHalt = "halt"
+)
+
+// IsDecision returns true if the kind is a decision of a module rather than an input event
+func IsDecision(kind string) bool {
+	return kind == KindTransition || kind == KindClear
+}
+
+// Origin identifies the request of a record.
+type Origin struct {
+	// Type is one of "hall", "cab" or "destination"
+	Type  string `json:"type"`
+	Floor int    `json:"floor"`
+	// Direction is set for hall calls and is either "up" or "down"
+	Direction string `json:"direction,omitempty"`
+	// Cab is the id of the elevator of a cab call
+	Cab *int `json:"cab,omitempty"`
+	// To is the destination floor of a destination call
+	To *int `json:"to,omitempty"`
+}
+
+// Record is one line of the audit log.
+type Record struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	// Node is the id of the local elevator that wrote the record
+	Node int `json:"node"`
+	// Source is the id of the peer whose message caused the record
+	Source int     `json:"source"`
+	Origin *Origin `json:"origin,omitempty"`
+	// OldStatus and NewStatus are the statuses before and after the transition.
+	// For an input, NewStatus is the status of the received request.
+	OldStatus string `json:"old_status,omitempty"`
+	NewStatus string `json:"new_status,omitempty"`
+	// Ledger contains the ids of the peers that had acknowledged the request at the time of the transition
+	Ledger []int `json:"ledger,omitempty"`
+
+	// Peers, Partitioned and InMajority describe the alive peers of a peers event
+	Peers       []int `json:"peers,omitempty"`
+	Partitioned bool  `json:"partitioned,omitempty"`
+	InMajority  bool  `json:"in_majority,omitempty"`
+
+	// Floor is the floor of a floor or initialized event
+	Floor *int `json:"floor,omitempty"`
+	// Order contains the hall up, hall down and cab button of each floor of an order event
+	Order [][3]bool `json:"order,omitempty"`
+	// Destinations contains the destination calls whose passengers board the elevator of an order event
+	Destinations []Origin `json:"destinations,omitempty"`
+}
+
+// Logger writes records to a rotating JSONL file.
+//
+// It is safe for concurrent use. A nil Logger discards all records, so that the audit log can be disabled.
+type Logger struct {
+	mtx      sync.Mutex
+	node     elevator.Id
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	// out is the destination of the records. It is the file unless the logger was created by NewWriter
+	out io.Writer
+}
+
+// NewWriter creates a logger that writes the records to w without rotation.
+// It is used to collect the records of a replay.
+func NewWriter(w io.Writer, node elevator.Id) *Logger {
+	return &Logger{node: node, out: w}
+}
+
+// New opens the audit log at path and appends to it.
+// The file is rotated when it exceeds maxBytes, and at most maxFiles rotated files are kept.
+func New(path string, node elevator.Id, maxBytes int64, maxFiles int) (*Logger, error) {
+	l := &Logger{
+		node:     node,
+		path:     path,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Transition records a status change of a request in the requests module
+func (l *Logger) Transition(source elevator.Id, o request.Origin, oldStatus, newStatus request.Status, ledger []elevator.Id) {
+	if l == nil {
+		return
+	}
+	l.write(Record{
+		Time:      time.Now(),
+		Kind:      KindTransition,
+		Node:      int(l.node),
+		Source:    int(source),
+		Origin:    toOriginPtr(o),
+		OldStatus: StatusName(oldStatus),
+		NewStatus: StatusName(newStatus),
+		Ledger:    toInts(ledger),
+	})
+}
+
+// Clear records a request cleared by the local driver
+func (l *Logger) Clear(o request.Origin) {
+	if l == nil {
+		return
+	}
+	l.write(Record{
+		Time:      time.Now(),
+		Kind:      KindClear,
+		Node:      int(l.node),
+		Source:    int(l.node),
+		Origin:    toOriginPtr(o),
+		NewStatus: StatusName(request.Absent),
+	})
+}
+
+// Input records a request message before it is processed by the requests module
+func (l *Logger) Input(source elevator.Id, req request.Request) {
+	if l == nil {
+		return
+	}
+	l.write(Record{
+		Time:      time.Now(),
+		Kind:      KindInput,
+		Node:      int(l.node),
+		Source:    int(source),
+		Origin:    toOriginPtr(req.Origin),
+		NewStatus: StatusName(req.Status),
+	})
+}
+
+// Peers records an update of the alive peers before it is processed by the requests module
+func (l *Logger) Peers(peers []elevator.Id, partitioned, inMajority bool) {
+	if l == nil {
+		return
+	}
+	l.write(Record{
+		Time:        time.Now(),
+		Kind:        KindPeers,
+		Node:        int(l.node),
+		Source:      int(l.node),
+		Peers:       toInts(peers),
+		Partitioned: partitioned,
+		InMajority:  inMajority,
+	})
+}
+
+// Event records an input event without further information, e.g. KindSynced or KindHalt
+func (l *Logger) Event(kind string) {
+	if l == nil {
+		return
+	}
+	l.write(Record{Time: time.Now(), Kind: kind, Node: int(l.node), Source: int(l.node)})
+}
+
+// Floor records a floor event of the driver, i.e. KindFloor or KindInitialized
+func (l *Logger) Floor(kind string, floor elevator.Floor) {
+	if l == nil {
+		return
+	}
+	f := int(floor)
+	l.write(Record{Time: time.Now(), Kind: kind, Node: int(l.node), Source: int(l.node), Floor: &f})
+}
+
+// Order records a new order received by the driver
+func (l *Logger) Order(order elevator.Order, destinations []request.Destination) {
+	if l == nil {
+		return
+	}
+	o := make([][3]bool, len(order))
+	for f := range order {
+		o[f] = order[f]
+	}
+	d := make([]Origin, 0, len(destinations))
+	for _, dest := range destinations {
+		d = append(d, ToOrigin(dest))
+	}
+	l.write(Record{Time: time.Now(), Kind: KindOrder, Node: int(l.node), Source: int(l.node), Order: o, Destinations: d})
+}
+
+// Close closes the audit log
+func (l *Logger) Close() {
+	if l == nil {
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+		l.out = nil
+	}
+}
+
+func (l *Logger) write(r Record) {
+	line, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("[audit] Failed to encode record: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.out == nil {
+		return
+	}
+	if l.file != nil && l.maxBytes > 0 && l.size+int64(len(line)) > l.maxBytes && l.size > 0 {
+		if err := l.rotate(); err != nil {
+			log.Printf("[audit] Failed to rotate %v: %v", l.path, err)
+			return
+		}
+	}
+	n, err := l.out.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("[audit] Failed to write record: %v", err)
+	}
+}
+
+// open opens the file at the path for appending
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.out = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files by one, moves the current file to <path>.1 and opens a new file
+func (l *Logger) rotate() error {
+	l.file.Close()
+	l.file = nil
+	l.out = nil
+
+	os.Remove(rotatedPath(l.path, l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedPath(l.path, i), rotatedPath(l.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if l.maxFiles > 0 {
+		if err := os.Rename(l.path, rotatedPath(l.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func rotatedPath(path string, i int) string {
+	return fmt.Sprintf("%v.%v", path, i)
+}
+
+// ToOrigin converts the origin of a request to its audit format
+func ToOrigin(o request.Origin) Origin {
+	switch o := o.(type) {
+	case request.Hall:
+		direction := "down"
+		if o.Direction == request.Up {
+			direction = "up"
+		}
+		return Origin{Type: "hall", Floor: int(o.Floor), Direction: direction}
+	case request.Cab:
+		id := int(o.Id)
+		return Origin{Type: "cab", Floor: int(o.Floor), Cab: &id}
+	case request.Destination:
+		to := int(o.To)
+		return Origin{Type: "destination", Floor: int(o.From), To: &to}
+	}
+	return Origin{}
+}
+
+func toOriginPtr(o request.Origin) *Origin {
+	origin := ToOrigin(o)
+	return &origin
+}
+
+// FromOrigin converts the audit format of an origin back to the origin of a request
+func FromOrigin(o Origin) (request.Origin, error) {
+	switch o.Type {
+	case "hall":
+		direction := request.Down
+		if o.Direction == "up" {
+			direction = request.Up
+		}
+		return request.Hall{Floor: elevator.Floor(o.Floor), Direction: direction}, nil
+	case "cab":
+		if o.Cab == nil {
+			return nil, fmt.Errorf("cab origin without elevator id")
+		}
+		return request.Cab{Id: elevator.Id(*o.Cab), Floor: elevator.Floor(o.Floor)}, nil
+	case "destination":
+		if o.To == nil {
+			return nil, fmt.Errorf("destination origin without destination floor")
+		}
+		return request.Destination{From: elevator.Floor(o.Floor), To: elevator.Floor(*o.To)}, nil
+	}
+	return nil, fmt.Errorf("unknown origin type %q", o.Type)
+}
+
+// ParseStatus converts the name of a status as written to the audit log back to the status
+func ParseStatus(name string) request.Status {
+	switch name {
+	case "absent":
+		return request.Absent
+	case "unconfirmed":
+		return request.Unconfirmed
+	case "confirmed":
+		return request.Confirmed
+	default:
+		return request.Unknown
+	}
+}
+
+// StatusName returns the name of the status as written to the audit log
+func StatusName(s request.Status) string {
+	switch s {
+	case request.Absent:
+		return "absent"
+	case request.Unconfirmed:
+		return "unconfirmed"
+	case request.Confirmed:
+		return "confirmed"
+	default:
+		return "unknown"
+	}
+}
+
+func toInts(ids []elevator.Id) []int {
+	res := make([]int, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, int(id))
+	}
+	sort.Ints(res)
+	return res
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+func TestLoggerRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := New(path, 1, 600, 2)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	hall := request.Hall{Floor: 2, Direction: request.Up}
+	for i := 0; i < 20; i++ {
+		l.Transition(2, hall, request.Unconfirmed, request.Confirmed, []elevator.Id{2, 1})
+	}
+	l.Clear(request.Cab{Id: 1, Floor: 3})
+	l.Close()
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Expected %v to exist: %v", p, err)
+		}
+		if info.Size() > 600 {
+			t.Errorf("Expected %v to be rotated at 600 bytes, got %v", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected at most 2 rotated files")
+	}
+
+	records := readRecords(t, path)
+	last := records[len(records)-1]
+	if last.Kind != KindClear || last.Origin.Type != "cab" || *last.Origin.Cab != 1 || last.NewStatus != "absent" {
+		t.Errorf("Unexpected clear record: %+v", last)
+	}
+	first := readRecords(t, path+".1")[0]
+	if first.Kind != KindTransition || first.Source != 2 || first.OldStatus != "unconfirmed" ||
+		first.NewStatus != "confirmed" || len(first.Ledger) != 2 || first.Ledger[0] != 1 {
+		t.Errorf("Unexpected transition record: %+v", first)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Transition(1, request.Hall{}, request.Absent, request.Unconfirmed, nil)
+	l.Clear(request.Hall{})
+	l.Close()
+}
+
+func readRecords(t *testing.T, path string) []Record {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %v: %v", path, err)
+	}
+	defer file.Close()
+
+	records := make([]Record, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Failed to decode %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
@@ -0,0 +1,140 @@
+// chaos is a package that injects network faults into the messages received by the local peer.
+//
+// A relay is placed between the receiver of the broadcasts and the module that handles them.
+// It drops, duplicates, holds back and delays the messages as set on the link it shares with the other relays,
+// so that packet loss and partitions can be tested without changing the network of the machine.
+// The faults can be changed at any time, e.g. over the API.
+package chaos
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// maxHold is the longest time a message is held back for reordering.
+// The held messages are delivered after the next message, or after this time if no message follows.
+const maxHold = 200 * time.Millisecond
+
+// Link holds the faults that are injected into the received messages
+//
+// It is shared by the relays of all message types and may be changed while they are running.
+type Link struct {
+	mtx    sync.Mutex
+	faults message.CommsFaults
+	rng    *rand.Rand
+}
+
+// decision is what a relay does with a received message
+type decision struct {
+	// copies is the number of times the message is delivered. Zero drops the message.
+	copies int
+	// hold is true if the message is held back until after the next message
+	hold  bool
+	delay time.Duration
+}
+
+// NewLink returns a link without faults that draws the chances of the faults from rng
+func NewLink(rng *rand.Rand) *Link {
+	return &Link{rng: rng}
+}
+
+// Set replaces the injected faults
+func (l *Link) Set(faults message.CommsFaults) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.faults = faults
+}
+
+// decide draws what happens to a message from the source
+func (l *Link) decide(source elevator.Id) decision {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	f := l.faults
+	if slices.Contains(f.BlockedPeers, source) || l.chance(f.DropPercent) {
+		return decision{}
+	}
+	d := decision{copies: 1, delay: f.Delay}
+	if l.chance(f.DuplicatePercent) {
+		d.copies = 2
+	}
+	if l.chance(f.ReorderPercent) {
+		d.hold = true
+	}
+	if f.Jitter > 0 {
+		d.delay += time.Duration(l.rng.Int63n(int64(f.Jitter)))
+	}
+	return d
+}
+
+// chance returns true with the given chance in percent. The mutex must be held by the caller.
+func (l *Link) chance(percent float64) bool {
+	return percent > 0 && l.rng.Float64()*100 < percent
+}
+
+// Relay should be run as a goroutine and passes the messages from in to out, with the faults of the link injected
+//
+// source returns the peer that sent a message, so that the messages of blocked peers are dropped.
+// Delayed messages are delivered concurrently, so that a jitter also reorders the messages.
+// The relay stops when the context is done.
+func Relay[T any](ctx context.Context, link *Link, in <-chan T, out chan<- T, source func(T) elevator.Id) {
+	held := make([]T, 0)
+	flush := time.NewTimer(maxHold)
+	flush.Stop()
+
+	deliver := func(msg T, delay time.Duration) {
+		if delay <= 0 {
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+			}
+			return
+		}
+		time.AfterFunc(delay, func() {
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+			}
+		})
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-flush.C:
+			for _, msg := range held {
+				deliver(msg, 0)
+			}
+			held = held[:0]
+
+		case msg := <-in:
+			d := link.decide(source(msg))
+			if d.hold {
+				for i := 0; i < d.copies; i++ {
+					held = append(held, msg)
+				}
+				flush.Reset(maxHold)
+				continue
+			}
+			for i := 0; i < d.copies; i++ {
+				deliver(msg, d.delay)
+			}
+			if len(held) > 0 && d.copies > 0 {
+				// The held messages are delivered after this one, so they arrive out of order
+				flush.Stop()
+				for _, h := range held {
+					deliver(h, d.delay)
+				}
+				held = held[:0]
+			}
+		}
+	}
+}
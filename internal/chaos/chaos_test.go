@@ -0,0 +1,147 @@
+package chaos
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+type testMessage struct {
+	Source elevator.Id
+	Seq    int
+}
+
+// startRelay runs a relay on the link and returns its input and output
+func startRelay(t *testing.T, link *Link) (chan<- testMessage, <-chan testMessage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	in := make(chan testMessage)
+	out := make(chan testMessage, 5000)
+	go Relay(ctx, link, in, out, func(m testMessage) elevator.Id { return m.Source })
+	return in, out
+}
+
+// collect receives the messages from out until none arrived within the timeout
+func collect(out <-chan testMessage, timeout time.Duration) []testMessage {
+	msgs := make([]testMessage, 0)
+	for {
+		select {
+		case m := <-out:
+			msgs = append(msgs, m)
+		case <-time.After(timeout):
+			return msgs
+		}
+	}
+}
+
+func TestRelayWithoutFaults(t *testing.T) {
+	in, out := startRelay(t, NewLink(rand.New(rand.NewSource(1))))
+	for i := 0; i < 10; i++ {
+		in <- testMessage{Source: 1, Seq: i}
+	}
+	msgs := collect(out, 50*time.Millisecond)
+	if len(msgs) != 10 {
+		t.Fatalf("expected 10 messages, got %v", len(msgs))
+	}
+	for i, m := range msgs {
+		if m.Seq != i {
+			t.Fatalf("expected the messages in order, got %v", msgs)
+		}
+	}
+}
+
+func TestDropAndDuplicate(t *testing.T) {
+	link := NewLink(rand.New(rand.NewSource(1)))
+	link.Set(message.CommsFaults{DropPercent: 30, DuplicatePercent: 50})
+	in, out := startRelay(t, link)
+	for i := 0; i < 1000; i++ {
+		in <- testMessage{Source: 1, Seq: i}
+	}
+	msgs := collect(out, 50*time.Millisecond)
+
+	// 70% of the messages pass, and half of those are delivered twice
+	if n := float64(len(msgs)); math.Abs(n-1050) > 80 {
+		t.Errorf("expected about 1050 delivered messages, got %v", n)
+	}
+	seen := make(map[int]int)
+	for _, m := range msgs {
+		seen[m.Seq]++
+	}
+	if n := float64(len(seen)); math.Abs(n-700) > 60 {
+		t.Errorf("expected about 700 distinct messages, got %v", n)
+	}
+}
+
+func TestBlockedPeers(t *testing.T) {
+	link := NewLink(rand.New(rand.NewSource(1)))
+	link.Set(message.CommsFaults{BlockedPeers: []elevator.Id{2}})
+	in, out := startRelay(t, link)
+	in <- testMessage{Source: 2, Seq: 0}
+	in <- testMessage{Source: 1, Seq: 1}
+	in <- testMessage{Source: 2, Seq: 2}
+
+	msgs := collect(out, 50*time.Millisecond)
+	if len(msgs) != 1 || msgs[0].Source != 1 {
+		t.Fatalf("expected only the message of peer 1, got %v", msgs)
+	}
+
+	// Unblocking the peer takes effect immediately
+	link.Set(message.CommsFaults{})
+	in <- testMessage{Source: 2, Seq: 3}
+	if msgs := collect(out, 50*time.Millisecond); len(msgs) != 1 {
+		t.Fatalf("expected the message of peer 2 after unblocking, got %v", msgs)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	link := NewLink(rand.New(rand.NewSource(1)))
+	link.Set(message.CommsFaults{ReorderPercent: 100})
+	in, out := startRelay(t, link)
+	in <- testMessage{Source: 1, Seq: 0}
+
+	// A held message is delivered once nothing follows within the hold time
+	select {
+	case m := <-out:
+		t.Fatalf("expected the message to be held back, got %v", m)
+	case <-time.After(maxHold / 2):
+	}
+	if msgs := collect(out, maxHold); len(msgs) != 1 {
+		t.Fatalf("expected the held message to be delivered, got %v", msgs)
+	}
+
+	link.Set(message.CommsFaults{ReorderPercent: 50})
+	for i := 0; i < 100; i++ {
+		in <- testMessage{Source: 1, Seq: i}
+	}
+	msgs := collect(out, 2*maxHold)
+	if len(msgs) != 100 {
+		t.Fatalf("expected all 100 messages, got %v", len(msgs))
+	}
+	outOfOrder := 0
+	for i := 1; i < len(msgs); i++ {
+		if msgs[i].Seq < msgs[i-1].Seq {
+			outOfOrder++
+		}
+	}
+	if outOfOrder == 0 {
+		t.Errorf("expected some messages out of order")
+	}
+}
+
+func TestDelay(t *testing.T) {
+	link := NewLink(rand.New(rand.NewSource(1)))
+	link.Set(message.CommsFaults{Delay: 100 * time.Millisecond, Jitter: 50 * time.Millisecond})
+	in, out := startRelay(t, link)
+
+	start := time.Now()
+	in <- testMessage{Source: 1}
+	<-out
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 300*time.Millisecond {
+		t.Errorf("expected the message to be delayed by 100 to 150 ms, got %v", elapsed)
+	}
+}
@@ -2,20 +2,46 @@ package comms
 
 import (
 	"Network-go/network/bcast"
+	"context"
 	"fmt"
 	"log"
+	"math/rand"
 	"time"
 
+	"group48.ttk4145.ntnu/elevators/internal/chaos"
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
 )
 
 const SendInterval = time.Millisecond * 100
 
+// leaveRepetitions is the number of times the leave message is sent, as single UDP messages may be lost
+const leaveRepetitions = 3
+
+// udpMessage is the message broadcast by every peer in the send interval
+//
+// The network module drops every packet larger than its receive buffer, and the message is broadcast as base64
+// within a type-tagged JSON object, so the packet is about 4/3 of the encoded message.
+// The message grows with the number of elevators in the registry and with the versions of the requests,
+// and exceeds the 1024 bytes of the upstream network module already in a small cluster.
+// Thus, the vendored module is forked with a buffer of 4096 bytes, see external/Network-go/FORK.md.
+// TestPacketSize checks that the message fits for a cluster of ten elevators.
 type udpMessage struct {
 	Source   elevator.Id
 	Registry requestRegistry
 	EState   elevator.State
+	// Estimates are the estimated arrivals of the hall calls as calculated by the sending peer
+	Estimates []message.HallCallEstimate
+	// Abandoned are the hall calls the sending peer gave up, as it did not serve them in time
+	Abandoned []request.Hall
+	// Health tells the other peers whether the sending peer is operational and, if not, why
+	Health elevator.Health
+}
+
+// leaveMessage is broadcast by a peer that shuts down gracefully, so that the other peers drop it immediately
+type leaveMessage struct {
+	Source elevator.Id
 }
 
 // # RunComms runs the communication module
@@ -24,66 +50,251 @@ type udpMessage struct {
 // It send UDP messages with the local elevator state and all system requests to the broadcast address in a regular interval.
 // It listens for incoming UDP messages and sends the elevator state and changed requests to the outgoing channels.
 // It sends a health monitor ping on the health monitor ping channel when it receives an update from the local elevator state or validated requests channels.
+// The health of the local elevator is included in the UDP messages, so that the peers know why it is out of service.
+// The latest estimated arrivals of the hall calls from the orders module are included in the UDP messages.
+// The estimates received from the peers are sent to the orders module, which keeps hall calls with the elevator that claims them
+// and moves the hall calls a peer gave up away from it.
+// When the context is done, a leave message is broadcast before the module exits.
+// At startup, join messages are broadcast until a peer answers with a snapshot of its registry and elevator states,
+// or until the join timeout expires. Afterwards, the requests module is told that the local peer is synced.
+// While a simulated network fault isolates the local peer, nothing is sent and all received messages are dropped.
+// The injected network faults are applied to all received messages before they are handled, see [chaos.Relay].
 func RunComms(
+	ctx context.Context,
 	local elevator.Id,
 	port int,
 	fromDriver <-chan message.ElevatorState,
 	fromRequests <-chan message.RequestState,
 	fromHealthMonitor <-chan message.ActivePeers,
+	fromOrders <-chan message.HallCallEstimates,
+	networkFaults <-chan message.NetworkFault,
+	commsFaults <-chan message.CommsFaults,
 	toOrders chan<- message.ElevatorState,
+	toOrdersEstimates chan<- message.PeerEstimates,
 	toRequest chan<- message.RequestState,
-	toHealthMonitor chan<- message.PeerSignal) {
+	toHealthMonitor chan<- message.PeerSignal,
+	toRequestSync chan<- message.Synced) {
 
 	var sendTicker = time.NewTicker(SendInterval)
 	var internalEsBuffer = make([]elevator.State, 0)
 	var registry = newRequestRegistry()
-	var isLocalAlive = true
+	var estimates = make([]message.HallCallEstimate, 0)
+	var abandoned = make([]request.Hall, 0)
+	var localHealth = elevator.Operational
+	var peerStates = make(map[elevator.Id]elevator.State)
+	var handshake = newHandshake(local, time.Now())
+	var isIsolated = false
+	var link = chaos.NewLink(rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	// The broadcast has its own context, as the leave message is sent after the module context is done.
+	// The context variants of the network module are a local change, see external/Network-go/FORK.md
+	bcastCtx, stopBcast := context.WithCancel(context.Background())
+	defer stopBcast()
 
 	sendUdp := make(chan udpMessage)
 	receiveUdp := make(chan udpMessage)
-	go bcast.Transmitter(port, sendUdp)
-	go bcast.Receiver(port, receiveUdp)
+	sendLeave := make(chan leaveMessage)
+	receiveLeave := make(chan leaveMessage)
+	sendJoin := make(chan joinMessage)
+	receiveJoin := make(chan joinMessage)
+	sendSnapshot := make(chan snapshotMessage)
+	receiveSnapshot := make(chan snapshotMessage)
+	go bcast.TransmitterContext(bcastCtx, port, sendUdp, sendLeave, sendJoin, sendSnapshot)
+
+	// The received messages pass through the chaos relays, which inject the network faults
+	rawUdp := make(chan udpMessage)
+	rawLeave := make(chan leaveMessage)
+	rawJoin := make(chan joinMessage)
+	rawSnapshot := make(chan snapshotMessage)
+	go bcast.ReceiverContext(bcastCtx, port, rawUdp, rawLeave, rawJoin, rawSnapshot)
+	go chaos.Relay(bcastCtx, link, rawUdp, receiveUdp, func(m udpMessage) elevator.Id { return m.Source })
+	go chaos.Relay(bcastCtx, link, rawLeave, receiveLeave, func(m leaveMessage) elevator.Id { return m.Source })
+	go chaos.Relay(bcastCtx, link, rawJoin, receiveJoin, func(m joinMessage) elevator.Id { return m.Source })
+	go chaos.Relay(bcastCtx, link, rawSnapshot, receiveSnapshot, func(m snapshotMessage) elevator.Id { return m.Source })
+
+	// leave tells the peers that the local peer shuts down
+	leave := func() {
+		log.Printf("[comms] Shutting down. Telling the peers that the local peer leaves")
+		for i := 0; i < leaveRepetitions; i++ {
+			sendLeave <- leaveMessage{Source: local}
+			time.Sleep(SendInterval / 10)
+		}
+	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			leave()
+			return
+
 		case msg := <-fromDriver:
 			handleDriverMessage(msg, &internalEsBuffer)
 
 		case msg := <-fromRequests:
 			handleRequestMessage(msg, &registry)
 
+		case msg := <-fromOrders:
+			estimates = msg.Estimates
+			abandoned = msg.Abandoned
+
+		case msg := <-networkFaults:
+			if msg.Isolated != isIsolated {
+				log.Printf("[comms] Simulated network fault: isolated %v", msg.Isolated)
+			}
+			isIsolated = msg.Isolated
+
+		case msg := <-commsFaults:
+			log.Printf("[comms] Injected network faults: drop %v%%, duplicate %v%%, reorder %v%%, delay %v (jitter %v), blocked peers %v",
+				msg.DropPercent, msg.DuplicatePercent, msg.ReorderPercent, msg.Delay, msg.Jitter, msg.BlockedPeers)
+			link.Set(msg)
+
 		case <-sendTicker.C:
-			if len(internalEsBuffer) == 0 || !isLocalAlive {
+			if isIsolated {
+				continue
+			}
+			if handshake.shouldJoin() {
+				sendJoin <- joinMessage{Source: local}
+			}
+			if handshake.checkTimeout(time.Now()) {
+				select {
+				case toRequestSync <- message.Synced{}:
+				case <-ctx.Done():
+					leave()
+					return
+				}
+			}
+
+			if len(internalEsBuffer) == 0 {
 				// No internal elevator state to send yet
 				continue
 			}
 
 			u := udpMessage{
-				Source:   local,
-				Registry: registry,
-				EState:   internalEsBuffer[0],
+				Source:    local,
+				Registry:  registry,
+				EState:    internalEsBuffer[0],
+				Estimates: estimates,
+				Abandoned: abandoned,
+				Health:    localHealth,
 			}
 			sendUdp <- u
 		case msg := <-receiveUdp:
-			if msg.Source == local {
+			if msg.Source == local || isIsolated {
 				// Ignore messages from self
 				continue
 			}
-			toHealthMonitor <- message.PeerSignal{Id: msg.Source, Alive: true}
-			toOrders <- message.ElevatorState{Elevator: msg.Source, State: msg.EState}
+			if msg.Health != elevator.Operational {
+				// The peer is out of service, so it is excluded immediately.
+				// Its registry is ignored, as it does not take part in the confirmation of requests.
+				select {
+				case toHealthMonitor <- message.PeerSignal{Id: msg.Source, Alive: false, Health: msg.Health}:
+				case <-ctx.Done():
+					leave()
+					return
+				}
+				continue
+			}
+
+			select {
+			case toHealthMonitor <- message.PeerSignal{Id: msg.Source, Alive: true}:
+			case <-ctx.Done():
+				leave()
+				return
+			}
+			select {
+			case toOrders <- message.ElevatorState{Elevator: msg.Source, State: msg.EState}:
+			case <-ctx.Done():
+				leave()
+				return
+			}
+			select {
+			case toOrdersEstimates <- message.PeerEstimates{Source: msg.Source, Estimates: msg.Estimates, Abandoned: msg.Abandoned}:
+			case <-ctx.Done():
+				leave()
+				return
+			}
+			peerStates[msg.Source] = msg.EState
 
 			changedRequests := registry.diff(msg.Source, msg.Registry)
 			logRegistryDiff(msg.Source, changedRequests, registry, msg.Registry)
 			for _, msg := range changedRequests {
-				toRequest <- msg
+				select {
+				case toRequest <- msg:
+				case <-ctx.Done():
+					leave()
+					return
+				}
+			}
+		case msg := <-receiveJoin:
+			if msg.Source == local || !handshake.isSynced || isIsolated {
+				// A peer that is joining itself has no state worth sharing
+				continue
+			}
+			states := make(map[elevator.Id]elevator.State, len(peerStates)+1)
+			for id, s := range peerStates {
+				states[id] = s
+			}
+			if len(internalEsBuffer) != 0 {
+				states[local] = internalEsBuffer[0]
+			}
+			log.Printf("[comms] The peer with id %v joined. Sending a snapshot", msg.Source)
+			sendSnapshot <- newSnapshot(local, msg.Source, registry, states)
+
+		case msg := <-receiveSnapshot:
+			if isIsolated {
+				continue
+			}
+			wasSynced := handshake.isSynced
+			changedRequests, states, ok := handshake.applySnapshot(msg, &registry)
+			if !ok {
+				continue
+			}
+			logRegistryDiff(msg.Source, changedRequests, registry, msg.Registry)
+			for _, s := range states {
+				select {
+				case toOrders <- s:
+				case <-ctx.Done():
+					leave()
+					return
+				}
 			}
+			for _, r := range changedRequests {
+				select {
+				case toRequest <- r:
+				case <-ctx.Done():
+					leave()
+					return
+				}
+			}
+			if !wasSynced {
+				select {
+				case toRequestSync <- message.Synced{}:
+				case <-ctx.Done():
+					leave()
+					return
+				}
+			}
+
+		case msg := <-receiveLeave:
+			if msg.Source == local || isIsolated {
+				continue
+			}
+			log.Printf("[comms] The peer with id %v left", msg.Source)
+			delete(peerStates, msg.Source)
+			select {
+			case toHealthMonitor <- message.PeerSignal{Id: msg.Source, Alive: false, Left: true}:
+			case <-ctx.Done():
+				leave()
+				return
+			}
+
 		case msg := <-fromHealthMonitor:
-			newStatus := isLocalDead(msg.Peers, local)
-			if newStatus == isLocalAlive {
+			newHealth := msg.Health[local]
+			if newHealth == localHealth {
 				break
 			}
-			log.Printf("[comms] Status of the local peer changed: %v -> %v", isLocalAlive, newStatus)
-			isLocalAlive = newStatus
+			log.Printf("[comms] Health of the local peer changed: %v -> %v", localHealth, newHealth)
+			localHealth = newHealth
 		}
 	}
 
@@ -113,15 +324,6 @@ func handleRequestMessage(msg message.RequestState, registry *requestRegistry) {
 	}
 }
 
-func isLocalDead(aliveList []elevator.Id, local elevator.Id) bool {
-	for _, v := range aliveList {
-		if v == local {
-			return true
-		}
-	}
-	return false
-}
-
 func logRegistryDiff(peer elevator.Id, changed []message.RequestState, internal, external requestRegistry) {
 	if len(changed) == 0 {
 		return
@@ -0,0 +1,98 @@
+package comms
+
+import (
+	"Network-go/network/bcast"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// TestMessagesEncodable checks that the network module accepts all broadcast messages.
+// It rejects types it can not encode, e.g. maps without string keys, even in unexported fields.
+func TestMessagesEncodable(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("network module rejected the messages: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bcast.TransmitterContext(ctx, 0, make(chan udpMessage), make(chan leaveMessage), make(chan joinMessage), make(chan snapshotMessage))
+}
+
+// maxPacketSize is the receive buffer of the vendored network module, see external/Network-go/FORK.md
+const maxPacketSize = 4096
+
+// TestPacketSize checks that the broadcasts of a large cluster with long-running requests fit into the receive buffer
+func TestPacketSize(t *testing.T) {
+	const numElevators = 10
+	// A version this high is reached after hundreds of billions of calls
+	const highVersion version = 1 << 40
+
+	registry := newRequestRegistry()
+	states := make(map[string]elevator.State)
+	for id := 0; id < numElevators; id++ {
+		registry.initNewCab(strconv.Itoa(id))
+		states[strconv.Itoa(id)] = elevator.State{Floor: elevator.NumFloors - 1, Behavior: elevator.DoorOpen, Direction: elevator.Down}
+	}
+	estimates := make([]message.HallCallEstimate, 0)
+	abandoned := make([]request.Hall, 0)
+	for f := elevator.Floor(0); f < elevator.NumFloors; f++ {
+		registry.HallUp[f] = highVersion
+		registry.HallDown[f] = highVersion
+		for _, cab := range registry.Cab {
+			cab[f] = highVersion
+		}
+		for to := range registry.Destination[f] {
+			registry.Destination[f][to] = highVersion
+		}
+		for _, d := range []request.Direction{request.Up, request.Down} {
+			estimates = append(estimates, message.HallCallEstimate{Floor: f, Direction: d, Elevator: 255, Eta: time.Hour})
+			abandoned = append(abandoned, request.Hall{Floor: f, Direction: d})
+		}
+	}
+
+	messages := map[string]any{
+		"udp": udpMessage{
+			Source:    255,
+			Registry:  registry,
+			EState:    elevator.State{Floor: elevator.NumFloors - 1, Behavior: elevator.Moving, Direction: elevator.Down},
+			Estimates: estimates,
+			Abandoned: abandoned,
+			Health:    elevator.Maintenance,
+		},
+		"snapshot": snapshotMessage{Source: 255, Target: 254, Registry: registry, States: states},
+	}
+	for name, msg := range messages {
+		size := packetSize(t, msg)
+		t.Logf("%v message: %v bytes", name, size)
+		if size > maxPacketSize {
+			t.Errorf("the %v message takes %v bytes, more than the %v bytes of the receive buffer", name, size, maxPacketSize)
+		}
+	}
+}
+
+// packetSize returns the size of the packet the network module broadcasts for the message
+func packetSize(t *testing.T, msg any) int {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to encode the message: %v", err)
+	}
+	// The network module wraps the encoded message into a type-tagged JSON object
+	packet, err := json.Marshal(struct {
+		TypeId string
+		JSON   []byte
+	}{TypeId: reflect.TypeOf(msg).String(), JSON: b})
+	if err != nil {
+		t.Fatalf("failed to encode the packet: %v", err)
+	}
+	return len(packet)
+}
@@ -0,0 +1,103 @@
+package comms
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// joinTimeout is the time a joining peer waits for a snapshot before it assumes that it is alone
+const joinTimeout = time.Millisecond * 1000
+
+// joinMessage is broadcast by a peer that starts, so that the other peers send it a snapshot
+type joinMessage struct {
+	Source elevator.Id
+}
+
+// snapshotMessage is the answer to a joinMessage and contains the full state known to the sending peer
+type snapshotMessage struct {
+	Source elevator.Id
+	// Target is the id of the joining peer the snapshot is meant for
+	Target   elevator.Id
+	Registry requestRegistry
+	// States contains the latest elevator state of every peer known to the sending peer, including itself.
+	// The key is the id of the elevator as a string, because the json conversion only allows for strings.
+	States map[string]elevator.State
+}
+
+// handshake keeps track of whether the local peer has synced with the other peers after joining
+//
+// A joining peer broadcasts join messages until it receives a snapshot or the join timeout expires.
+// Until then, it does not confirm requests, as its registry may be missing requests the other peers know of.
+type handshake struct {
+	local    elevator.Id
+	isSynced bool
+	deadline time.Time
+}
+
+func newHandshake(local elevator.Id, now time.Time) *handshake {
+	return &handshake{
+		local:    local,
+		deadline: now.Add(joinTimeout),
+	}
+}
+
+// shouldJoin returns true if a join message should be sent
+func (h *handshake) shouldJoin() bool {
+	return !h.isSynced
+}
+
+// checkTimeout marks the local peer as synced if no peer answered within the join timeout
+// and returns true if the status changed
+func (h *handshake) checkTimeout(now time.Time) bool {
+	if h.isSynced || now.Before(h.deadline) {
+		return false
+	}
+	log.Printf("[comms] [handshake] No peer answered the join within %v. Assuming the local peer is alone", joinTimeout)
+	h.isSynced = true
+	return true
+}
+
+// applySnapshot merges the snapshot into the registry and returns the updates for the other modules
+//
+// The second return value is false if the snapshot is not meant for the local peer.
+func (h *handshake) applySnapshot(msg snapshotMessage, registry *requestRegistry) ([]message.RequestState, []message.ElevatorState, bool) {
+	if msg.Target != h.local {
+		return nil, nil, false
+	}
+
+	changedRequests := registry.diff(msg.Source, msg.Registry)
+	states := make([]message.ElevatorState, 0, len(msg.States))
+	for key, s := range msg.States {
+		id, err := strconv.Atoi(key)
+		if err != nil || elevator.Id(id) == h.local {
+			// The local elevator state is known best by the local driver
+			continue
+		}
+		states = append(states, message.ElevatorState{Elevator: elevator.Id(id), State: s})
+	}
+
+	if !h.isSynced {
+		log.Printf("[comms] [handshake] Synced with the snapshot of peer %v: %v changed requests, %v elevator states",
+			msg.Source, len(changedRequests), len(states))
+	}
+	h.isSynced = true
+	return changedRequests, states, true
+}
+
+// newSnapshot creates the snapshot for a joining peer
+func newSnapshot(local, target elevator.Id, registry requestRegistry, states map[elevator.Id]elevator.State) snapshotMessage {
+	s := make(map[string]elevator.State, len(states))
+	for id, state := range states {
+		s[strconv.Itoa(int(id))] = state
+	}
+	return snapshotMessage{
+		Source:   local,
+		Target:   target,
+		Registry: registry,
+		States:   s,
+	}
+}
@@ -0,0 +1,52 @@
+package comms
+
+import (
+	"Network-go/network/bcast"
+	"context"
+	"log"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// RunObserver listens passively to the broadcasts of the peers on the port
+//
+// Every received udpMessage is decoded and sent on the observation channel together with the time of reception.
+// Leave messages are passed on as well, so that the observer can forget a peer that shut down.
+// The observer never transmits, so it is invisible to the peers and takes no part in the confirmation of requests.
+// The port is shared with a peer running on the same host, as the broadcast connection is opened with SO_REUSEADDR.
+func RunObserver(ctx context.Context, port int, toObserver chan<- message.PeerObservation) {
+	receiveUdp := make(chan udpMessage)
+	receiveLeave := make(chan leaveMessage)
+	go bcast.ReceiverContext(ctx, port, receiveUdp, receiveLeave)
+	log.Printf("[comms] [observer] Listening on port %v", port)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case msg := <-receiveUdp:
+			observation := message.PeerObservation{
+				Source:    msg.Source,
+				Time:      time.Now(),
+				State:     msg.EState,
+				Health:    msg.Health,
+				Requests:  msg.Registry.requests(),
+				Estimates: msg.Estimates,
+			}
+			select {
+			case toObserver <- observation:
+			case <-ctx.Done():
+				return
+			}
+
+		case msg := <-receiveLeave:
+			select {
+			case toObserver <- message.PeerObservation{Source: msg.Source, Time: time.Now(), Left: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
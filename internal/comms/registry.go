@@ -3,6 +3,8 @@ package comms
 import (
 	"fmt"
 	"log"
+	"math"
+	"sort"
 	"strconv"
 
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
@@ -17,46 +19,110 @@ import (
 // Thus the registry stores the change and can calculate the diff between two registries to
 // enable the conversion back to the internal messaging model.
 // Also, in case one elevator dies, the information is backed up here.
+//
+// Every entry is stored as a version instead of a raw status, see version for details.
+// As versions only increase, stale or reordered packets can be detected and are ignored.
 type requestRegistry struct {
-	// HallUp and HallDown are arrays of request status where the index is the floor
-	HallUp   []request.Status
-	HallDown []request.Status
+	// HallUp and HallDown are arrays of request versions where the index is the floor
+	HallUp   []version
+	HallDown []version
 
 	// Map uses the id of the elevator as key
 	// Is a string because the json conversion of network module only allows for strings
-	// The value is an array of request status where the index is the floor
-	Cab map[string][]request.Status
+	// The value is an array of request versions where the index is the floor
+	Cab map[string][]version
+
+	// Destination is a matrix of request versions where the first index is the floor
+	// the passenger waits on and the second index is the floor the passenger travels to
+	Destination [][]version
+
+	// seen contains the highest version of each request received from any peer.
+	// It is not shared, so that a peer that lags behind catches up with the others on its next transition.
+	// It is keyed by the string of the origin, as the network module rejects maps with other keys even if they are unexported.
+	seen map[string]version
+}
+
+// version is a counter of the transitions of one request through the cyclic state machine
+//
+//	0 (Unknown) -> 1 (Absent) -> 2 (Unconfirmed) -> 3 (Confirmed) -> 4 (Absent) -> 5 (Unconfirmed) -> ...
+//
+// The status of the request is given by the version, and a higher version is always newer.
+// All peers that move a request to the same status in the same cycle end up with the same version,
+// so the merge of two registries only has to compare the versions.
+type version uint64
+
+// cycleLength is the number of statuses in one cycle of the state machine
+const cycleLength = 3
+
+// status returns the status of the request at this version
+func (v version) status() request.Status {
+	if v == 0 {
+		return request.Unknown
+	}
+	return request.Absent + request.Status((v-1)%cycleLength)
+}
+
+// advance returns the lowest version not below v and base at which the request has the given status
+func (v version) advance(base version, s request.Status) version {
+	next := max(v, base)
+	if next == 0 {
+		next = 1
+	}
+	for next.status() != s {
+		next++
+	}
+	return next
+}
+
+// isNewer checks if the remote version must be passed on to the requests module
+//
+// Only newer versions are passed on, as older ones stem from stale or reordered packets.
+// If both are at the same Unconfirmed version, the remote version is passed on as well to enable acknowledgement of the request.
+func isNewer(local, remote version) bool {
+	if remote == 0 {
+		// The remote status is Unknown and adds no value
+		return false
+	}
+	if remote == local {
+		return remote.status() == request.Unconfirmed
+	}
+	return remote > local
 }
 
 func newRequestRegistry() requestRegistry {
-	hu := make([]request.Status, elevator.NumFloors)
-	hd := make([]request.Status, elevator.NumFloors)
-	c := make(map[string][]request.Status)
+	hu := make([]version, elevator.NumFloors)
+	hd := make([]version, elevator.NumFloors)
+	c := make(map[string][]version)
+	d := make([][]version, elevator.NumFloors)
 
 	for i := elevator.Floor(0); i < elevator.NumFloors; i++ {
-		hu[i] = request.Unknown
-		hd[i] = request.Unknown
+		d[i] = make([]version, elevator.NumFloors)
 	}
 
 	return requestRegistry{
-		HallUp:   hu,
-		HallDown: hd,
-		Cab:      c,
+		HallUp:      hu,
+		HallDown:    hd,
+		Cab:         c,
+		Destination: d,
+		seen:        make(map[string]version),
 	}
 }
 
+// seenKey returns the key of the origin in the seen versions
+func seenKey(o request.Origin) string {
+	return fmt.Sprint(o)
+}
+
 // Adds a new cab to the registry
 func (r *requestRegistry) initNewCab(id string) {
-	cab := make([]request.Status, elevator.NumFloors)
-	for i := elevator.Floor(0); i < elevator.NumFloors; i++ {
-		cab[i] = request.Unknown
-	}
-
-	r.Cab[id] = cab
+	r.Cab[id] = make([]version, elevator.NumFloors)
 }
 
-// update takes in a internal msg from the request module and replaces the stored information
+// update takes in a internal msg from the request module and advances the stored version to the new status
 // As the msg were validated by the request module no checks on the status information are needed
+//
+// The version jumps to the highest version seen from the other peers if possible,
+// so that the update is not mistaken for a stale one by the peers that are further ahead.
 func (r *requestRegistry) update(req request.Request) {
 	if req.Status == request.Unknown {
 		// Ignore unknown requests as they add no value
@@ -64,15 +130,33 @@ func (r *requestRegistry) update(req request.Request) {
 	}
 	floor := req.Origin.GetFloor()
 
-	if request.IsFromHall(req) {
-		dir := req.Origin.(request.Hall).Direction
-		if dir == request.Up {
-			r.HallUp[floor] = req.Status
+	advance := func(v version) version {
+		seen := r.seen[seenKey(req.Origin)]
+		if v.status() == req.Status {
+			if seen > v && seen.status() == req.Status {
+				// The other peers are at the same status in a later cycle
+				return seen
+			}
+			return v
+		}
+		return v.advance(seen, req.Status)
+	}
+
+	switch o := req.Origin.(type) {
+	case request.Hall:
+		if o.Direction == request.Up {
+			r.HallUp[floor] = advance(r.HallUp[floor])
 		} else {
-			r.HallDown[floor] = req.Status
+			r.HallDown[floor] = advance(r.HallDown[floor])
+		}
+	case request.Destination:
+		if !o.IsValid() {
+			log.Printf("[comms] Ignoring invalid destination request %v", o)
+			return
 		}
-	} else {
-		id := req.Origin.(request.Cab).Id
+		r.Destination[o.From][o.To] = advance(r.Destination[o.From][o.To])
+	case request.Cab:
+		id := o.Id
 		idS := strconv.Itoa(int(id))
 
 		// Check is needed because if comms get info about an elevator it has not seen before
@@ -83,29 +167,44 @@ func (r *requestRegistry) update(req request.Request) {
 
 		// Reassign updated slice to map as no direct update is possible in Go
 		cabRequests := r.Cab[idS]
-		cabRequests[floor] = req.Status
+		cabRequests[floor] = advance(cabRequests[floor])
 		r.Cab[idS] = cabRequests
 	}
 }
 
 // diff calculates the difference between two registries
-// and returns a slice of requestMessage where each represents a differing entry
-// If both states are Unconfirmed the entry is also included to enable acknoledgement of the request
+// and returns a slice of requestMessage where each represents an entry that is newer in the other registry
+// If both versions are the same Unconfirmed version the entry is also included to enable acknoledgement of the request
+//
+// The diff is idempotent, as receiving the same registry twice results in the same messages,
+// which the requests module processes without further changes.
 func (r *requestRegistry) diff(peer elevator.Id, other requestRegistry) []message.RequestState {
 	var diff []message.RequestState
 
-	for floor := elevator.Floor(0); floor < elevator.NumFloors; floor++ {
-		if isDifferent(r.HallUp[floor], other.HallUp[floor]) {
-			diff = append(diff, message.RequestState{
-				Source:  peer,
-				Request: request.NewHallRequest(floor, request.Up, other.HallUp[floor]),
-			})
+	compare := func(local, remote version, req request.Request) {
+		if key := seenKey(req.Origin); remote > r.seen[key] {
+			r.seen[key] = remote
 		}
-		if isDifferent(r.HallDown[floor], other.HallDown[floor]) {
-			diff = append(diff, message.RequestState{
-				Source:  peer,
-				Request: request.NewHallRequest(floor, request.Down, other.HallDown[floor]),
-			})
+		if isNewer(local, remote) {
+			diff = append(diff, message.RequestState{Source: peer, Request: req})
+		}
+	}
+
+	for floor := elevator.Floor(0); floor < elevator.NumFloors; floor++ {
+		up, down := versionAt(other.HallUp, floor), versionAt(other.HallDown, floor)
+		compare(r.HallUp[floor], up, request.NewHallRequest(floor, request.Up, up.status()))
+		compare(r.HallDown[floor], down, request.NewHallRequest(floor, request.Down, down.status()))
+	}
+
+	// Peers that do not share destination calls send no matrix at all
+	for from := elevator.Floor(0); from < elevator.NumFloors && int(from) < len(other.Destination); from++ {
+		for to := elevator.Floor(0); to < elevator.NumFloors; to++ {
+			if from == to {
+				// There are no destination calls to the floor the passenger waits on
+				continue
+			}
+			remote := versionAt(other.Destination[from], to)
+			compare(r.Destination[from][to], remote, request.NewDestinationRequest(from, to, remote.status()))
 		}
 	}
 
@@ -113,50 +212,73 @@ func (r *requestRegistry) diff(peer elevator.Id, other requestRegistry) []messag
 		localCab, ok := r.Cab[id]
 		idI, err := strconv.Atoi(id)
 
-		if err != nil {
-			log.Fatalf("[comms] failed to convert stored elevator id string to its uint: %e", err)
+		if err != nil || idI < 0 || idI > math.MaxUint8 {
+			log.Printf("[comms] Ignoring cab requests of the invalid elevator id %q from peer %v", id, peer)
+			continue
 		}
 
 		if !ok {
-			for f := elevator.Floor(0); f < elevator.NumFloors; f++ {
-				if isDifferent(request.Unknown, otherCab[f]) {
-					diff = append(diff, message.RequestState{
-						Source:  peer,
-						Request: request.NewCabRequest(f, elevator.Id(idI), otherCab[f]),
-					})
-				}
-			}
-			continue
+			localCab = make([]version, elevator.NumFloors)
 		}
 
 		for f := elevator.Floor(0); f < elevator.NumFloors; f++ {
-			if isDifferent(localCab[f], otherCab[f]) {
-				diff = append(diff, message.RequestState{
-					Source:  peer,
-					Request: request.NewCabRequest(f, elevator.Id(idI), otherCab[f]),
-				})
-			}
+			remote := versionAt(otherCab, f)
+			compare(localCab[f], remote, request.NewCabRequest(f, elevator.Id(idI), remote.status()))
 		}
 	}
 
 	return diff
 }
 
-// isDifferent checks if two request status are different
-// If both are Unconfirmed the function returns true to enable acknoledgement of the request
-// If the external status is Unkown we ignore it
-func isDifferent(a, b request.Status) bool {
-	if a == request.Unconfirmed && b == request.Unconfirmed {
-		return true
+// versionAt returns the version of the floor, or 0 (Unknown) if a malformed registry of a peer has no entry for it
+func versionAt(versions []version, floor elevator.Floor) version {
+	if floor < 0 || int(floor) >= len(versions) {
+		return 0
 	}
-	if b == request.Unknown {
-		return false
+	return versions[floor]
+}
+
+// requests returns the status of every hall and cab request in the registry,
+// and of every destination request that has been seen
+func (r *requestRegistry) requests() []request.Request {
+	reqs := make([]request.Request, 0)
+	for floor := elevator.Floor(0); floor < elevator.NumFloors; floor++ {
+		reqs = append(reqs, request.NewHallRequest(floor, request.Up, r.HallUp[floor].status()))
+		reqs = append(reqs, request.NewHallRequest(floor, request.Down, r.HallDown[floor].status()))
 	}
-	return a != b
+
+	ids := make([]int, 0, len(r.Cab))
+	for id := range r.Cab {
+		idI, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, idI)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		for floor, v := range r.Cab[strconv.Itoa(id)] {
+			reqs = append(reqs, request.NewCabRequest(elevator.Floor(floor), elevator.Id(id), v.status()))
+		}
+	}
+
+	for from := range r.Destination {
+		for to, v := range r.Destination[from] {
+			if v != 0 {
+				reqs = append(reqs, request.NewDestinationRequest(elevator.Floor(from), elevator.Floor(to), v.status()))
+			}
+		}
+	}
+	return reqs
 }
 
 // String returns a string representation of the request registry
 func (r *requestRegistry) String() string {
-	str := fmt.Sprintf("HallUp: %v, HallDown: %v, Cabs: %v", r.HallUp, r.HallDown, r.Cab)
+	str := fmt.Sprintf("HallUp: %v, HallDown: %v, Cabs: %v, Destinations: %v", r.HallUp, r.HallDown, r.Cab, r.Destination)
 	return str
 }
+
+// String returns the status of the request followed by the version, e.g. C3
+func (v version) String() string {
+	return fmt.Sprintf("%v%d", v.status(), v)
+}
@@ -1,7 +1,10 @@
 package comms
 
 import (
+	"encoding/json"
+	"math/rand"
 	"reflect"
+	"strconv"
 	"testing"
 
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
@@ -18,30 +21,94 @@ func TestRegistryDiff(t *testing.T) {
 		expected []message.RequestState
 	}{
 		{
+			// A stale confirmed request of a peer against an absent local request. The versions cannot tell it
+			// from a request the local peer has not seen yet, so it is passed on. The request manager rejects
+			// the transition from absent to confirmed, see TestRequestManagerStaleConfirmed.
 			name: "Discovered bug 1",
 			internal: requestRegistry{
-				HallUp:   []request.Status{0, 1, 1, 1},
-				HallDown: []request.Status{0, 1, 1, 1},
-				Cab: map[string][]request.Status{
-					"1": []request.Status{0, 1, 1, 0},
-					"2": []request.Status{0, 1, 1, 1},
+				HallUp:   []version{0, 1, 1, 1},
+				HallDown: []version{0, 1, 1, 1},
+				Cab: map[string][]version{
+					"1": []version{0, 1, 1, 0},
+					"2": []version{0, 1, 1, 1},
 				},
 			},
 			external: requestRegistry{
-				HallUp:   []request.Status{0, 3, 1, 1},
-				HallDown: []request.Status{0, 1, 1, 1},
-				Cab: map[string][]request.Status{
-					"1": []request.Status{0, 0, 1, 0},
-					"2": []request.Status{0, 1, 1, 1},
+				HallUp:   []version{0, 3, 1, 1},
+				HallDown: []version{0, 1, 1, 1},
+				Cab: map[string][]version{
+					"1": []version{0, 0, 1, 0},
+					"2": []version{0, 1, 1, 1},
+				},
+			},
+			peer: 2,
+			expected: []message.RequestState{
+				{Source: 2, Request: request.NewHallRequest(1, request.Up, request.Confirmed)},
+			},
+		},
+		{
+			name: "Stale confirmed after served",
+			internal: requestRegistry{
+				HallUp:   []version{0, 4, 1, 1},
+				HallDown: []version{0, 1, 1, 1},
+				Cab: map[string][]version{
+					"1": []version{0, 1, 1, 0},
+					"2": []version{0, 1, 1, 1},
+				},
+			},
+			external: requestRegistry{
+				HallUp:   []version{0, 3, 1, 1},
+				HallDown: []version{0, 1, 1, 1},
+				Cab: map[string][]version{
+					"1": []version{0, 0, 1, 0},
+					"2": []version{0, 1, 1, 1},
 				},
 			},
 			peer:     2,
-			expected: []message.RequestState{},
+			expected: nil,
+		},
+		{
+			name: "Newer version",
+			internal: requestRegistry{
+				HallUp:   []version{0, 1, 1, 1},
+				HallDown: []version{0, 1, 1, 1},
+				Cab:      map[string][]version{},
+			},
+			external: requestRegistry{
+				HallUp:   []version{0, 3, 1, 1},
+				HallDown: []version{0, 1, 1, 2},
+				Cab: map[string][]version{
+					"2": []version{0, 0, 0, 0},
+				},
+			},
+			peer: 2,
+			expected: []message.RequestState{
+				{Source: 2, Request: request.NewHallRequest(1, request.Up, request.Confirmed)},
+				{Source: 2, Request: request.NewHallRequest(3, request.Down, request.Unconfirmed)},
+			},
+		},
+		{
+			name: "Same unconfirmed version",
+			internal: requestRegistry{
+				HallUp:   []version{0, 0, 5, 0},
+				HallDown: []version{0, 0, 0, 0},
+				Cab:      map[string][]version{},
+			},
+			external: requestRegistry{
+				HallUp:   []version{0, 0, 5, 0},
+				HallDown: []version{0, 0, 0, 0},
+				Cab:      map[string][]version{},
+			},
+			peer: 3,
+			expected: []message.RequestState{
+				{Source: 3, Request: request.NewHallRequest(2, request.Up, request.Unconfirmed)},
+			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			tt.internal.seen = make(map[string]version)
 			diff := tt.internal.diff(tt.peer, tt.external)
 			if !reflect.DeepEqual(diff, tt.expected) {
 				t.Errorf("expected %v, got %v", tt.expected, diff)
@@ -49,3 +116,242 @@ func TestRegistryDiff(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistryUpdate(t *testing.T) {
+	hall := request.Hall{Floor: 1, Direction: request.Up}
+
+	r := newRequestRegistry()
+	r.update(request.Request{Origin: hall, Status: request.Unconfirmed})
+	if r.HallUp[1] != 2 {
+		t.Errorf("expected version 2, got %v", r.HallUp[1])
+	}
+
+	// A peer that lags behind jumps to the version of the others on its next transition
+	other := newRequestRegistry()
+	other.HallUp[1] = 7
+	r.diff(2, other)
+	r.update(request.Request{Origin: hall, Status: request.Confirmed})
+	if r.HallUp[1] != 9 {
+		t.Errorf("expected version 9, got %v", r.HallUp[1])
+	}
+
+	// Updating to the current status does not change the version
+	r.update(request.Request{Origin: hall, Status: request.Confirmed})
+	if r.HallUp[1] != 9 {
+		t.Errorf("expected version 9, got %v", r.HallUp[1])
+	}
+}
+
+func TestRegistryRequests(t *testing.T) {
+	r := newRequestRegistry()
+	r.update(request.NewHallRequest(2, request.Down, request.Confirmed))
+	r.update(request.NewCabRequest(1, 3, request.Unconfirmed))
+	r.update(request.NewDestinationRequest(0, 3, request.Unconfirmed))
+
+	status := make(map[request.Origin]request.Status)
+	for _, req := range r.requests() {
+		status[req.Origin] = req.Status
+	}
+
+	expected := map[request.Origin]request.Status{
+		request.Hall{Floor: 2, Direction: request.Down}: request.Confirmed,
+		request.Hall{Floor: 2, Direction: request.Up}:   request.Unknown,
+		request.Cab{Id: 3, Floor: 1}:                    request.Unconfirmed,
+		request.Cab{Id: 3, Floor: 0}:                    request.Unknown,
+		request.Destination{From: 0, To: 3}:             request.Unconfirmed,
+	}
+	for o, s := range expected {
+		if status[o] != s {
+			t.Errorf("expected %v to be %v, got %v", o, s, status[o])
+		}
+	}
+	if _, ok := status[request.Destination{From: 1, To: 2}]; ok {
+		t.Errorf("expected unseen destination requests to be left out")
+	}
+	if len(status) != 2*int(elevator.NumFloors)+int(elevator.NumFloors)+1 {
+		t.Errorf("expected all hall and cab requests and one destination request, got %v requests", len(status))
+	}
+}
+
+// TestRegistryMalformed checks that a malformed registry of a peer is ignored where it has no entries instead of crashing the node
+func TestRegistryMalformed(t *testing.T) {
+	r := newRequestRegistry()
+	other := requestRegistry{
+		HallUp:   []version{0, 2},
+		HallDown: []version{},
+		Cab: map[string][]version{
+			"1":   {3},
+			"abc": {2, 2, 2, 2},
+		},
+		// The rows are shorter than the number of floors, and a destination call to the waiting floor is set
+		Destination: [][]version{{2, 2}, {0}},
+	}
+
+	diff := r.diff(2, other)
+	expected := []message.RequestState{
+		{Source: 2, Request: request.NewHallRequest(1, request.Up, request.Unconfirmed)},
+		{Source: 2, Request: request.NewDestinationRequest(0, 1, request.Unconfirmed)},
+		{Source: 2, Request: request.NewCabRequest(0, 1, request.Confirmed)},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %v, got %v", expected, diff)
+	}
+}
+
+func TestRegistryUpdateInvalidDestination(t *testing.T) {
+	r := newRequestRegistry()
+	r.update(request.NewDestinationRequest(2, 2, request.Unconfirmed))
+	r.update(request.NewDestinationRequest(1, elevator.NumFloors, request.Unconfirmed))
+	r.update(request.NewDestinationRequest(-1, 0, request.Unconfirmed))
+
+	for _, req := range r.requests() {
+		if request.IsDestination(req) {
+			t.Errorf("expected invalid destination requests to be ignored, got %v", req)
+		}
+	}
+}
+
+// TestRegistryConvergence checks that the registries of all peers converge
+// for arbitrary interleavings of transitions and lost, duplicated, stale and reordered packets.
+// The requests module is assumed to accept every newer status.
+func TestRegistryConvergence(t *testing.T) {
+	const numPeers = 3
+	const numRuns = 200
+	const numSteps = 300
+
+	origins := []request.Origin{
+		request.Hall{Floor: 0, Direction: request.Up},
+		request.Hall{Floor: 2, Direction: request.Down},
+		request.Cab{Id: 1, Floor: 3},
+		request.Destination{From: 1, To: 3},
+	}
+
+	for run := 0; run < numRuns; run++ {
+		rng := rand.New(rand.NewSource(int64(run)))
+
+		registries := make([]requestRegistry, numPeers)
+		for i := range registries {
+			registries[i] = newRequestRegistry()
+		}
+		// inFlight contains every packet that has been sent, so that packets can be delivered late or several times
+		inFlight := make([]packet, 0)
+
+		deliver := func(p packet, to int) {
+			before := clone(t, registries[to])
+			for _, msg := range registries[to].diff(p.source, p.registry) {
+				registries[to].update(msg.Request)
+			}
+			assertMonotonic(t, before, registries[to])
+		}
+
+		for step := 0; step < numSteps; step++ {
+			peer := rng.Intn(numPeers)
+			switch rng.Intn(3) {
+			case 0:
+				// A local transition to the next status of the cycle
+				o := origins[rng.Intn(len(origins))]
+				next := request.Absent + request.Status(lookup(registries[peer], o)%cycleLength)
+				registries[peer].update(request.Request{Origin: o, Status: next})
+			case 1:
+				inFlight = append(inFlight, packet{source: elevator.Id(peer), registry: clone(t, registries[peer])})
+			default:
+				if len(inFlight) > 0 {
+					deliver(inFlight[rng.Intn(len(inFlight))], peer)
+				}
+			}
+		}
+
+		// Without packet loss, a few rounds of broadcasts are enough to converge
+		for round := 0; round < 2; round++ {
+			for from := range registries {
+				p := packet{source: elevator.Id(from), registry: clone(t, registries[from])}
+				for to := range registries {
+					if to != from {
+						deliver(p, to)
+					}
+				}
+			}
+		}
+
+		for i := 1; i < numPeers; i++ {
+			for _, o := range origins {
+				if lookup(registries[0], o) != lookup(registries[i], o) {
+					t.Fatalf("run %v: registries did not converge for %v:\n%v\n%v", run, o, &registries[0], &registries[i])
+				}
+			}
+		}
+
+		// Delivering an old packet again does not change a converged registry
+		if len(inFlight) > 0 {
+			before := clone(t, registries[0])
+			deliver(inFlight[rng.Intn(len(inFlight))], 0)
+			for _, o := range origins {
+				if lookup(before, o) != lookup(registries[0], o) {
+					t.Fatalf("run %v: a stale packet changed %v", run, o)
+				}
+			}
+		}
+	}
+}
+
+type packet struct {
+	source   elevator.Id
+	registry requestRegistry
+}
+
+// clone copies the registry the same way it is sent over the network
+func clone(t *testing.T, r requestRegistry) requestRegistry {
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("failed to encode registry: %v", err)
+	}
+	c := requestRegistry{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("failed to decode registry: %v", err)
+	}
+	c.seen = make(map[string]version)
+	for o, v := range r.seen {
+		c.seen[o] = v
+	}
+	return c
+}
+
+func lookup(r requestRegistry, o request.Origin) version {
+	switch o := o.(type) {
+	case request.Hall:
+		if o.Direction == request.Up {
+			return r.HallUp[o.Floor]
+		}
+		return r.HallDown[o.Floor]
+	case request.Destination:
+		return r.Destination[o.From][o.To]
+	case request.Cab:
+		cab, ok := r.Cab[strconv.Itoa(int(o.Id))]
+		if !ok {
+			return 0
+		}
+		return cab[o.Floor]
+	}
+	return 0
+}
+
+func assertMonotonic(t *testing.T, before, after requestRegistry) {
+	t.Helper()
+	for f := elevator.Floor(0); f < elevator.NumFloors; f++ {
+		if after.HallUp[f] < before.HallUp[f] || after.HallDown[f] < before.HallDown[f] {
+			t.Fatalf("hall version decreased:\n%v\n%v", &before, &after)
+		}
+		for to := elevator.Floor(0); to < elevator.NumFloors; to++ {
+			if after.Destination[f][to] < before.Destination[f][to] {
+				t.Fatalf("destination version decreased:\n%v\n%v", &before, &after)
+			}
+		}
+	}
+	for id, cab := range before.Cab {
+		for f := range cab {
+			if after.Cab[id][f] < cab[f] {
+				t.Fatalf("cab version decreased:\n%v\n%v", &before, &after)
+			}
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package driver
 
 import (
+	"context"
 	"log"
 	"time"
 
+	"group48.ttk4145.ntnu/elevators/internal/audit"
 	"group48.ttk4145.ntnu/elevators/internal/elevatorio"
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
@@ -11,89 +13,270 @@ import (
 )
 
 // Global variables
-var doorTimerDuration = 3
+var doorNudgeTimerDuration = 6
 var engineTimerDuration = 10
 var elevatorStatePollRate = time.Millisecond * 1000
 
-func RunDriver(pollObstructionSwitch <-chan message.Obstruction,
+// shutdownTimeout bounds the time the elevator searches for the next floor when shutting down
+var shutdownTimeout = time.Millisecond * 5000
+
+// initProbe is the time the elevator searches for a floor in the first direction at startup, see floorSearch
+var initProbe = time.Millisecond * 500
+
+// initMaxReach bounds how far the elevator moves away from its starting position when searching for a floor
+var initMaxReach = time.Millisecond * 4000
+
+func RunDriver(ctx context.Context,
+	pollObstructionSwitch <-chan message.Obstruction,
 	pollFloorSensor <-chan message.FloorArrival,
 	pollOrders <-chan message.ServiceOrder,
+	pollDoorNudge <-chan message.DoorNudge,
+	pollSensorFault <-chan message.FloorSensorFault,
 	toRequests chan<- message.RequestState,
 	toComms chan<- message.ElevatorState,
 	toOrders chan<- message.ElevatorState,
 	toEngineMonitor chan<- message.ElevatorState,
+	toDoorMonitor chan<- message.ElevatorState,
+	toFloorMonitor chan<- message.ElevatorState,
+	toProcessPair chan<- message.ElevatorState,
+	toHealthMonitor chan<- message.PeerSignal,
+	restoredState elevator.State,
+	restoredOrder elevator.Order,
+	auditLog *audit.Logger,
 	local elevator.Id) {
 
 	// Init state, obstruction and timer
+	// A restored elevator searches for a floor in the direction it moved before the crash
 	state := elevator.State{
-		Floor:     0,
-		Behavior:  elevator.Idle,
-		Direction: elevator.Stop}
-	order := elevator.Order{}
-	driveToStaringPosition()
+		Floor:     restoredState.Floor,
+		Behavior:  elevator.Initializing,
+		Direction: elevator.Down}
+	if restoredState.Direction != elevator.Stop {
+		state.Direction = restoredState.Direction
+	}
+	order := restoredOrder
+	destinations := make([]request.Destination, 0)
+	timerInit := time.NewTimer(initProbe)
+	search := newFloorSearch()
+	startInitialization(&state, timerInit)
+	if state.Behavior != elevator.Initializing {
+		auditLog.Floor(audit.KindInitialized, state.Floor)
+	}
 
 	receiverStartDoorTimer := make(chan bool, 10)
-	timerDoor := time.NewTimer((time.Duration(doorTimerDuration)) * time.Second)
+	timerDoor := time.NewTimer(elevator.DoorOpenDuration)
 	timerDoor.Stop()
 	tickerSendElevatorState := time.NewTicker(elevatorStatePollRate)
 	isObstructed := false
+	isNudging := false
+	isHalted := false
 
 	clearRequestFun := func(btn elevator.ButtonType, floor elevator.Floor) {
-		clearRequest(local, btn, floor, toRequests)
+		clearRequest(ctx, local, btn, floor, toRequests, auditLog)
+		boardDestinations(ctx, local, btn, floor, &destinations, toRequests)
 	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			shutdown(state)
+			return
+
 		case msg := <-pollOrders:
+			auditLog.Order(msg.Order, msg.Destinations)
 			order = msg.Order
+			destinations = msg.Destinations
 			log.Printf("[elevatordriver] Received new orders:\n\t%v", elevator.OrderToString(order))
+			if isHalted || state.Behavior == elevator.Initializing {
+				continue
+			}
 			fsmHandleOrderEvent(&state, order, receiverStartDoorTimer, clearRequestFun)
 
 		case msg := <-pollFloorSensor:
 			log.Printf("[elevatordriver] Received floor sensor: %v", msg)
+			auditLog.Floor(audit.KindFloor, msg.Floor)
+			if isHalted {
+				continue
+			}
+			if state.Behavior == elevator.Initializing {
+				finishInitialization(&state, timerInit, msg.Floor)
+				fsmHandleOrderEvent(&state, order, receiverStartDoorTimer, clearRequestFun)
+				continue
+			}
 			fsmHandleFloorsensorEvent(&state, order, receiverStartDoorTimer, clearRequestFun, msg.Floor)
 
 		case <-pollObstructionSwitch:
 			log.Printf("[elevatordriver] Received obstruction message")
 			isObstructed = !isObstructed
-			if state.Behavior == elevator.DoorOpen {
-				timerDoor.Reset(time.Duration(doorTimerDuration) * time.Second)
+			if state.Behavior == elevator.DoorOpen && !isNudging {
+				timerDoor.Reset(elevator.DoorOpenDuration)
+			}
+
+		case msg := <-pollDoorNudge:
+			isNudging = msg.Active
+			if isNudging && state.Behavior == elevator.DoorOpen {
+				// The door closes slowly while nudging, regardless of the obstruction
+				log.Printf("[elevatordriver] Nudging the door closed")
+				timerDoor.Reset(time.Duration(doorNudgeTimerDuration) * time.Second)
 			}
 
+		case <-pollSensorFault:
+			// The floor sensor can not be trusted, so the elevator stays where it is.
+			// An open door stays open until the door timer closes it.
+			log.Printf("[elevatordriver] Halting the elevator due to a floor sensor fault")
+			auditLog.Event(audit.KindHalt)
+			isHalted = true
+			elevatorio.SetMotorDirection(elevator.Stop)
+			timerInit.Stop()
+			if state.Behavior == elevator.Moving || state.Behavior == elevator.Initializing {
+				state.Behavior = elevator.Idle
+			}
+			state.Direction = elevator.Stop
+
+		case <-timerInit.C:
+			if state.Behavior != elevator.Initializing || isHalted {
+				break
+			}
+			// No floor was found within the reach, so the elevator searches further away in the other direction.
+			leg, ok := search.turn()
+			if !ok {
+				// The elevator passed the maximum reach in both directions without the floor sensor reporting a floor.
+				// As its position is unknown, it stays where it is like after a floor sensor fault.
+				log.Printf("[elevatordriver] No floor found in either direction. Halting the elevator")
+				auditLog.Event(audit.KindHalt)
+				isHalted = true
+				elevatorio.SetMotorDirection(elevator.Stop)
+				state.Behavior = elevator.Idle
+				state.Direction = elevator.Stop
+				select {
+				case toHealthMonitor <- message.PeerSignal{Id: local, Alive: false, Health: elevator.SensorFault}:
+				case <-ctx.Done():
+				}
+				break
+			}
+			state.Direction = -state.Direction
+			log.Printf("[elevatordriver] No floor found. Searching %v for %v", state.Direction, leg)
+			elevatorio.SetMotorDirection(state.Direction)
+			timerInit.Reset(leg)
+
 		case <-receiverStartDoorTimer:
 			log.Printf("[elevatordriver] Received open door message")
-			timerDoor.Reset(time.Duration(doorTimerDuration) * time.Second)
+			timerDoor.Reset(elevator.DoorOpenDuration)
 
 		case <-timerDoor.C:
-			if state.Behavior == elevator.DoorOpen && !isObstructed {
+			if state.Behavior == elevator.DoorOpen && (!isObstructed || isNudging) {
 				log.Printf("[elevatordriver] Received door closed message")
+				auditLog.Event(audit.KindDoorClosed)
+				if isHalted {
+					// The halted elevator closes the door, but does not move on
+					elevatorio.SetDoorOpenLamp(false)
+					state.Behavior = elevator.Idle
+					continue
+				}
 				fsmHandleDoorTimerEvent(&state, order, receiverStartDoorTimer, clearRequestFun)
 			} else {
 				log.Printf("[elevatordriver] Received door closed message")
-				timerDoor.Reset(time.Duration(doorTimerDuration) * time.Second)
+				timerDoor.Reset(elevator.DoorOpenDuration)
 			}
 		case <-tickerSendElevatorState.C:
 			m := message.ElevatorState{Elevator: local, State: state}
-			toComms <- m
-			toOrders <- m
-			toEngineMonitor <- m
+			for _, c := range []chan<- message.ElevatorState{toComms, toOrders, toEngineMonitor, toDoorMonitor, toFloorMonitor, toProcessPair} {
+				select {
+				case c <- m:
+				case <-ctx.Done():
+					shutdown(state)
+					return
+				}
+			}
 		}
 
 	}
 }
 
-func driveToStaringPosition() {
+// shutdown stops the elevator at the next floor and turns off all lamps
+//
+// The floor sensor is read directly, as the polling of the elevator IO stops on shutdown as well.
+func shutdown(state elevator.State) {
+	if state.Behavior == elevator.Moving || state.Behavior == elevator.Initializing {
+		log.Printf("[elevatordriver] Shutting down. Stopping at the next floor")
+		deadline := time.Now().Add(shutdownTimeout)
+		for elevatorio.GetFloor() == -1 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 20)
+		}
+	}
+	elevatorio.SetMotorDirection(elevator.Stop)
 
-	if floor := elevatorio.GetFloor(); floor != 0 {
-		for elevatorio.GetFloor() != 0 {
-			time.Sleep(time.Millisecond * 100)
-			elevatorio.SetMotorDirection(elevator.Down)
+	for f := elevator.Floor(0); f < elevator.NumFloors; f++ {
+		for b := elevator.ButtonType(0); b < 3; b++ {
+			elevatorio.SetButtonLamp(b, f, false)
 		}
-		elevatorio.SetMotorDirection(0)
 	}
+	elevatorio.SetDoorOpenLamp(false)
+	elevatorio.SetStopLamp(false)
+	log.Printf("[elevatordriver] Shut down at floor %v", elevatorio.GetFloor())
 }
 
-func clearRequest(id elevator.Id, btn elevator.ButtonType, floor elevator.Floor, c chan<- message.RequestState) {
+// startInitialization finds the floor of the elevator at startup
+//
+// If the elevator is at a floor, it is ready immediately.
+// Otherwise, it starts the floor search in the direction of the state, see floorSearch.
+// The floor is reported by the floor sensor.
+func startInitialization(state *elevator.State, timerInit *time.Timer) {
+	if floor := elevatorio.GetFloor(); floor != -1 {
+		finishInitialization(state, timerInit, elevator.Floor(floor))
+		return
+	}
+
+	log.Printf("[elevatordriver] Starting between floors. Searching %v", state.Direction)
+	elevatorio.SetMotorDirection(state.Direction)
+}
+
+// floorSearch finds a floor in either direction when the elevator starts between floors
+//
+// The elevator probes in one direction first and turns every time the timer expires.
+// Every turn doubles the distance from the starting position that is searched on the other side,
+// until the distance reaches initMaxReach. Thus, the elevator reaches a floor after at most about nine times
+// the travel time to the nearest floor, whichever direction it lies in. If both floors are about equally far away,
+// it may stop at the one that is slightly further away. The search ends when the elevator reached
+// initMaxReach on both sides without finding a floor.
+type floorSearch struct {
+	// reach is the time the elevator travelled away from the starting position on the current side
+	reach time.Duration
+	// exhausted is the number of sides that were searched up to initMaxReach
+	exhausted int
+}
+
+func newFloorSearch() *floorSearch {
+	return &floorSearch{reach: initProbe}
+}
+
+// turn returns the time of the next leg in the other direction, which leads back past the starting position
+// and twice as far out on the other side. It returns false if both sides were searched up to initMaxReach.
+func (s *floorSearch) turn() (time.Duration, bool) {
+	if s.reach == initMaxReach {
+		s.exhausted++
+	}
+	if s.exhausted == 2 {
+		return 0, false
+	}
+	back := s.reach
+	s.reach = min(2*s.reach, initMaxReach)
+	return back + s.reach, true
+}
+
+// finishInitialization stops the elevator at the found floor and makes it ready for orders
+func finishInitialization(state *elevator.State, timerInit *time.Timer, floor elevator.Floor) {
+	timerInit.Stop()
+	elevatorio.SetMotorDirection(elevator.Stop)
+	elevatorio.SetFloorIndicator(floor)
+	state.Floor = floor
+	state.Behavior = elevator.Idle
+	state.Direction = elevator.Stop
+	log.Printf("[elevatordriver] Initialized at floor %v", floor)
+}
+
+// clearRequest sends the request as absent to the requests module and records it in the audit log
+func clearRequest(ctx context.Context, id elevator.Id, btn elevator.ButtonType, floor elevator.Floor, c chan<- message.RequestState, auditLog *audit.Logger) {
 
 	log.Printf("[elevatordriver] Cleared request at floor %v, button %v", floor, btn)
 	var req request.Request
@@ -109,5 +292,37 @@ func clearRequest(id elevator.Id, btn elevator.ButtonType, floor elevator.Floor,
 		Source:  id,
 		Request: req,
 	}
-	c <- msg
+	select {
+	case c <- msg:
+	case <-ctx.Done():
+		return
+	}
+	auditLog.Clear(req.Origin)
+}
+
+// boardDestinations lets the passengers of destination calls board when their pickup is cleared
+//
+// The destination call is resolved and replaced by a cab request to the destination floor,
+// as the passenger is now inside the local elevator.
+func boardDestinations(ctx context.Context, id elevator.Id, btn elevator.ButtonType, floor elevator.Floor, destinations *[]request.Destination, c chan<- message.RequestState) {
+	remaining := make([]request.Destination, 0, len(*destinations))
+	for _, d := range *destinations {
+		if d.From != floor || d.GetButtonType() != btn {
+			remaining = append(remaining, d)
+			continue
+		}
+
+		log.Printf("[elevatordriver] Passenger of %v boarded", d)
+		for _, req := range []request.Request{
+			request.NewDestinationRequest(d.From, d.To, request.Absent),
+			request.NewCabRequest(d.To, id, request.Unconfirmed),
+		} {
+			select {
+			case c <- message.RequestState{Source: id, Request: req}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	*destinations = remaining
 }
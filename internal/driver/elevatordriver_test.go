@@ -0,0 +1,89 @@
+package driver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/elevatorio"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+// TestFloorSearch checks that the search alternates around the starting position with a doubling reach
+func TestFloorSearch(t *testing.T) {
+	s := newFloorSearch()
+
+	// The position is measured in travel time from the starting position, the first probe goes to +initProbe
+	position := initProbe
+	direction := time.Duration(1)
+	expected := []time.Duration{-2 * initProbe, 4 * initProbe, -8 * initProbe, initMaxReach}
+	for i, e := range expected {
+		direction = -direction
+		leg, ok := s.turn()
+		if !ok {
+			t.Fatalf("expected the search to go on after turn %d", i+1)
+		}
+		position += direction * leg
+		if position != e {
+			t.Fatalf("expected the elevator at %v after turn %d, got %v", e, i+1, position)
+		}
+	}
+
+	// Both sides were searched up to the maximum reach
+	if _, ok := s.turn(); ok {
+		t.Fatalf("expected the search to end after reaching %v on both sides", initMaxReach)
+	}
+}
+
+// TestFloorSearchNoFloor checks that the driver stops the motor and reports a sensor fault
+// if the floor sensor never reports a floor during the search
+func TestFloorSearchNoFloor(t *testing.T) {
+	defer func(probe, reach time.Duration) { initProbe, initMaxReach = probe, reach }(initProbe, initMaxReach)
+	initProbe = 20 * time.Millisecond
+	initMaxReach = 80 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := simulator.DefaultConfig()
+	config.TravelTime = time.Second
+	config.SensorWidth = -1 // The floor sensor never reports a floor
+	sim := simulator.New(config)
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go sim.Serve(ctx, listener)
+	elevatorio.Init(listener.Addr().String(), 1)
+
+	toHealthMonitor := make(chan message.PeerSignal, 10)
+	states := func() chan message.ElevatorState { return make(chan message.ElevatorState, 100) }
+	go RunDriver(ctx,
+		make(chan message.Obstruction), make(chan message.FloorArrival), make(chan message.ServiceOrder),
+		make(chan message.DoorNudge), make(chan message.FloorSensorFault),
+		make(chan message.RequestState, 100),
+		states(), states(), states(), states(), states(), states(),
+		toHealthMonitor,
+		elevator.State{}, elevator.Order{}, nil, 1)
+
+	select {
+	case msg := <-toHealthMonitor:
+		if msg.Alive || msg.Health != elevator.SensorFault {
+			t.Fatalf("expected a sensor fault, got %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected a fault to be reported when no floor is found")
+	}
+
+	// The simulator handles the motor command asynchronously
+	deadline := time.Now().Add(time.Second)
+	for sim.Snapshot().Direction != elevator.Stop {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the motor to be stopped, got %v", sim.Snapshot().Direction)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
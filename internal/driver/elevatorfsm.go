@@ -7,8 +7,6 @@ import (
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 )
 
-const EverybodyGoesOn bool = false
-
 type resolvedRequests func(btn elevator.ButtonType, floor elevator.Floor)
 
 // fsmHandleOrderEvent updates the elevator state based on new orders
@@ -35,7 +33,7 @@ func fsmHandleOrderEvent(state *elevator.State, orders elevator.Order, recieverD
 func fsmHandleFloorsensorEvent(state *elevator.State, orders elevator.Order, recieverDoorTimer chan<- bool, rr resolvedRequests, floor elevator.Floor) {
 	state.Floor = floor
 	elevatorio.SetFloorIndicator(floor)
-	if state.Behavior == elevator.Moving && ordersElevatorShouldStop(*state, orders) {
+	if state.Behavior == elevator.Moving && elevator.ShouldStop(*state, orders) {
 		elevatorio.SetMotorDirection((0))
 		fsmOpenDoor(state)
 		recieverDoorTimer <- true
@@ -64,53 +62,13 @@ func fsmOpenDoor(state *elevator.State) {
 	state.Behavior = elevator.DoorOpen
 }
 
-// fsmChooseDirection updates the elevator direction and behaviour based on the current orders. Inspired by the given C-code.
+// fsmChooseDirection updates the elevator direction and behaviour based on the current orders, see [elevator.ChooseDirection]
 func fsmChooseDirection(e *elevator.State, orders elevator.Order) {
-	switch e.Direction {
-	case elevator.Up:
-		if ordersAbove(*e, orders) {
-			e.Direction = elevator.Up
-			e.Behavior = elevator.Moving
-		} else if ordersHere(*e, orders) {
-			e.Direction = elevator.Stop
-			fsmOpenDoor(e)
-
-		} else if ordersBelow(*e, orders) {
-			e.Direction = elevator.Down
-			e.Behavior = elevator.Moving
-		} else {
-			e.Direction = elevator.Stop
-			e.Behavior = elevator.Idle
-		}
-
-	case elevator.Down:
-		if ordersBelow(*e, orders) {
-			e.Direction = elevator.Down
-			e.Behavior = elevator.Moving
-		} else if ordersHere(*e, orders) {
-			e.Direction = elevator.Stop
-			fsmOpenDoor(e)
-		} else if ordersAbove(*e, orders) {
-			e.Direction = elevator.Up
-			e.Behavior = elevator.Moving
-		} else {
-			e.Direction = elevator.Stop
-			e.Behavior = elevator.Idle
-		}
-
-	case elevator.Stop:
-		if ordersHere(*e, orders) {
-			e.Direction = elevator.Stop
-			fsmOpenDoor(e)
-		} else if ordersAbove(*e, orders) {
-			e.Direction = elevator.Up
-			e.Behavior = elevator.Moving
-		} else if ordersBelow(*e, orders) {
-			e.Direction = elevator.Down
-			e.Behavior = elevator.Moving
-		} else {
-			e.Direction = elevator.Stop
-			e.Behavior = elevator.Idle
-		}
+	direction, behavior := elevator.ChooseDirection(*e, orders)
+	e.Direction = direction
+	if behavior == elevator.DoorOpen {
+		fsmOpenDoor(e)
+	} else {
+		e.Behavior = behavior
 	}
 }
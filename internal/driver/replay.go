@@ -0,0 +1,120 @@
+package driver
+
+import (
+	"context"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/audit"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// Replayer reproduces the decisions of the driver from the recorded events of an audit log.
+//
+// It handles the events the same way as RunDriver, but without channels and timers.
+// The elevator IO is not connected during a replay, so the FSM does not move any hardware.
+// The cleared requests are written to the audit log.
+type Replayer struct {
+	local        elevator.Id
+	state        elevator.State
+	order        elevator.Order
+	destinations []request.Destination
+	isHalted     bool
+	auditLog     *audit.Logger
+
+	timerInit *time.Timer
+	// doorTimer and toRequests collect the outputs of the FSM, which are drained after every event
+	doorTimer  chan bool
+	toRequests chan message.RequestState
+}
+
+// NewReplayer creates a replayer that starts like a freshly started driver searching for a floor
+func NewReplayer(local elevator.Id, auditLog *audit.Logger) *Replayer {
+	timerInit := time.NewTimer(initProbe)
+	timerInit.Stop()
+	return &Replayer{
+		local:        local,
+		state:        elevator.State{Behavior: elevator.Initializing, Direction: elevator.Down},
+		destinations: make([]request.Destination, 0),
+		auditLog:     auditLog,
+		timerInit:    timerInit,
+		doorTimer:    make(chan bool, 64),
+		toRequests:   make(chan message.RequestState, 64),
+	}
+}
+
+// State returns the replayed state of the elevator
+func (r *Replayer) State() elevator.State {
+	return r.state
+}
+
+// Initialized handles the driver starting at a floor
+func (r *Replayer) Initialized(floor elevator.Floor) {
+	finishInitialization(&r.state, r.timerInit, floor)
+}
+
+// Order handles a new order and returns the messages sent to the requests module
+func (r *Replayer) Order(msg message.ServiceOrder) []message.RequestState {
+	r.order = msg.Order
+	r.destinations = msg.Destinations
+	if !r.isHalted && r.state.Behavior != elevator.Initializing {
+		fsmHandleOrderEvent(&r.state, r.order, r.doorTimer, r.clear)
+	}
+	return r.drain()
+}
+
+// Floor handles a floor arrival and returns the messages sent to the requests module
+func (r *Replayer) Floor(floor elevator.Floor) []message.RequestState {
+	if r.isHalted {
+		return r.drain()
+	}
+	if r.state.Behavior == elevator.Initializing {
+		finishInitialization(&r.state, r.timerInit, floor)
+		fsmHandleOrderEvent(&r.state, r.order, r.doorTimer, r.clear)
+		return r.drain()
+	}
+	fsmHandleFloorsensorEvent(&r.state, r.order, r.doorTimer, r.clear, floor)
+	return r.drain()
+}
+
+// DoorClosed handles the door timer closing the door and returns the messages sent to the requests module
+func (r *Replayer) DoorClosed() []message.RequestState {
+	if r.state.Behavior != elevator.DoorOpen {
+		return r.drain()
+	}
+	if r.isHalted {
+		r.state.Behavior = elevator.Idle
+		return r.drain()
+	}
+	fsmHandleDoorTimerEvent(&r.state, r.order, r.doorTimer, r.clear)
+	return r.drain()
+}
+
+// Halt handles a floor sensor fault
+func (r *Replayer) Halt() {
+	r.isHalted = true
+	if r.state.Behavior == elevator.Moving || r.state.Behavior == elevator.Initializing {
+		r.state.Behavior = elevator.Idle
+	}
+	r.state.Direction = elevator.Stop
+}
+
+func (r *Replayer) clear(btn elevator.ButtonType, floor elevator.Floor) {
+	clearRequest(context.Background(), r.local, btn, floor, r.toRequests, r.auditLog)
+	boardDestinations(context.Background(), r.local, btn, floor, &r.destinations, r.toRequests)
+}
+
+// drain empties the outputs of the FSM and returns the messages sent to the requests module
+func (r *Replayer) drain() []message.RequestState {
+	msgs := make([]message.RequestState, 0)
+	for {
+		select {
+		case <-r.doorTimer:
+		case msg := <-r.toRequests:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
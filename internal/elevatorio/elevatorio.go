@@ -1,6 +1,7 @@
 package elevatorio
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -14,11 +15,19 @@ import (
 
 const _pollRate = 20 * time.Millisecond
 
+// _doublePressInterval is the longest time between two presses of a cab button that cancel the cab call
+const _doublePressInterval = 500 * time.Millisecond
+
+// _reconnectRate is the rate at which a lost connection to the elevator server is redialed
+const _reconnectRate = 1 * time.Second
+
 var _initialized bool = false
 var _numFloors int = int(elevator.NumFloors)
 var _mtx sync.Mutex
 var _conn net.Conn
 var _local elevator.Id
+var _addr string
+var _connected bool
 
 func Init(addr string, local elevator.Id) {
 	if _initialized {
@@ -32,11 +41,13 @@ func Init(addr string, local elevator.Id) {
 		panic(err.Error())
 	}
 	_local = local
+	_addr = addr
+	_connected = true
 	_initialized = true
 }
 
 func SetMotorDirection(dir elevator.MotorDirection) {
-	write([4]byte{1, byte(dir), 0, 0})
+	write([4]byte{1, byte(faultyDirection(dir)), 0, 0})
 }
 
 func SetButtonLamp(btn elevator.ButtonType, floor elevator.Floor, value bool) {
@@ -55,10 +66,18 @@ func SetStopLamp(value bool) {
 	write([4]byte{5, toByte(value), 0, 0})
 }
 
-func PollNewRequests(receiver chan<- message.RequestState) {
+// PollNewRequests sends an unconfirmed request for every button press
+//
+// A double press of a cab button cancels the cab call by sending it as absent,
+// so that it is cleared through the requests module like a served call.
+// If the cab call is not confirmed yet, the requests module cancels it once it is confirmed.
+func PollNewRequests(ctx context.Context, receiver chan<- message.RequestState) {
 	prev := make([][3]bool, _numFloors)
+	lastCabPress := make([]time.Time, _numFloors)
 	for {
-		time.Sleep(_pollRate)
+		if !wait(ctx, _pollRate) {
+			return
+		}
 		for f := 0; f < _numFloors; f++ {
 			for b := elevator.ButtonType(0); b < 3; b++ {
 				wasPressed := GetButton(b, f)
@@ -73,8 +92,19 @@ func PollNewRequests(receiver chan<- message.RequestState) {
 						req = request.NewHallRequest(elevator.Floor(f), request.Down, request.Unconfirmed)
 					case elevator.Cab:
 						req = request.NewCabRequest(elevator.Floor(f), _local, request.Unconfirmed)
+						if time.Since(lastCabPress[f]) < _doublePressInterval {
+							log.Printf("[elevatorio] Cab button at floor %v pressed twice, cancelling the cab call", f)
+							req.Status = request.Absent
+							lastCabPress[f] = time.Time{}
+						} else {
+							lastCabPress[f] = time.Now()
+						}
+					}
+					select {
+					case receiver <- message.RequestState{Source: _local, Request: req}:
+					case <-ctx.Done():
+						return
 					}
-					receiver <- message.RequestState{Source: _local, Request: req}
 				}
 				prev[f][b] = wasPressed
 			}
@@ -82,48 +112,119 @@ func PollNewRequests(receiver chan<- message.RequestState) {
 	}
 }
 
-func PollFloorSensor(receiver chan<- message.FloorArrival) {
+func PollFloorSensor(ctx context.Context, receiver chan<- message.FloorArrival) {
 	prev := -1
 	for {
-		time.Sleep(_pollRate)
+		if !wait(ctx, _pollRate) {
+			return
+		}
 		v := GetFloor()
 		if v != prev && v != -1 {
-			receiver <- message.FloorArrival{Floor: elevator.Floor(v)}
+			select {
+			case receiver <- message.FloorArrival{Floor: elevator.Floor(v)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		prev = v
+	}
+}
+
+// PollFloorSensorReadings sends every change of the floor sensor, including leaving a floor
+func PollFloorSensorReadings(ctx context.Context, receiver chan<- message.FloorSensorReading) {
+	prev := -1
+	for {
+		if !wait(ctx, _pollRate) {
+			return
+		}
+		v := GetFloor()
+		if v != prev {
+			select {
+			case receiver <- message.FloorSensorReading{Floor: elevator.Floor(v), AtFloor: v != -1}:
+			case <-ctx.Done():
+				return
+			}
 		}
 		prev = v
 	}
 }
 
-func PollStopButton(receiver chan<- bool) {
+func PollStopButton(ctx context.Context, receiver chan<- bool) {
 	prev := false
 	for {
-		time.Sleep(_pollRate)
+		if !wait(ctx, _pollRate) {
+			return
+		}
 		v := GetStop()
 		if v != prev {
-			receiver <- v
+			select {
+			case receiver <- v:
+			case <-ctx.Done():
+				return
+			}
 		}
 		prev = v
 	}
 }
 
-func PollObstructionSwitch(receiver chan<- message.Obstruction) {
+func PollObstructionSwitch(ctx context.Context, receiver chan<- message.Obstruction) {
 	prev := false
 	for {
-		time.Sleep(_pollRate)
+		if !wait(ctx, _pollRate) {
+			return
+		}
 		v := GetObstruction()
 		if v != prev {
-			receiver <- message.Obstruction{}
+			select {
+			case receiver <- message.Obstruction{}:
+			case <-ctx.Done():
+				return
+			}
 		}
 		prev = v
 	}
 }
 
+// PollConnection reports the connection to the elevator server to the health monitor
+//
+// While the connection is lost, all reads return zero values and all writes are dropped.
+// The connection is redialed periodically and the fault is cleared once it is restored.
+func PollConnection(ctx context.Context, receiver chan<- message.PeerSignal) {
+	wasConnected := true
+	for {
+		if !wait(ctx, _reconnectRate) {
+			return
+		}
+
+		_mtx.Lock()
+		if !_connected {
+			reconnect()
+		}
+		isConnected := _connected
+		_mtx.Unlock()
+
+		if isConnected != wasConnected {
+			select {
+			case receiver <- message.PeerSignal{Id: _local, Alive: isConnected, Health: elevator.IoDisconnected}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		wasConnected = isConnected
+	}
+}
+
 func GetButton(button elevator.ButtonType, floor int) (isPressed bool) {
 	a := read([4]byte{6, byte(button), byte(floor), 0})
 	return toBool(a[1])
 }
 
 func GetFloor() int {
+	return faultyFloor(readFloor())
+}
+
+// readFloor returns the reading of the floor sensor without the injected faults
+func readFloor() int {
 	a := read([4]byte{7, 0, 0, 0})
 	if a[1] != 0 {
 		return int(a[2])
@@ -139,22 +240,28 @@ func GetStop() bool {
 
 func GetObstruction() bool {
 	a := read([4]byte{9, 0, 0, 0})
-	return toBool(a[1])
+	return faultyObstruction(toBool(a[1]))
 }
 
 func read(in [4]byte) [4]byte {
 	_mtx.Lock()
 	defer _mtx.Unlock()
 
+	var out [4]byte
+	if !_connected {
+		return out
+	}
+
 	_, err := _conn.Write(in[:])
 	if err != nil {
-		panic("Lost connection to Elevator Server")
+		disconnect(err)
+		return out
 	}
 
-	var out [4]byte
 	_, err = _conn.Read(out[:])
 	if err != nil {
-		panic("Lost connection to Elevator Server")
+		disconnect(err)
+		return [4]byte{}
 	}
 
 	return out
@@ -164,9 +271,41 @@ func write(in [4]byte) {
 	_mtx.Lock()
 	defer _mtx.Unlock()
 
+	if !_connected {
+		return
+	}
+
 	_, err := _conn.Write(in[:])
 	if err != nil {
-		panic("Lost connection to Elevator Server")
+		disconnect(err)
+	}
+}
+
+// disconnect marks the connection as lost. The mutex must be held by the caller.
+func disconnect(err error) {
+	log.Printf("[elevatorio] Lost connection to Elevator Server: %v", err)
+	_conn.Close()
+	_connected = false
+}
+
+// reconnect tries to redial the elevator server. The mutex must be held by the caller.
+func reconnect() {
+	conn, err := net.Dial("tcp", _addr)
+	if err != nil {
+		return
+	}
+	log.Printf("[elevatorio] Reconnected to Elevator Server at %v", _addr)
+	_conn = conn
+	_connected = true
+}
+
+// wait sleeps for the duration and returns false if the context is done before
+func wait(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
 	}
 }
 
@@ -0,0 +1,100 @@
+package elevatorio
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// The injected faults are guarded by their own mutex, as the readings are faulted after the connection mutex is released
+var _faultMtx sync.Mutex
+var _faults message.IoFaults
+
+// _stuckFloor is the reading the floor sensor is frozen at while it is stuck
+var _stuckFloor int
+
+// _flapStart is the time the obstruction switch started flapping
+var _flapStart time.Time
+
+// _direction is the last direction set by the elevator, which a stalled motor resumes once it is released
+var _direction elevator.MotorDirection
+
+// InjectFaults applies the injected faults of the elevator hardware until the context is done
+//
+// A stuck floor sensor keeps the reading it had when the fault was injected.
+// A stalled motor is stopped and ignores the directions set by the elevator until it is released,
+// when it resumes the last direction set. A flapping obstruction switch is toggled on and off with the given period,
+// starting obstructed, in addition to the real switch.
+func InjectFaults(ctx context.Context, faults <-chan message.IoFaults) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-faults:
+			applyFaults(f)
+		}
+	}
+}
+
+func applyFaults(f message.IoFaults) {
+	floor := readFloor()
+
+	_faultMtx.Lock()
+	prev := _faults
+	if f.StuckFloorSensor && !prev.StuckFloorSensor {
+		_stuckFloor = floor
+	}
+	if f.ObstructionFlap != prev.ObstructionFlap {
+		_flapStart = time.Now()
+	}
+	_faults = f
+	direction := _direction
+	stuckFloor := _stuckFloor
+	_faultMtx.Unlock()
+
+	log.Printf("[elevatorio] Injected faults: stuck floor sensor %v (at %v), stalled motor %v, obstruction flap %v",
+		f.StuckFloorSensor, stuckFloor, f.StalledMotor, f.ObstructionFlap)
+
+	switch {
+	case f.StalledMotor && !prev.StalledMotor:
+		write([4]byte{1, byte(elevator.Stop), 0, 0})
+	case !f.StalledMotor && prev.StalledMotor:
+		write([4]byte{1, byte(direction), 0, 0})
+	}
+}
+
+// faultyDirection records the direction set by the elevator and returns the direction the motor actually gets
+func faultyDirection(dir elevator.MotorDirection) elevator.MotorDirection {
+	_faultMtx.Lock()
+	defer _faultMtx.Unlock()
+	_direction = dir
+	if _faults.StalledMotor {
+		return elevator.Stop
+	}
+	return dir
+}
+
+// faultyFloor returns the floor sensor reading with the injected faults
+func faultyFloor(floor int) int {
+	_faultMtx.Lock()
+	defer _faultMtx.Unlock()
+	if _faults.StuckFloorSensor {
+		return _stuckFloor
+	}
+	return floor
+}
+
+// faultyObstruction returns the obstruction switch reading with the injected faults
+func faultyObstruction(isObstructed bool) bool {
+	_faultMtx.Lock()
+	defer _faultMtx.Unlock()
+	period := _faults.ObstructionFlap
+	if period <= 0 {
+		return isObstructed
+	}
+	return isObstructed || (time.Since(_flapStart)/period)%2 == 0
+}
@@ -39,6 +39,8 @@ const (
 	DoorOpen
 	// Moving indicates the elevator is in motion between floors
 	Moving
+	// Initializing indicates the elevator is searching for a floor after startup
+	Initializing
 )
 
 // MotorDirection defines the direction of movement for the elevator motor.
@@ -54,6 +56,28 @@ const (
 	Stop MotorDirection = 0
 )
 
+// Health describes whether an elevator is operational and, if not, why.
+type Health int
+
+// Health constants define the possible health states of an elevator.
+// The faults are ordered by severity, the most severe fault is reported if several are present.
+const (
+	// Operational indicates the elevator works as expected
+	Operational Health = iota
+	// Maintenance indicates the elevator was taken out of service by an operator
+	Maintenance
+	// IoDisconnected indicates the connection to the elevator hardware is lost
+	IoDisconnected
+	// EngineFault indicates the elevator does not move although the motor is running
+	EngineFault
+	// SensorFault indicates the floor sensor reported an impossible sequence of floors
+	SensorFault
+	// DoorFault indicates the door of the elevator is stuck open
+	DoorFault
+	// Obstructed indicates the door of the elevator is obstructed for a long time
+	Obstructed
+)
+
 // ButtonType identifies the different types of elevator call buttons.
 type ButtonType int
 
@@ -116,6 +140,8 @@ func (b Behavior) String() string {
 		return "DoorOpen"
 	case Moving:
 		return "Moving"
+	case Initializing:
+		return "Initializing"
 	default:
 		return "Unknown"
 	}
@@ -135,6 +161,28 @@ func (d MotorDirection) String() string {
 	}
 }
 
+// String returns a readable string representation of the elevator Health.
+func (h Health) String() string {
+	switch h {
+	case Operational:
+		return "Operational"
+	case Maintenance:
+		return "Maintenance"
+	case IoDisconnected:
+		return "IoDisconnected"
+	case EngineFault:
+		return "EngineFault"
+	case SensorFault:
+		return "SensorFault"
+	case DoorFault:
+		return "DoorFault"
+	case Obstructed:
+		return "Obstructed"
+	default:
+		return "Unknown"
+	}
+}
+
 // String returns a readable string representation of the elevator ButtonType.
 func (b ButtonType) String() string {
 	switch b {
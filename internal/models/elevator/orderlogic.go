@@ -0,0 +1,122 @@
+package elevator
+
+import "time"
+
+// DoorOpenDuration is the time the door stays open when the elevator serves a floor.
+const DoorOpenDuration = time.Second * 3
+
+// EverybodyGoesOn decides whether all orders at a floor are cleared when the elevator stops there,
+// regardless of the direction the passengers want to travel in.
+const EverybodyGoesOn bool = false
+
+// OrdersAbove returns true if there is an order on a floor above the elevator.
+func OrdersAbove(e State, o Order) bool {
+	for f := e.Floor + 1; f < NumFloors; f++ {
+		if OrdersHere(State{Floor: f}, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// OrdersBelow returns true if there is an order on a floor below the elevator.
+func OrdersBelow(e State, o Order) bool {
+	for f := e.Floor - 1; f >= 0; f-- {
+		if OrdersHere(State{Floor: f}, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// OrdersHere returns true if there is an order on the floor of the elevator.
+func OrdersHere(e State, o Order) bool {
+	for _, order := range o[e.Floor] {
+		if order {
+			return true
+		}
+	}
+	return false
+}
+
+// ChooseDirection returns the direction and behavior the elevator continues with given its orders.
+//
+// The elevator keeps its direction as long as there are orders ahead of it.
+// DoorOpen is returned if the elevator should serve its current floor before it moves on.
+func ChooseDirection(e State, o Order) (MotorDirection, Behavior) {
+	switch e.Direction {
+	case Up:
+		if OrdersAbove(e, o) {
+			return Up, Moving
+		} else if OrdersHere(e, o) {
+			return Stop, DoorOpen
+		} else if OrdersBelow(e, o) {
+			return Down, Moving
+		}
+	case Down:
+		if OrdersBelow(e, o) {
+			return Down, Moving
+		} else if OrdersHere(e, o) {
+			return Stop, DoorOpen
+		} else if OrdersAbove(e, o) {
+			return Up, Moving
+		}
+	default:
+		if OrdersHere(e, o) {
+			return Stop, DoorOpen
+		} else if OrdersAbove(e, o) {
+			return Up, Moving
+		} else if OrdersBelow(e, o) {
+			return Down, Moving
+		}
+	}
+	return Stop, Idle
+}
+
+// ShouldStop returns true if the elevator should stop at its current floor.
+func ShouldStop(e State, o Order) bool {
+	switch e.Direction {
+	case Down:
+		return o[e.Floor][HallDown] || o[e.Floor][Cab] || !OrdersBelow(e, o)
+	case Up:
+		return o[e.Floor][HallUp] || o[e.Floor][Cab] || !OrdersAbove(e, o)
+	default:
+		return true
+	}
+}
+
+// ClearAtCurrentFloor clears the orders that are served when the elevator stops at its current floor.
+//
+// Cab orders are always cleared. A hall call in the opposite direction of travel is only cleared
+// if the elevator turns at this floor. cleared is called for every button that is cleared,
+// also if there was no order for it.
+func ClearAtCurrentFloor(e State, o *Order, cleared func(btn ButtonType)) {
+	clear := func(btn ButtonType) {
+		o[e.Floor][btn] = false
+		cleared(btn)
+	}
+
+	if EverybodyGoesOn {
+		clear(HallUp)
+		clear(HallDown)
+		clear(Cab)
+		return
+	}
+
+	clear(Cab)
+	switch e.Direction {
+	case Up:
+		if !OrdersAbove(e, *o) && !o[e.Floor][HallUp] {
+			clear(HallDown)
+		}
+		clear(HallUp)
+	case Down:
+		if !OrdersBelow(e, *o) && !o[e.Floor][HallDown] {
+			clear(HallUp)
+		}
+		clear(HallDown)
+	default:
+		clear(HallDown)
+		clear(HallUp)
+	}
+}
@@ -6,6 +6,8 @@
 package message
 
 import (
+	"time"
+
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/request"
 )
@@ -24,6 +26,32 @@ type FloorArrival struct {
 // Flow path: [elevio] -> [driver]
 type Obstruction struct{}
 
+// FloorSensorReading is a message sent every time the reading of the floor sensor changes.
+// Unlike FloorArrival, it also reports when the elevator leaves a floor.
+//
+// Flow path: [elevio] -> [floormonitor]
+type FloorSensorReading struct {
+	// Floor indicates which floor the sensor reads. It is only valid if AtFloor is true
+	Floor elevator.Floor
+	// AtFloor indicates whether the elevator is at a floor or between two floors
+	AtFloor bool
+}
+
+// FloorSensorFault is a message sent when the floor sensor can no longer be trusted.
+// The driver halts the elevator and ignores the floor sensor from then on.
+//
+// Flow path: [floormonitor] -> [driver]
+type FloorSensorFault struct{}
+
+// DoorNudge is a message sent when the door should be closed despite an obstruction.
+// This happens when a passenger keeps the door from closing too often.
+//
+// Flow path: [doormonitor] -> [driver]
+type DoorNudge struct {
+	// Active indicates whether the door is being nudged closed
+	Active bool
+}
+
 // ElevatorState is a message sent when the operational state of an elevator changes.
 // This includes changes in floor position, behavior mode, or movement direction.
 //
@@ -45,8 +73,190 @@ type ElevatorState struct {
 type ServiceOrder struct {
 	// Order contains the calculated service orders for the elevator
 	Order elevator.Order
+	// Destinations contains the destination calls whose passengers board this elevator.
+	// Their pickups are already part of the Order as hall orders.
+	Destinations []request.Destination
 }
 
+// HallCallEstimate is the estimated time of arrival of the elevator assigned to a hall call.
+type HallCallEstimate struct {
+	// Floor and Direction identify the hall call
+	Floor     elevator.Floor
+	Direction request.Direction
+	// Elevator identifies which elevator is assigned to the hall call
+	Elevator elevator.Id
+	// Eta is the estimated time until the elevator arrives at the hall call
+	Eta time.Duration
+}
+
+// HallCallEstimates is a message sent when the orders have been recalculated.
+// It contains the estimated arrival of all assigned hall calls.
+//
+// Flow path: [orders] -> [comms]
+type HallCallEstimates struct {
+	// Estimates contains one estimate for each assigned hall call
+	Estimates []HallCallEstimate
+	// Abandoned contains the hall calls the local elevator gave up, as it did not serve them in time
+	Abandoned []request.Hall
+}
+
+// PeerEstimates is a message sent when the estimates of a peer are received.
+// The hall calls a peer assigned to itself tell the other peers which elevator served a hall call so far,
+// and the hall calls it gave up are moved to another elevator by all peers.
+//
+// Flow path: [comms] -> [orders]
+type PeerEstimates struct {
+	// Source identifies which elevator calculated the estimates
+	Source elevator.Id
+	// Estimates contains the estimates of the peer as they were broadcast
+	Estimates []HallCallEstimate
+	// Abandoned contains the hall calls the peer gave up, as it did not serve them in time
+	Abandoned []request.Hall
+}
+
+// CandidateCost is the cost of assigning a hall call to one elevator.
+type CandidateCost struct {
+	// Elevator identifies the candidate elevator
+	Elevator elevator.Id
+	// Cost is the estimated arrival at the hall call if the elevator is assigned to it
+	Cost time.Duration
+}
+
+// AssignmentDecision explains why a hall call was assigned to an elevator.
+type AssignmentDecision struct {
+	// Floor and Direction identify the hall call
+	Floor     elevator.Floor
+	Direction request.Direction
+	// Elevator identifies which elevator was assigned the hall call
+	Elevator elevator.Id
+	// Reason describes why the elevator won the hall call
+	Reason string
+	// Reassignments counts how often the hall call moved to another elevator while it was active
+	Reassignments int
+	// Candidates contains the cost of every elevator that was considered
+	Candidates []CandidateCost
+}
+
+// AssignmentDecisions is a message sent when the orders have been recalculated
+// and the explanation of the assignments is enabled.
+//
+// Flow path: [orders] -> [api]
+type AssignmentDecisions struct {
+	// Decisions contains one decision for each assigned hall call
+	Decisions []AssignmentDecision
+}
+
+// StaleCall is a confirmed hall call that has not been served within the stale threshold.
+type StaleCall struct {
+	// Floor and Direction identify the hall call
+	Floor     elevator.Floor
+	Direction request.Direction
+	// Age is the time since the local peer learned that the hall call was confirmed
+	Age time.Duration
+	// Level is the number of times the hall call exceeded the threshold
+	Level int
+	// Elevator identifies which elevator is assigned to the hall call. It is only valid if IsAssigned is true
+	Elevator   elevator.Id
+	IsAssigned bool
+	// Excluded contains the elevators that gave up the hall call, as they failed to serve it in time
+	Excluded []elevator.Id
+}
+
+// StaleCalls is a message sent when the orders have been recalculated.
+// It contains the hall calls the stale call watchdog raised an alarm for.
+//
+// Flow path: [orders] -> [api]
+type StaleCalls struct {
+	// Calls contains the stale hall calls that are not served yet
+	Calls []StaleCall
+	// Alarms and Reassignments count how often the watchdog intervened since the start
+	Alarms        int
+	Reassignments int
+}
+
+// ClusterState is a message sent every time the orders are calculated.
+// It contains the information about all elevators the order server used for the calculation.
+//
+// Flow path: [orders] -> [api]
+type ClusterState struct {
+	// States contains the latest state of every elevator known to the order server
+	States map[elevator.Id]elevator.State
+	// Alive and Suspected contain the ids of the operational elevators and of those suspected to have died
+	Alive     []elevator.Id
+	Suspected []elevator.Id
+	// Orders contains the calculated orders of every elevator that took part in the calculation
+	Orders map[elevator.Id]elevator.Order
+	// Boardings contains the elevator each passenger with a confirmed destination call should board
+	Boardings map[request.Destination]elevator.Id
+}
+
+// NetworkFault is a message sent when the network of the local elevator is cut off or restored for testing.
+// While isolated, the local peer neither sends nor receives broadcasts, as if its network cable was unplugged.
+//
+// Flow path: [api] -> [comms]
+type NetworkFault struct {
+	// Isolated is true if the local peer is cut off from the network
+	Isolated bool
+}
+
+// CommsFaults is a message sent when the injected faults of the network are changed for testing.
+// The faults are applied to the broadcasts received by the local peer. The zero value injects no faults.
+//
+// Flow path: [api] -> [comms]
+type CommsFaults struct {
+	// DropPercent, DuplicatePercent and ReorderPercent are the chances in percent that a received message
+	// is dropped, delivered twice or held back until after the next message
+	DropPercent      float64
+	DuplicatePercent float64
+	ReorderPercent   float64
+	// Delay is added to every received message, plus a random part of up to Jitter
+	Delay  time.Duration
+	Jitter time.Duration
+	// BlockedPeers are the peers whose messages are dropped. They still receive the messages of the local peer,
+	// so that a partition can be asymmetric.
+	BlockedPeers []elevator.Id
+}
+
+// IoFaults is a message sent when the injected faults of the elevator hardware are changed for testing.
+// The zero value injects no faults.
+//
+// Flow path: [api] -> [elevatorio]
+type IoFaults struct {
+	// StuckFloorSensor freezes the floor sensor at the reading it had when the fault was injected
+	StuckFloorSensor bool
+	// StalledMotor keeps the motor from moving, whatever direction the elevator sets
+	StalledMotor bool
+	// ObstructionFlap toggles the obstruction switch with this period. Zero disables the flapping.
+	ObstructionFlap time.Duration
+}
+
+// PeerObservation is a message sent when a broadcast of a peer was observed passively.
+// The observer only listens and takes no part in the confirmation of requests.
+//
+// Flow path: [comms] -> [elevtop]
+type PeerObservation struct {
+	// Source identifies which elevator sent the broadcast
+	Source elevator.Id
+	// Time is the time the broadcast was received
+	Time time.Time
+	// Left is true if the peer announced that it shuts down. The other fields are not set in that case.
+	Left bool
+	// State and Health are the elevator state and the health reported by the peer
+	State  elevator.State
+	Health elevator.Health
+	// Requests contains the status of every hall and cab request in the registry of the peer,
+	// and every destination request the peer has seen
+	Requests []request.Request
+	// Estimates contains the assigned elevator and the estimated arrival of the hall calls as calculated by the peer
+	Estimates []HallCallEstimate
+}
+
+// Synced is a message sent once the local peer has synced its requests with the other peers after joining.
+// Until then, the local peer does not confirm requests.
+//
+// Flow path: [comms] -> [requests]
+type Synced struct{}
+
 // RequestState is a message sent when the lifecycle state of a service request changes.
 // This includes new requests, confirmed requests, and completed requests.
 //
@@ -60,14 +270,22 @@ type RequestState struct {
 
 // PeerSignal is a message sent when communication is received from another elevator.
 // It serves as proof that another elevator in the system is operational.
+// The monitors of the local elevator use it to report and clear faults of the local elevator.
 //
-// Flow path: [comms] -> [healthmonitor]
+// Flow paths:
+//   - [comms] -> [healthmonitor]    (heartbeats and health of the external peers)
+//   - [monitors] -> [healthmonitor] (faults of the local elevator)
 type PeerSignal struct {
 	// Id identifies which elevator sent the heartbeat
 	Id elevator.Id
 	// Alive indicates whether the elevator is still
 	// operational and sending heartbeats
 	Alive bool
+	// Health describes why the elevator is not operational when Alive is false.
+	// For the local elevator, a signal with Alive set to true clears the fault given by Health.
+	Health elevator.Health
+	// Left is true if the peer announced that it shuts down. Alive is false and Health is not set in that case.
+	Left bool
 }
 
 // ActivePeers is a message sent when the set of operational elevators changes.
@@ -76,7 +294,18 @@ type PeerSignal struct {
 // Flow paths:
 //   - [healthmonitor] -> [requests] (for managing request acknowledgments)
 //   - [healthmonitor] -> [orders]   (for calculating optimal order assignments)
+//   - [healthmonitor] -> [comms]    (for sharing the health of the local elevator)
 type ActivePeers struct {
 	// Peers contains the IDs of all elevators currently known to be operational
 	Peers []elevator.Id
+	// Suspected contains the IDs of the operational elevators that are suspected to have died.
+	// They have not sent a heartbeat for an unusually long time, but are not yet considered dead.
+	Suspected []elevator.Id
+	// Health contains the health of the local elevator and of all external elevators that reported a fault.
+	// The map must not be modified by the receivers, as it is shared between them.
+	Health map[elevator.Id]elevator.Health
+	// Partitioned is true if fewer elevators are operational than the cluster consists of
+	Partitioned bool
+	// InMajority is true if more than half of the elevators of the cluster are operational
+	InMajority bool
 }
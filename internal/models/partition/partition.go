@@ -0,0 +1,79 @@
+// Package partition defines how the elevators behave when the network is split into several partitions.
+//
+// A partition is detected when fewer elevators are alive than the cluster consists of.
+// The policy decides whether the elevators of a partition confirm and serve hall calls.
+// Cab calls are always served, as they belong to a single elevator.
+package partition
+
+import "fmt"
+
+// Policy defines which requests are served by the elevators of a partition.
+type Policy int
+
+// Policy constants define the possible partition policies.
+const (
+	// ServeAll lets every partition confirm and serve all hall calls on its own.
+	// Hall calls may be served twice, but no hall call is left unserved.
+	// An isolated elevator confirms hall calls without the acknowledgement of another peer,
+	// if the confirmation quorum of the hall calls allows confirming alone.
+	ServeAll Policy = iota
+	// Majority lets only the partition with the majority of the elevators confirm and serve hall calls.
+	Majority
+	// CabOnly lets a partitioned elevator only serve cab calls until the partition heals.
+	CabOnly
+)
+
+// ParsePolicy converts the name of a policy as used in the config to a Policy.
+// An empty name results in the default policy ServeAll.
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "", "serve_all":
+		return ServeAll, nil
+	case "majority":
+		return Majority, nil
+	case "cab_only":
+		return CabOnly, nil
+	default:
+		return ServeAll, fmt.Errorf("unknown partition policy %q", name)
+	}
+}
+
+// ServesHallCalls returns true if the elevators of the partition confirm and serve hall calls.
+func (p Policy) ServesHallCalls(partitioned, inMajority bool) bool {
+	switch p {
+	case Majority:
+		return inMajority
+	case CabOnly:
+		return !partitioned
+	default:
+		return true
+	}
+}
+
+// AllowsConfirmingAlone returns true if a single alive elevator may confirm hall calls on its own.
+//
+// Usually, a hall call must be acknowledged by at least one other peer, so that the button light is only
+// turned on when the hall call is backed up. An isolated elevator would otherwise never confirm hall calls.
+// Confirming alone is allowed if the whole cluster consists of a single elevator, i.e. it is the only alive
+// elevator without a partition, or if the elevator is cut off and the policy lets it serve hall calls.
+// In a healthy cluster of several elevators, it is never allowed.
+func (p Policy) AllowsConfirmingAlone(partitioned, inMajority bool, numAlive int) bool {
+	if !partitioned {
+		return numAlive <= 1
+	}
+	return numAlive <= 1 && p.ServesHallCalls(partitioned, inMajority)
+}
+
+// String returns the name of the policy as used in the config.
+func (p Policy) String() string {
+	switch p {
+	case ServeAll:
+		return "serve_all"
+	case Majority:
+		return "majority"
+	case CabOnly:
+		return "cab_only"
+	default:
+		return "unknown"
+	}
+}
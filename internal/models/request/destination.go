@@ -0,0 +1,76 @@
+package request
+
+import (
+	"fmt"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+//------------------------------------------------------------------------------
+// Destination Origin Type
+//------------------------------------------------------------------------------
+
+// Destination represents a request entered on a destination dispatch keypad.
+// Instead of pressing a hall button, the passenger enters the floor they want to travel to.
+// The system then decides which elevator the passenger should board.
+type Destination struct {
+	// From indicates the floor where the passenger is waiting
+	From elevator.Floor
+	// To indicates the floor the passenger wants to travel to
+	To elevator.Floor
+}
+
+//------------------------------------------------------------------------------
+// Destination Origin Methods
+//------------------------------------------------------------------------------
+
+// isSource implements the Origin interface.
+func (Destination) isSource() {}
+
+// GetFloor returns the floor where the passenger is waiting.
+func (d Destination) GetFloor() elevator.Floor {
+	return d.From
+}
+
+// GetButtonType returns the hall button type matching the direction of travel.
+// A destination call is picked up like a hall call in the same direction.
+func (d Destination) GetButtonType() elevator.ButtonType {
+	if d.Direction() == Up {
+		return elevator.HallUp
+	}
+	return elevator.HallDown
+}
+
+// Direction returns the direction the passenger travels from the pickup floor.
+func (d Destination) Direction() Direction {
+	if d.To > d.From {
+		return Up
+	}
+	return Down
+}
+
+// IsValid checks that both floors exist and differ.
+// A destination call to the floor the passenger waits on has no direction and is never served.
+func (d Destination) IsValid() bool {
+	return d.From >= 0 && d.From < elevator.NumFloors &&
+		d.To >= 0 && d.To < elevator.NumFloors &&
+		d.From != d.To
+}
+
+// String returns a readable string representation of a Destination request origin.
+func (d Destination) String() string {
+	return fmt.Sprintf("Destination{From: %v, To: %v}", d.From, d.To)
+}
+
+//------------------------------------------------------------------------------
+// Factory Functions
+//------------------------------------------------------------------------------
+
+// NewDestinationRequest creates a new Request for a destination dispatch call.
+// The floors are not checked, see Destination.IsValid.
+func NewDestinationRequest(from, to elevator.Floor, s Status) Request {
+	return Request{
+		Origin: Destination{From: from, To: to},
+		Status: s,
+	}
+}
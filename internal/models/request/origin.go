@@ -9,7 +9,7 @@ import (
 //------------------------------------------------------------------------------
 
 // Origin represents the source of a request (which button was pressed).
-// This interface allows for different types of request sources (hall buttons, cab buttons).
+// This interface allows for different types of request sources (hall buttons, cab buttons, destination keypads).
 type Origin interface {
 	// isSource is a marker method to identify implementations of Origin
 	isSource()
@@ -34,3 +34,9 @@ func IsCab(r Request) bool {
 	_, ok := r.Origin.(Cab)
 	return ok
 }
+
+// IsDestination checks if a request originated from a destination dispatch keypad.
+func IsDestination(r Request) bool {
+	_, ok := r.Origin.(Destination)
+	return ok
+}
@@ -0,0 +1,122 @@
+package doormonitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/elevatorio"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// buzzerInterval is the interval at which the stop lamp blinks while the door is nudged closed.
+// The stop lamp acts as the buzzer, as the elevator has no sound output.
+const buzzerInterval = time.Millisecond * 250
+
+// RunDoorMonitor monitors that the door of the local elevator actually closes
+//
+// Every time the obstruction switch is activated while the door is open, the door reopens.
+// After the configured number of reopenings, the door is nudged closed: the driver ignores the obstruction
+// and closes the door slowly while the buzzer lamp pattern is shown.
+// If the door stays open for longer than the stuck timeout, a door fault is reported to the health monitor.
+func RunDoorMonitor(ctx context.Context,
+	local elevator.Id,
+	maxReopenings int,
+	stuckTimeout time.Duration,
+	oFromElevio <-chan message.Obstruction,
+	sFromDriver <-chan message.ElevatorState,
+	toDriver chan<- message.DoorNudge,
+	toHealthMonitor chan<- message.PeerSignal) {
+
+	stuckTimer := time.NewTimer(stuckTimeout)
+	stuckTimer.Stop()
+	buzzer := time.NewTicker(buzzerInterval)
+	buzzer.Stop()
+
+	isDoorOpen := false
+	isObstructed := false
+	isNudging := false
+	isFaulty := false
+	isBuzzerOn := false
+	reopenings := 0
+
+	stopNudging := func() {
+		if !isNudging {
+			return
+		}
+		isNudging = false
+		buzzer.Stop()
+		isBuzzerOn = false
+		elevatorio.SetStopLamp(false)
+		select {
+		case toDriver <- message.DoorNudge{Active: false}:
+		case <-ctx.Done():
+			return
+		}
+		log.Printf("[doormonitor] Stopped nudging the door")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[doormonitor] Shutting down")
+			return
+
+		case <-oFromElevio:
+			isObstructed = !isObstructed
+			if !isObstructed || !isDoorOpen || isNudging {
+				continue
+			}
+
+			reopenings++
+			log.Printf("[doormonitor] The door reopened due to an obstruction (%v/%v)", reopenings, maxReopenings)
+			if reopenings >= maxReopenings {
+				isNudging = true
+				buzzer.Reset(buzzerInterval)
+				select {
+				case toDriver <- message.DoorNudge{Active: true}:
+				case <-ctx.Done():
+					return
+				}
+				log.Printf("[doormonitor] The door reopened too often. Nudging the door closed")
+			}
+
+		case msg := <-sFromDriver:
+			wasDoorOpen := isDoorOpen
+			isDoorOpen = msg.State.Behavior == elevator.DoorOpen
+
+			if !wasDoorOpen && isDoorOpen {
+				stuckTimer.Reset(stuckTimeout)
+			}
+			if wasDoorOpen && !isDoorOpen {
+				stuckTimer.Stop()
+				reopenings = 0
+				stopNudging()
+
+				if isFaulty {
+					isFaulty = false
+					select {
+					case toHealthMonitor <- message.PeerSignal{Id: local, Alive: true, Health: elevator.DoorFault}:
+					case <-ctx.Done():
+						return
+					}
+					log.Printf("[doormonitor] The door closed again")
+				}
+			}
+
+		case <-buzzer.C:
+			isBuzzerOn = !isBuzzerOn
+			elevatorio.SetStopLamp(isBuzzerOn)
+
+		case <-stuckTimer.C:
+			isFaulty = true
+			select {
+			case toHealthMonitor <- message.PeerSignal{Id: local, Alive: false, Health: elevator.DoorFault}:
+			case <-ctx.Done():
+				return
+			}
+			log.Printf("[doormonitor] The door is stuck open for more than %v", stuckTimeout)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package enginemonitor
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -11,7 +12,8 @@ import (
 
 const engineTimeout = time.Second * 10
 
-func RunEngineMonitor(local elevator.Id,
+func RunEngineMonitor(ctx context.Context,
+	local elevator.Id,
 	fFromElevio <-chan message.FloorArrival,
 	bFromDriver <-chan message.ElevatorState,
 	toHealthMonitor chan<- message.PeerSignal) {
@@ -26,9 +28,17 @@ func RunEngineMonitor(local elevator.Id,
 
 	for {
 		select {
+		case <-ctx.Done():
+			log.Printf("[enginemonitor] Shutting down")
+			return
+
 		case <-fFromElevio:
 			if isDead {
-				toHealthMonitor <- message.PeerSignal{Id: local, Alive: true}
+				select {
+				case toHealthMonitor <- message.PeerSignal{Id: local, Alive: true, Health: elevator.EngineFault}:
+				case <-ctx.Done():
+					return
+				}
 				isDead = false
 				log.Printf("[enginemonitor] The motor is alive aggain!")
 			}
@@ -40,28 +50,39 @@ func RunEngineMonitor(local elevator.Id,
 
 			current := msg.State.Behavior
 
-			if lastBeh != elevator.Moving && current == elevator.Moving {
+			if !isMoving(lastBeh) && isMoving(current) {
 				engineTimer.Reset(engineTimeout)
 				shouldMove = true
 			}
-			if lastBeh == elevator.Moving && current != elevator.Moving {
+			if isMoving(lastBeh) && !isMoving(current) {
 				engineTimer.Stop()
 				shouldMove = false
 			}
 
 			lastBeh = current
 		case <-engineTimer.C:
-			toHealthMonitor <- message.PeerSignal{Id: local, Alive: false}
+			select {
+			case toHealthMonitor <- message.PeerSignal{Id: local, Alive: false, Health: elevator.EngineFault}:
+			case <-ctx.Done():
+				return
+			}
 			isDead = true
 			log.Print("[enginemotor] The motor died. Trying to move until power is restored.")
-			tryMoving(lasDir)
+			tryMoving(ctx, lasDir)
 		}
 	}
 }
 
-func tryMoving(dir elevator.MotorDirection) {
+// isMoving returns true if the motor should be running with the given behavior.
+// While initializing, the elevator searches for a floor and must reach it before the engine timeout.
+func isMoving(b elevator.Behavior) bool {
+	return b == elevator.Moving || b == elevator.Initializing
+}
+
+// tryMoving drives the motor until the elevator leaves its floor or the context is done
+func tryMoving(ctx context.Context, dir elevator.MotorDirection) {
 	current := elevatorio.GetFloor()
-	for elevatorio.GetFloor() == current {
+	for ctx.Err() == nil && elevatorio.GetFloor() == current {
 		elevatorio.SetMotorDirection(dir)
 		time.Sleep(time.Millisecond * 100)
 	}
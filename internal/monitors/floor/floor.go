@@ -0,0 +1,196 @@
+package floormonitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/elevatorio"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// historySize is the number of raw readings that are logged when a fault is detected
+const historySize = 20
+
+// minFloorInterval is the shortest plausible time between the arrivals at two different floors.
+// The elevator needs about two seconds to travel between two floors.
+const minFloorInterval = time.Millisecond * 500
+
+// stuckTimeout is the time the sensor may read the same floor while the elevator is moving.
+// It covers the time the elevator needs to leave the floor and the delay of the state updates of the driver.
+const stuckTimeout = time.Second * 5
+
+// RunFloorMonitor checks that the readings of the floor sensor are physically possible
+//
+// The sensor is considered faulty if it skips a floor, reads a floor in the opposite direction of travel,
+// reads two different floors in rapid succession or keeps reading the same floor while the elevator is moving.
+// On a fault, the motor is stopped, the driver is told to halt and a sensor fault is reported to the health monitor.
+// The fault is not cleared, as the elevator must be inspected before it can be trusted again.
+// The latest raw readings are logged for the maintenance.
+func RunFloorMonitor(ctx context.Context,
+	local elevator.Id,
+	rFromElevio <-chan message.FloorSensorReading,
+	sFromDriver <-chan message.ElevatorState,
+	toDriver chan<- message.FloorSensorFault,
+	toHealthMonitor chan<- message.PeerSignal) {
+
+	stuckTimer := time.NewTimer(stuckTimeout)
+	stuckTimer.Stop()
+
+	checker := newSequenceChecker()
+	isFaulty := false
+
+	reportFault := func(reason string) {
+		if isFaulty {
+			return
+		}
+		isFaulty = true
+		stuckTimer.Stop()
+
+		elevatorio.SetMotorDirection(elevator.Stop)
+		select {
+		case toDriver <- message.FloorSensorFault{}:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case toHealthMonitor <- message.PeerSignal{Id: local, Alive: false, Health: elevator.SensorFault}:
+		case <-ctx.Done():
+			return
+		}
+		log.Printf("[floormonitor] The floor sensor is faulty: %v. Halting the elevator.\n%v", reason, checker.history)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[floormonitor] Shutting down")
+			return
+
+		case msg := <-rFromElevio:
+			if isFaulty {
+				continue
+			}
+			if reason, ok := checker.addReading(msg, time.Now()); !ok {
+				reportFault(reason)
+				continue
+			}
+			if checker.isStuckCandidate() {
+				stuckTimer.Reset(stuckTimeout)
+			} else {
+				stuckTimer.Stop()
+			}
+
+		case msg := <-sFromDriver:
+			if isFaulty {
+				continue
+			}
+			wasStuckCandidate := checker.isStuckCandidate()
+			checker.state = msg.State
+			if checker.isStuckCandidate() && !wasStuckCandidate {
+				stuckTimer.Reset(stuckTimeout)
+			} else if !checker.isStuckCandidate() {
+				stuckTimer.Stop()
+			}
+
+		case <-stuckTimer.C:
+			reportFault(fmt.Sprintf("the sensor read floor %v for %v while moving", checker.lastFloor, stuckTimeout))
+		}
+	}
+}
+
+// sequenceChecker validates a sequence of floor sensor readings against the state of the driver
+type sequenceChecker struct {
+	// state is the latest state reported by the driver
+	state elevator.State
+	// lastFloor is the latest floor the sensor read
+	lastFloor elevator.Floor
+	// lastArrival is the time the sensor started reading lastFloor
+	lastArrival time.Time
+	// hasFloor is false until the sensor read its first floor
+	hasFloor bool
+	// atFloor is true while the sensor reads a floor
+	atFloor bool
+	// history contains the latest raw readings
+	history readingHistory
+}
+
+func newSequenceChecker() *sequenceChecker {
+	return &sequenceChecker{}
+}
+
+// addReading stores the reading and returns false together with the reason if the reading is implausible
+func (c *sequenceChecker) addReading(r message.FloorSensorReading, now time.Time) (string, bool) {
+	c.history.add(r, now)
+	c.atFloor = r.AtFloor
+	if !r.AtFloor {
+		return "", true
+	}
+
+	if !c.hasFloor || r.Floor == c.lastFloor {
+		c.hasFloor = true
+		c.lastFloor = r.Floor
+		c.lastArrival = now
+		return "", true
+	}
+
+	previous, since := c.lastFloor, now.Sub(c.lastArrival)
+	c.lastFloor = r.Floor
+	c.lastArrival = now
+
+	switch {
+	case r.Floor < 0 || r.Floor >= elevator.NumFloors:
+		return fmt.Sprintf("the sensor read the non-existing floor %v", r.Floor), false
+	case r.Floor-previous > 1 || previous-r.Floor > 1:
+		return fmt.Sprintf("the sensor skipped from floor %v to floor %v", previous, r.Floor), false
+	case c.isMovingOpposite(previous, r.Floor):
+		return fmt.Sprintf("the sensor read floor %v after floor %v while moving %v", r.Floor, previous, c.state.Direction), false
+	case since < minFloorInterval:
+		return fmt.Sprintf("the sensor read floor %v only %v after floor %v", r.Floor, since.Round(time.Millisecond), previous), false
+	}
+	return "", true
+}
+
+// isMovingOpposite returns true if the floor changed in the opposite direction of travel
+func (c *sequenceChecker) isMovingOpposite(previous, current elevator.Floor) bool {
+	if c.state.Behavior != elevator.Moving {
+		return false
+	}
+	return (c.state.Direction == elevator.Up && current < previous) ||
+		(c.state.Direction == elevator.Down && current > previous)
+}
+
+// isStuckCandidate returns true if the elevator is moving while the sensor reads a floor
+func (c *sequenceChecker) isStuckCandidate() bool {
+	return c.atFloor && c.state.Behavior == elevator.Moving
+}
+
+// readingHistory is a ring buffer of the latest raw readings of the floor sensor
+type readingHistory struct {
+	readings []message.FloorSensorReading
+	times    []time.Time
+}
+
+func (h *readingHistory) add(r message.FloorSensorReading, t time.Time) {
+	h.readings = append(h.readings, r)
+	h.times = append(h.times, t)
+	if len(h.readings) > historySize {
+		h.readings = h.readings[1:]
+		h.times = h.times[1:]
+	}
+}
+
+// String returns the readings with one line per reading
+func (h readingHistory) String() string {
+	str := "Latest floor sensor readings:\n"
+	for i, r := range h.readings {
+		floor := "between floors"
+		if r.AtFloor {
+			floor = fmt.Sprintf("floor %v", r.Floor)
+		}
+		str += fmt.Sprintf("\t%v %v\n", h.times[i].Format("15:04:05.000"), floor)
+	}
+	return str
+}
@@ -0,0 +1,50 @@
+package floormonitor
+
+import (
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+func TestSequenceChecker(t *testing.T) {
+	movingUp := elevator.State{Floor: 0, Behavior: elevator.Moving, Direction: elevator.Up}
+	movingDown := elevator.State{Floor: 3, Behavior: elevator.Moving, Direction: elevator.Down}
+
+	tests := []struct {
+		name     string
+		state    elevator.State
+		floors   []int
+		interval time.Duration
+		valid    bool
+	}{
+		{name: "Moving up floor by floor", state: movingUp, floors: []int{0, -1, 1, -1, 2}, interval: time.Second, valid: true},
+		{name: "Moving down floor by floor", state: movingDown, floors: []int{3, -1, 2, -1, 1}, interval: time.Second, valid: true},
+		{name: "Skipped floor", state: movingUp, floors: []int{0, -1, 2}, interval: time.Second, valid: false},
+		{name: "Opposite direction", state: movingUp, floors: []int{2, -1, 1}, interval: time.Second, valid: false},
+		{name: "Rapid succession", state: movingUp, floors: []int{0, -1, 1}, interval: time.Millisecond * 100, valid: false},
+		{name: "Direction is unknown when idle", state: elevator.State{Floor: 2}, floors: []int{2, -1, 1}, interval: time.Second, valid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSequenceChecker()
+			c.state = tt.state
+
+			now := time.Now()
+			valid := true
+			for _, f := range tt.floors {
+				now = now.Add(tt.interval)
+				reading := message.FloorSensorReading{Floor: elevator.Floor(f), AtFloor: f != -1}
+				if _, ok := c.addReading(reading, now); !ok {
+					valid = false
+				}
+			}
+
+			if valid != tt.valid {
+				t.Errorf("expected the sequence %v to be valid: %v, got %v", tt.floors, tt.valid, valid)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package obstructionmonitor
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -10,7 +11,8 @@ import (
 
 const obstructionTimeout = time.Second * 10
 
-func RunObstructionMonitor(local elevator.Id,
+func RunObstructionMonitor(ctx context.Context,
+	local elevator.Id,
 	oFromElevio <-chan message.Obstruction,
 	toHealthMonitor chan<- message.PeerSignal) {
 
@@ -22,9 +24,17 @@ func RunObstructionMonitor(local elevator.Id,
 
 	for {
 		select {
+		case <-ctx.Done():
+			log.Printf("[obstructionmonitor] Shutting down")
+			return
+
 		case <-oFromElevio:
 			if isObstructed && isDead {
-				toHealthMonitor <- message.PeerSignal{Id: local, Alive: true}
+				select {
+				case toHealthMonitor <- message.PeerSignal{Id: local, Alive: true, Health: elevator.Obstructed}:
+				case <-ctx.Done():
+					return
+				}
 				isDead = false
 				log.Printf("[enginemonitor] The obstruction has been cleared!")
 			}
@@ -37,7 +47,11 @@ func RunObstructionMonitor(local elevator.Id,
 
 			isObstructed = !isObstructed
 		case <-obstructionTimer.C:
-			toHealthMonitor <- message.PeerSignal{Id: local, Alive: false}
+			select {
+			case toHealthMonitor <- message.PeerSignal{Id: local, Alive: false, Health: elevator.Obstructed}:
+			case <-ctx.Done():
+				return
+			}
 			isDead = true
 			log.Print("[enginemotor] The elevator is currently permantly obstructed. We are considered dead")
 		}
@@ -5,6 +5,7 @@
 package healthmonitor
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -12,11 +13,18 @@ import (
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
 )
 
-// Timeout is the time after which an elevator is considered dead.
+// Timeout is the time after which an elevator is considered dead at the latest.
+// Usually, the phi accrual failure detector declares an elevator dead much earlier.
 const Timeout = time.Second * 10
 
-// PollInterval is the frequency at which the monitor informs about alive elevators.
-const PollInterval = time.Second * 1
+// PollInterval is the frequency at which the monitor evaluates and informs about alive elevators.
+const PollInterval = time.Millisecond * 200
+
+// DefaultSuspectThreshold is the default suspicion level above which a peer is suspected.
+const DefaultSuspectThreshold = 3.0
+
+// DefaultDeadThreshold is the default suspicion level above which a peer is considered dead.
+const DefaultDeadThreshold = 8.0
 
 // lastSeen is a map of the last time a ping was received from an elevator.
 type lastSeen = map[elevator.Id]time.Time
@@ -27,8 +35,19 @@ type alivePeers = map[elevator.Id]bool
 // RunMonitor runs the health monitor
 //
 // It listens for pings from the elevators and tracks which elevators are alive.
+// The suspicion level of each remote peer is calculated by a phi accrual failure detector.
+// Above the suspect threshold, the peer is reported as suspected so that its hall calls can be reassigned early.
+// Above the dead threshold, the peer is considered dead.
+// The network is considered partitioned if fewer peers are alive than the cluster consists of.
+// The size of the cluster is the configured cluster size or the number of peers ever seen, whichever is larger.
+// A peer that left is dropped from the alive peers and no longer counts towards the size of the cluster,
+// so that a planned shutdown does not partition the remaining peers.
 func RunMonitor(
+	ctx context.Context,
 	local elevator.Id,
+	clusterSize int,
+	suspectThreshold float64,
+	deadThreshold float64,
 	peers <-chan message.PeerSignal,
 	alivenessToRequests chan<- message.ActivePeers,
 	alivenessToOrders chan<- message.ActivePeers,
@@ -37,17 +56,41 @@ func RunMonitor(
 	lastSeen := make(lastSeen)
 	alivePeers := make(alivePeers)
 	alivePeers[local] = true // Local is considered alive at startup
+	suspectedPeers := make(map[elevator.Id]bool)
+	detector := newPhiDetector(suspectThreshold, deadThreshold)
+	// localFaults contains the faults currently reported by the monitors of the local elevator
+	localFaults := make(map[elevator.Health]bool)
+	// peerHealth contains the faults reported by the external peers
+	peerHealth := make(map[elevator.Id]elevator.Health)
+	// leftPeers contains the peers that announced that they shut down and have not come back since
+	leftPeers := make(map[elevator.Id]bool)
 
 	ticker := time.NewTicker(PollInterval)
 
 	sendAliveness := func(alivePeers map[elevator.Id]bool) {
+		health := make(map[elevator.Id]elevator.Health)
+		for id, h := range peerHealth {
+			health[id] = h
+		}
+		health[local] = mostSevere(localFaults)
+
+		size := max(clusterSize-len(leftPeers), len(alivePeers))
 		msg := message.ActivePeers{
-			Peers: mapToSlice(alivePeers),
+			Peers:     mapToSlice(alivePeers),
+			Suspected: mapToSlice(suspectedPeers),
+			Health:    health,
+		}
+		msg.Partitioned = len(msg.Peers) < size
+		msg.InMajority = 2*len(msg.Peers) > size
+		log.Printf("[healthmonitor] Alive peers: %v, suspected peers: %v, health: %v, partitioned: %v, in majority: %v",
+			msg.Peers, msg.Suspected, msg.Health, msg.Partitioned, msg.InMajority)
+		for _, c := range []chan<- message.ActivePeers{alivenessToOrders, alivenessToRequests, alivnessToComms} {
+			select {
+			case c <- msg:
+			case <-ctx.Done():
+				return
+			}
 		}
-		log.Printf("[healthmonitor] Alive peers: %v", msg.Peers)
-		alivenessToOrders <- msg
-		alivenessToRequests <- msg
-		alivnessToComms <- msg
 	}
 
 	// send an intial allive message that included the local peer
@@ -55,17 +98,53 @@ func RunMonitor(
 
 	for {
 		select {
+		case <-ctx.Done():
+			log.Printf("[healthmonitor] Shutting down")
+			return
+
 		case msg := <-peers:
-			if msg.Id == local && msg.Alive != alivePeers[local] {
-				print("Change")
-				alivePeers[local] = msg.Alive
+			if msg.Id == local {
+				if !processLocalFault(msg, localFaults) {
+					continue
+				}
+				alivePeers[local] = len(localFaults) == 0
+				log.Printf("[healthmonitor] The local peer is alive: %v (health: %v)", alivePeers[local], mostSevere(localFaults))
+				sendAliveness(alivePeers)
+				continue
+			}
+
+			if msg.Left {
+				processPeerHealth(msg, peerHealth)
+				forgetPeer(msg.Id, lastSeen, alivePeers, suspectedPeers, detector)
+				leftPeers[msg.Id] = true
+				sendAliveness(alivePeers)
+				continue
+			}
+			if msg.Alive && leftPeers[msg.Id] {
+				log.Printf("[healthmonitor] The Peer with id %v came back after it left", msg.Id)
+				delete(leftPeers, msg.Id)
+			}
+
+			processPeerPing(msg, lastSeen)
+			processPeerHealth(msg, peerHealth)
+			if msg.Alive {
+				detector.heartbeat(msg.Id, time.Now())
+			} else if updateAliveList(lastSeen, alivePeers) {
+				// A peer that reported a fault is dropped immediately instead of at the next poll
 				sendAliveness(alivePeers)
-			} else {
-				processPeerPing(msg, lastSeen)
 			}
 
 		case <-ticker.C:
-			if !updateAliveList(lastSeen, alivePeers) {
+			suspected, dead := detector.evaluate(time.Now())
+			for id := range dead {
+				// Setting the last seen time back lets the peer die in the alive list
+				// while the next heartbeat revives it as usual
+				lastSeen[id] = time.Now().Add(-Timeout)
+			}
+
+			changed := updateAliveList(lastSeen, alivePeers)
+			suspectedChanged := updateSuspectedList(suspected, alivePeers, suspectedPeers)
+			if !changed && !suspectedChanged {
 				continue
 			}
 
@@ -103,6 +182,89 @@ func updateAliveList(lastSeen lastSeen, alivePeers alivePeers) bool {
 	return changed
 }
 
+// forgetPeer removes every trace of a peer that left, so that it neither counts as alive nor as dead
+func forgetPeer(id elevator.Id, lastSeen lastSeen, alivePeers alivePeers, suspectedPeers alivePeers, detector *phiDetector) {
+	delete(lastSeen, id)
+	delete(alivePeers, id)
+	delete(suspectedPeers, id)
+	delete(detector.windows, id)
+}
+
+// processLocalFault adds or clears a fault of the local elevator and returns true if the faults changed
+func processLocalFault(msg message.PeerSignal, localFaults map[elevator.Health]bool) bool {
+	if msg.Health == elevator.Operational {
+		// A signal without a fault carries no information about the local faults
+		return false
+	}
+
+	isFaulty := !msg.Alive
+	if localFaults[msg.Health] == isFaulty {
+		return false
+	}
+
+	if isFaulty {
+		localFaults[msg.Health] = true
+		log.Printf("[healthmonitor] The local peer reported the fault %v", msg.Health)
+	} else {
+		delete(localFaults, msg.Health)
+		log.Printf("[healthmonitor] The local peer cleared the fault %v", msg.Health)
+	}
+	return true
+}
+
+// processPeerHealth stores the fault reported by an external peer
+//
+// A peer that left is neither in service nor faulty, so its health is forgotten.
+func processPeerHealth(msg message.PeerSignal, peerHealth map[elevator.Id]elevator.Health) {
+	if msg.Left {
+		delete(peerHealth, msg.Id)
+		log.Printf("[healthmonitor] The Peer with id %v left", msg.Id)
+		return
+	}
+	if msg.Alive {
+		if h, ok := peerHealth[msg.Id]; ok {
+			delete(peerHealth, msg.Id)
+			log.Printf("[healthmonitor] The Peer with id %v recovered from %v", msg.Id, h)
+		}
+		return
+	}
+
+	if peerHealth[msg.Id] != msg.Health {
+		peerHealth[msg.Id] = msg.Health
+		log.Printf("[healthmonitor] The Peer with id %v is out of service: %v", msg.Id, msg.Health)
+	}
+}
+
+// mostSevere returns the most severe of the faults or Operational if there are none
+func mostSevere(faults map[elevator.Health]bool) elevator.Health {
+	for h := elevator.Maintenance; h <= elevator.Obstructed; h++ {
+		if faults[h] {
+			return h
+		}
+	}
+	return elevator.Operational
+}
+
+// updateSuspectedList stores which alive peers are suspected and returns true if the suspected peers changed
+func updateSuspectedList(suspected map[elevator.Id]bool, alivePeers alivePeers, suspectedPeers alivePeers) bool {
+	changed := false
+	for id := range suspectedPeers {
+		if !suspected[id] || !alivePeers[id] {
+			delete(suspectedPeers, id)
+			changed = true
+			log.Printf("[healthmonitor] The Peer with id %v is no longer suspected", id)
+		}
+	}
+	for id := range suspected {
+		if alivePeers[id] && !suspectedPeers[id] {
+			suspectedPeers[id] = true
+			changed = true
+			log.Printf("[healthmonitor] The Peer with id %v is suspected to have died", id)
+		}
+	}
+	return changed
+}
+
 // mapToSlice converts a map to a slice
 func mapToSlice(m map[elevator.Id]bool) []elevator.Id {
 	s := make([]elevator.Id, 0, len(m))
@@ -1,10 +1,12 @@
 package healthmonitor
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
 )
 
 func TestUpdateAliveList(t *testing.T) {
@@ -121,3 +123,64 @@ func TestUpdateAliveList(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessPeerHealth(t *testing.T) {
+	peerHealth := make(map[elevator.Id]elevator.Health)
+
+	processPeerHealth(message.PeerSignal{Id: 1, Alive: false, Health: elevator.EngineFault}, peerHealth)
+	if h := peerHealth[1]; h != elevator.EngineFault {
+		t.Errorf("expected peer 1 to be out of service with %v, got %v", elevator.EngineFault, h)
+	}
+
+	processPeerHealth(message.PeerSignal{Id: 1, Alive: false, Left: true}, peerHealth)
+	processPeerHealth(message.PeerSignal{Id: 2, Alive: false, Left: true}, peerHealth)
+	if len(peerHealth) != 0 {
+		t.Errorf("expected the health of the peers that left to be forgotten, got %v", peerHealth)
+	}
+}
+
+func TestLeaveDoesNotPartition(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	peers := make(chan message.PeerSignal)
+	toOrders := make(chan message.ActivePeers, 100)
+	go RunMonitor(ctx, 0, 3, DefaultSuspectThreshold, DefaultDeadThreshold, peers,
+		make(chan message.ActivePeers, 100), toOrders, make(chan message.ActivePeers, 100))
+
+	// waitFor returns the first aliveness message with the given number of alive peers
+	waitFor := func(numAlive int) message.ActivePeers {
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case msg := <-toOrders:
+				if len(msg.Peers) == numAlive {
+					return msg
+				}
+			case <-timeout:
+				t.Fatalf("expected %v alive peers", numAlive)
+			}
+		}
+	}
+
+	peers <- message.PeerSignal{Id: 1, Alive: true}
+	peers <- message.PeerSignal{Id: 2, Alive: true}
+	if msg := waitFor(3); msg.Partitioned || !msg.InMajority {
+		t.Errorf("expected the full cluster to be neither partitioned nor in the minority, got %+v", msg)
+	}
+
+	// Two peers leave one after the other, which leaves the local peer as the whole cluster
+	peers <- message.PeerSignal{Id: 2, Alive: false, Left: true}
+	if msg := waitFor(2); msg.Partitioned || !msg.InMajority {
+		t.Errorf("expected no partition after a peer left, got %+v", msg)
+	}
+	peers <- message.PeerSignal{Id: 1, Alive: false, Left: true}
+	if msg := waitFor(1); msg.Partitioned || !msg.InMajority || len(msg.Health) != 1 {
+		t.Errorf("expected no partition and only the local health after both peers left, got %+v", msg)
+	}
+
+	// A peer that comes back counts towards the cluster again
+	peers <- message.PeerSignal{Id: 1, Alive: true}
+	if msg := waitFor(2); msg.Partitioned {
+		t.Errorf("expected no partition after the peer came back, got %+v", msg)
+	}
+}
@@ -0,0 +1,124 @@
+package healthmonitor
+
+import (
+	"math"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+// windowSize is the number of inter-arrival times kept per peer
+const windowSize = 100
+
+// minSamples is the number of inter-arrival times needed before the suspicion level is calculated.
+// Until then, only the Timeout decides if a peer is dead.
+const minSamples = 5
+
+// minStdDeviation bounds the standard deviation of the inter-arrival times from below.
+// Otherwise, a peer with very regular heartbeats would be suspected after a tiny delay.
+const minStdDeviation = time.Millisecond * 100
+
+// phiDetector is an adaptive failure detector based on the phi accrual failure detector.
+//
+// Instead of a fixed timeout, it learns the distribution of the inter-arrival times of the heartbeats
+// of each peer and calculates the suspicion level phi. A phi of 1 means that there is a 10% chance
+// that the peer is still alive and sends a heartbeat later, a phi of 2 means 1%, a phi of 3 means 0.1%, and so on.
+// On a lossy link the distribution widens, so the suspicion rises slower than on a reliable link.
+type phiDetector struct {
+	suspectThreshold float64
+	deadThreshold    float64
+	windows          map[elevator.Id]*arrivalWindow
+}
+
+func newPhiDetector(suspectThreshold, deadThreshold float64) *phiDetector {
+	return &phiDetector{
+		suspectThreshold: suspectThreshold,
+		deadThreshold:    deadThreshold,
+		windows:          make(map[elevator.Id]*arrivalWindow),
+	}
+}
+
+// heartbeat registers a heartbeat of the peer at the given time
+func (d *phiDetector) heartbeat(id elevator.Id, t time.Time) {
+	w, ok := d.windows[id]
+	if !ok {
+		w = &arrivalWindow{}
+		d.windows[id] = w
+	}
+	w.add(t)
+}
+
+// evaluate calculates the suspicion level of every peer and returns which peers are suspected and dead
+//
+// A dead peer is not part of the suspected peers.
+func (d *phiDetector) evaluate(now time.Time) (suspected map[elevator.Id]bool, dead map[elevator.Id]bool) {
+	suspected = make(map[elevator.Id]bool)
+	dead = make(map[elevator.Id]bool)
+
+	for id, w := range d.windows {
+		phi := w.phi(now)
+		if phi >= d.deadThreshold {
+			dead[id] = true
+		} else if phi >= d.suspectThreshold {
+			suspected[id] = true
+		}
+	}
+	return suspected, dead
+}
+
+// arrivalWindow stores the latest inter-arrival times of the heartbeats of one peer
+type arrivalWindow struct {
+	intervals []time.Duration
+	last      time.Time
+}
+
+// add registers a heartbeat and stores the time since the previous heartbeat
+//
+// Intervals longer than the Timeout are not stored, as the peer was considered dead in between.
+// Storing them would make the detector too tolerant after the peer returns.
+func (w *arrivalWindow) add(t time.Time) {
+	if !w.last.IsZero() {
+		interval := t.Sub(w.last)
+		if interval < Timeout {
+			w.intervals = append(w.intervals, interval)
+			if len(w.intervals) > windowSize {
+				w.intervals = w.intervals[1:]
+			}
+		}
+	}
+	w.last = t
+}
+
+// phi calculates the suspicion level given the time since the last heartbeat
+//
+// The inter-arrival times are assumed to be normally distributed.
+// The logistic approximation of the cumulative distribution function is used to avoid numeric issues.
+func (w *arrivalWindow) phi(now time.Time) float64 {
+	if len(w.intervals) < minSamples {
+		return 0
+	}
+
+	mean, std := w.statistics()
+	y := (now.Sub(w.last).Seconds() - mean) / std
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+
+	if y > 0 {
+		return -math.Log10(e / (1 + e))
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
+
+// statistics returns the mean and standard deviation of the intervals in seconds
+func (w *arrivalWindow) statistics() (mean, std float64) {
+	for _, i := range w.intervals {
+		mean += i.Seconds()
+	}
+	mean /= float64(len(w.intervals))
+
+	for _, i := range w.intervals {
+		std += (i.Seconds() - mean) * (i.Seconds() - mean)
+	}
+	std = math.Sqrt(std / float64(len(w.intervals)))
+
+	return mean, math.Max(std, minStdDeviation.Seconds())
+}
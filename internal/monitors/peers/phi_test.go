@@ -0,0 +1,54 @@
+package healthmonitor
+
+import (
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+func TestPhiDetector(t *testing.T) {
+	peerID := elevator.Id(1)
+	start := time.Now()
+
+	tests := []struct {
+		name      string
+		silence   time.Duration
+		suspected bool
+		dead      bool
+	}{
+		{name: "Heartbeat on time", silence: time.Millisecond * 100, suspected: false, dead: false},
+		{name: "Heartbeat late", silence: time.Millisecond * 500, suspected: true, dead: false},
+		{name: "Heartbeats stopped", silence: time.Second * 2, suspected: false, dead: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newPhiDetector(DefaultSuspectThreshold, DefaultDeadThreshold)
+			last := start
+			for i := 0; i < 20; i++ {
+				last = start.Add(time.Duration(i) * time.Millisecond * 100)
+				d.heartbeat(peerID, last)
+			}
+
+			suspected, dead := d.evaluate(last.Add(tt.silence))
+			if suspected[peerID] != tt.suspected {
+				t.Errorf("expected suspected to be %v, got %v", tt.suspected, suspected[peerID])
+			}
+			if dead[peerID] != tt.dead {
+				t.Errorf("expected dead to be %v, got %v", tt.dead, dead[peerID])
+			}
+		})
+	}
+}
+
+func TestPhiDetectorNotEnoughSamples(t *testing.T) {
+	d := newPhiDetector(DefaultSuspectThreshold, DefaultDeadThreshold)
+	now := time.Now()
+	d.heartbeat(1, now)
+
+	suspected, dead := d.evaluate(now.Add(Timeout / 2))
+	if suspected[1] || dead[1] {
+		t.Errorf("expected no suspicion without enough samples, got suspected %v and dead %v", suspected[1], dead[1])
+	}
+}
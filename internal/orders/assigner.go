@@ -17,8 +17,8 @@ func getBasePath() string {
 	return filepath.Dir(b)
 }
 
-// Path to the hall_request_assigner executable
-var pathToAssigner = filepath.Join(getBasePath(), "../../external/assigner/hall_request_assigner")
+// Path to the hall_request_assigner executable that is used if no other assigner is configured
+var defaultAssigner = filepath.Join(getBasePath(), "../../external/assigner/hall_request_assigner")
 
 // jsonState struct is used for json marshalling and unmarshaling
 type jsonState = struct {
@@ -45,16 +45,17 @@ var behaviorToString = map[elevator.Behavior]string{
 
 // calculateOrders calculates the orders for the elevators
 //
-// It sends the state of the system to the hall_request_assigner executable and returns the orders.
+// It sends the state of the system to the assigner executable and returns the orders.
+// The assigner must accept the same arguments and produce the same output as the hall_request_assigner.
 // This approach is used to avoid having to implement the assigner logic in Go which would lead to code duplication and potential bugs.
-func calculateOrders(hr hallRequests, cr map[elevator.Id]cabRequests, elevators map[elevator.Id]elevator.State) map[elevator.Id]elevator.Order {
+func calculateOrders(assigner string, hr hallRequests, cr map[elevator.Id]cabRequests, elevators map[elevator.Id]elevator.State) map[elevator.Id]elevator.Order {
 	if len(elevators) == 0 {
 		log.Fatalf("[orderserver] [assigner] crashed due to a illegal call to calculate Orders")
 	}
 
 	jsonState := marshal(hr, cr, elevators)
 
-	cmd := exec.Command(pathToAssigner, "-i", jsonState, "--includeCab")
+	cmd := exec.Command(assigner, "-i", jsonState, "--includeCab")
 
 	out, err := cmd.Output()
 	if err != nil {
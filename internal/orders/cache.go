@@ -2,8 +2,11 @@ package orders
 
 import (
 	"log"
+	"reflect"
+	"sort"
 
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
 	"group48.ttk4145.ntnu/elevators/internal/models/request"
 )
 
@@ -13,14 +16,26 @@ type hallRequests = [elevator.NumFloors][2]bool
 // cabRequests is an array of booleans, where the index is the floor.
 type cabRequests = [elevator.NumFloors]bool
 
+// destinationRequests is a set of the confirmed destination calls.
+type destinationRequests = map[request.Destination]bool
+
 // cache stores the latest requests, elevator states and alive information
 type cache struct {
 	Local elevator.Id
 
 	Hr         hallRequests
 	Cr         map[elevator.Id]cabRequests
+	Dr         destinationRequests
 	States     map[elevator.Id]elevator.State
 	AlivePeers map[elevator.Id]bool
+
+	// Suspected contains the alive peers that are suspected to have died.
+	// Their information is kept, but they are excluded from the order calculations.
+	Suspected map[elevator.Id]bool
+
+	// ServesHallCalls is false if the partition policy forbids serving hall calls in the current partition.
+	// The hall calls are kept, but excluded from the order calculations.
+	ServesHallCalls bool
 }
 
 func newCache(local elevator.Id) *cache {
@@ -28,54 +43,78 @@ func newCache(local elevator.Id) *cache {
 		Local:      local,
 		Hr:         hallRequests{},
 		Cr:         make(map[elevator.Id]cabRequests),
+		Dr:         make(destinationRequests),
 		States:     make(map[elevator.Id]elevator.State),
 		AlivePeers: make(map[elevator.Id]bool),
+		Suspected:  make(map[elevator.Id]bool),
+
+		ServesHallCalls: true,
 	}
 }
 
 // AddRequest adds a request to the cache and returns true if the cache changed
-func (c *cache) AddRequest(req request.Request) {
+func (c *cache) AddRequest(req request.Request) bool {
 	status := req.Status == request.Confirmed
 
-	if request.IsFromHall(req) {
-		c.addHallRequest(req.Origin.GetFloor(), req.Origin.(request.Hall).Direction, status)
-	} else {
-		// Must be a cab request
-		c.addCabRequest(req.Origin.(request.Cab).Id, req.Origin.GetFloor(), status)
+	switch o := req.Origin.(type) {
+	case request.Hall:
+		return c.addHallRequest(o.Floor, o.Direction, status)
+	case request.Destination:
+		return c.addDestinationRequest(o, status)
+	case request.Cab:
+		return c.addCabRequest(o.Id, o.Floor, status)
 	}
+	return false
 }
 
-// addHallRequest adds a hall request to the cache
-func (c *cache) addHallRequest(floor elevator.Floor, direction request.Direction, status bool) {
+// addHallRequest adds a hall request to the cache and returns true if the cache changed
+func (c *cache) addHallRequest(floor elevator.Floor, direction request.Direction, status bool) bool {
 	if c.Hr[floor][direction] == status {
-		return
+		return false
 	}
 
 	c.Hr[floor][direction] = status
 	log.Printf("[orderserver] [cache] Changed cached hall request status for floor %v and direction %v:\n\t%v -> %v", floor, direction, !status, status)
+	return true
+}
+
+// addDestinationRequest adds a destination request to the cache and returns true if the cache changed
+func (c *cache) addDestinationRequest(d request.Destination, status bool) bool {
+	if c.Dr[d] == status {
+		return false
+	}
+
+	if status {
+		c.Dr[d] = true
+	} else {
+		delete(c.Dr, d)
+	}
+	log.Printf("[orderserver] [cache] Changed cached destination request status for %v:\n\t%v -> %v", d, !status, status)
+	return true
 }
 
 // addCabRequest adds a cab request to the cache and returns true if the cache changed
-func (c *cache) addCabRequest(id elevator.Id, floor elevator.Floor, status bool) {
+func (c *cache) addCabRequest(id elevator.Id, floor elevator.Floor, status bool) bool {
 	cr, ok := c.Cr[id]
 	if !ok {
 		cr = cabRequests{}
 	}
 
 	if cr[floor] == status {
-		return
+		return false
 	}
 
 	cr[floor] = status
 	c.Cr[id] = cr
 
 	log.Printf("[orderserver] [cache] Changed cached cab request status for elevator %v and floor %v:\n\t%v -> %v", id, floor, !status, status)
+	return true
 }
 
 // AddElevatorState adds an elevator state to the cache and returns true if the cache changed
-func (c *cache) AddElevatorState(id elevator.Id, state elevator.State) {
+func (c *cache) AddElevatorState(id elevator.Id, state elevator.State) bool {
 	if s, ok := c.States[id]; ok && s == state {
-		return
+		return false
 	}
 
 	if _, ok := c.Cr[id]; !ok {
@@ -91,6 +130,7 @@ func (c *cache) AddElevatorState(id elevator.Id, state elevator.State) {
 	oldState := c.States[id]
 	c.States[id] = state
 	log.Printf("[orderserver] [cache] Changed cached elevator state for elevator %v:\n\t%v", id, oldState.DiffString(state))
+	return true
 }
 
 // ProcessAliveUpdate updates the cache with the latest alive information
@@ -98,11 +138,16 @@ func (c *cache) AddElevatorState(id elevator.Id, state elevator.State) {
 // If a peer is no longer alive, the peer is removed from the cache.
 // This includes removing the peer's elevator state, cab requests and alive status.
 // This ensures that the peer is not included anymore in the order calculations.
-func (c *cache) ProcessAliveUpdate(alive []elevator.Id) {
+// It returns true if the cache changed.
+func (c *cache) ProcessAliveUpdate(alive []elevator.Id) bool {
+	changed := false
 	newAlive := make(map[elevator.Id]bool)
 	for _, id := range alive {
 		newAlive[id] = true
-		c.AlivePeers[id] = true
+		if !c.AlivePeers[id] {
+			c.AlivePeers[id] = true
+			changed = true
+		}
 	}
 
 	// Check if a peer died
@@ -114,8 +159,99 @@ func (c *cache) ProcessAliveUpdate(alive []elevator.Id) {
 			delete(c.Cr, id)
 			delete(c.AlivePeers, id)
 			log.Printf("[orderserver] [cache] Removed peer %v from cache as it died", id)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// ProcessSuspectedUpdate updates the cache with the latest suspected peers and returns true if the cache changed
+//
+// The local peer is never suspected, as its information is always available.
+func (c *cache) ProcessSuspectedUpdate(suspected []elevator.Id) bool {
+	newSuspected := make(map[elevator.Id]bool)
+	for _, id := range suspected {
+		if id != c.Local {
+			newSuspected[id] = true
 		}
 	}
+
+	if reflect.DeepEqual(newSuspected, c.Suspected) {
+		return false
+	}
+
+	log.Printf("[orderserver] [cache] Changed suspected peers: %v -> %v", c.Suspected, newSuspected)
+	c.Suspected = newSuspected
+	return true
+}
+
+// ProcessPartitionUpdate stores whether hall calls are served in the current partition
+// and returns true if the cache changed
+func (c *cache) ProcessPartitionUpdate(servesHallCalls bool) bool {
+	if c.ServesHallCalls == servesHallCalls {
+		return false
+	}
+
+	log.Printf("[orderserver] [cache] Changed serving of hall calls: %v -> %v", c.ServesHallCalls, servesHallCalls)
+	c.ServesHallCalls = servesHallCalls
+	return true
+}
+
+// HallCalculationInput returns the hall and destination requests that take part in the order calculation
+//
+// If hall calls are not served in the current partition, no hall or destination requests are returned.
+func (c *cache) HallCalculationInput() (hallRequests, destinationRequests) {
+	if !c.ServesHallCalls {
+		return hallRequests{}, make(destinationRequests)
+	}
+	return c.Hr, c.Dr
+}
+
+// CalculationInput returns the cab requests and elevator states that take part in the order calculation
+//
+// Suspected peers are excluded, so that their hall calls are reassigned to the other elevators.
+// Initializing elevators are excluded as well, as their position is not known yet.
+func (c *cache) CalculationInput() (map[elevator.Id]cabRequests, map[elevator.Id]elevator.State) {
+	cr := make(map[elevator.Id]cabRequests)
+	states := make(map[elevator.Id]elevator.State)
+	for id, s := range c.States {
+		if c.Suspected[id] || s.Behavior == elevator.Initializing {
+			continue
+		}
+		cr[id] = c.Cr[id]
+		states[id] = s
+	}
+	return cr, states
+}
+
+// ClusterState returns a copy of the elevator states and alive peers together with the orders
+func (c *cache) ClusterState(orders map[elevator.Id]elevator.Order, boardings map[request.Destination]elevator.Id) message.ClusterState {
+	cs := message.ClusterState{
+		States:    make(map[elevator.Id]elevator.State, len(c.States)),
+		Alive:     make([]elevator.Id, 0, len(c.AlivePeers)),
+		Suspected: make([]elevator.Id, 0, len(c.Suspected)),
+		Orders:    make(map[elevator.Id]elevator.Order, len(orders)),
+		Boardings: make(map[request.Destination]elevator.Id, len(boardings)),
+	}
+	for id, s := range c.States {
+		cs.States[id] = s
+	}
+	for id := range c.AlivePeers {
+		cs.Alive = append(cs.Alive, id)
+	}
+	for id := range c.Suspected {
+		cs.Suspected = append(cs.Suspected, id)
+	}
+	for id, o := range orders {
+		cs.Orders[id] = o
+	}
+	for d, id := range boardings {
+		cs.Boardings[d] = id
+	}
+	sort.Slice(cs.Alive, func(i, j int) bool { return cs.Alive[i] < cs.Alive[j] })
+	sort.Slice(cs.Suspected, func(i, j int) bool { return cs.Suspected[i] < cs.Suspected[j] })
+	return cs
 }
 
 // IsConsistent checks if the cache is consistent
@@ -0,0 +1,74 @@
+package orders
+
+import (
+	"log"
+	"sort"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// withDestinations merges the pickup floors of the destination calls into the hall requests
+//
+// A destination call is picked up like a hall call in the direction of travel.
+// This lets the hall_request_assigner distribute the pickups together with the hall calls.
+func withDestinations(hr hallRequests, dr destinationRequests) hallRequests {
+	for d := range dr {
+		if d.From == d.To {
+			continue
+		}
+		hr[d.From][d.Direction()] = true
+	}
+	return hr
+}
+
+// assignDestinations decides which elevator a passenger with a destination call should board
+//
+// The elevator that was assigned the pickup (the hall call at the pickup floor in the direction of travel)
+// is the elevator to board. If multiple elevators are assigned the same pickup, the lowest id is chosen
+// so that all peers decide on the same elevator.
+func assignDestinations(dr destinationRequests, orders map[elevator.Id]elevator.Order) map[request.Destination]elevator.Id {
+	ids := make([]elevator.Id, 0, len(orders))
+	for id := range orders {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	assigned := make(map[request.Destination]elevator.Id)
+	for d := range dr {
+		for _, id := range ids {
+			if orders[id][d.From][d.GetButtonType()] {
+				assigned[d] = id
+				break
+			}
+		}
+	}
+	return assigned
+}
+
+// destinationsOf returns the destination calls the given elevator should pick up
+func destinationsOf(id elevator.Id, assigned map[request.Destination]elevator.Id) []request.Destination {
+	ds := make([]request.Destination, 0)
+	for d, e := range assigned {
+		if e == id {
+			ds = append(ds, d)
+		}
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].From != ds[j].From {
+			return ds[i].From < ds[j].From
+		}
+		return ds[i].To < ds[j].To
+	})
+	return ds
+}
+
+// logChangedBoardings logs which elevator to board for destination calls with a changed assignment
+func logChangedBoardings(oldAssigned, newAssigned map[request.Destination]elevator.Id) {
+	for d, id := range newAssigned {
+		if oldId, ok := oldAssigned[d]; ok && oldId == id {
+			continue
+		}
+		log.Printf("[orderserver] Destination call %v: board elevator %v", d, id)
+	}
+}
@@ -0,0 +1,81 @@
+package orders
+
+import (
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// travelDuration is the expected time it takes an elevator to travel between two adjacent floors
+const travelDuration = time.Millisecond * 2500
+
+// maxSimulationSteps bounds the simulation of an elevator in case of an inconsistent state
+const maxSimulationSteps = int(elevator.NumFloors) * 4
+
+// hallCall identifies a hall call by its floor and direction
+type hallCall struct {
+	Floor     elevator.Floor
+	Direction request.Direction
+}
+
+// estimateArrivals estimates when the elevator arrives at each hall call of its order
+//
+// The elevator is simulated from its current state until it has served all orders.
+// The simulation uses the same order logic as the [driver] module, see [elevator.ChooseDirection],
+// [elevator.ShouldStop] and [elevator.ClearAtCurrentFloor]. The returned durations are relative to now.
+func estimateArrivals(s elevator.State, o elevator.Order) map[hallCall]time.Duration {
+	etas := make(map[hallCall]time.Duration)
+	e := s
+	var t time.Duration
+
+	switch e.Behavior {
+	case elevator.Idle:
+		e.Direction, e.Behavior = elevator.ChooseDirection(e, o)
+		if e.Behavior == elevator.Idle {
+			return etas
+		}
+	case elevator.Moving:
+		t += travelDuration / 2
+		e.Floor += elevator.Floor(e.Direction)
+	case elevator.DoorOpen:
+		t -= elevator.DoorOpenDuration / 2
+	}
+
+	for i := 0; i < maxSimulationSteps; i++ {
+		if e.Floor < 0 || e.Floor >= elevator.NumFloors {
+			// The state is inconsistent, the estimates found so far are returned
+			return etas
+		}
+
+		if elevator.ShouldStop(e, o) {
+			arrival := max(t, 0)
+			served := o
+			elevator.ClearAtCurrentFloor(e, &o, func(btn elevator.ButtonType) {
+				if !served[e.Floor][btn] {
+					return
+				}
+				switch btn {
+				case elevator.HallUp:
+					etas[hallCall{Floor: e.Floor, Direction: request.Up}] = arrival
+				case elevator.HallDown:
+					etas[hallCall{Floor: e.Floor, Direction: request.Down}] = arrival
+				}
+			})
+			t += elevator.DoorOpenDuration
+			e.Direction, e.Behavior = elevator.ChooseDirection(e, o)
+			switch e.Behavior {
+			case elevator.Idle:
+				return etas
+			case elevator.DoorOpen:
+				// The door is opened again to serve the remaining orders at this floor
+				continue
+			}
+		}
+
+		e.Floor += elevator.Floor(e.Direction)
+		t += travelDuration
+	}
+
+	return etas
+}
@@ -0,0 +1,74 @@
+package orders
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+func Test_estimateArrivals(t *testing.T) {
+	tests := []struct {
+		name  string
+		state elevator.State
+		order elevator.Order
+		want  map[hallCall]time.Duration
+	}{
+		{
+			name:  "Idle without orders",
+			state: elevator.State{Floor: 0, Behavior: elevator.Idle, Direction: elevator.Stop},
+			order: elevator.Order{},
+			want:  map[hallCall]time.Duration{},
+		},
+		{
+			name:  "Idle with hall call two floors above",
+			state: elevator.State{Floor: 0, Behavior: elevator.Idle, Direction: elevator.Stop},
+			order: elevator.Order{2: {true, false, false}},
+			want: map[hallCall]time.Duration{
+				{Floor: 2, Direction: request.Up}: 2 * travelDuration,
+			},
+		},
+		{
+			name:  "Idle with hall call at current floor",
+			state: elevator.State{Floor: 1, Behavior: elevator.Idle, Direction: elevator.Stop},
+			order: elevator.Order{1: {false, true, false}},
+			want: map[hallCall]time.Duration{
+				{Floor: 1, Direction: request.Down}: 0,
+			},
+		},
+		{
+			name:  "Moving up with cab stop before hall call",
+			state: elevator.State{Floor: 0, Behavior: elevator.Moving, Direction: elevator.Up},
+			order: elevator.Order{1: {false, false, true}, 3: {false, true, false}},
+			want: map[hallCall]time.Duration{
+				{Floor: 3, Direction: request.Down}: travelDuration/2 + elevator.DoorOpenDuration + 2*travelDuration,
+			},
+		},
+		{
+			name:  "Door open turns around for hall call below",
+			state: elevator.State{Floor: 2, Behavior: elevator.DoorOpen, Direction: elevator.Stop},
+			order: elevator.Order{0: {true, false, false}},
+			want: map[hallCall]time.Duration{
+				{Floor: 0, Direction: request.Up}: elevator.DoorOpenDuration/2 + 2*travelDuration,
+			},
+		},
+		{
+			name:  "Door reopens for hall call in opposite direction",
+			state: elevator.State{Floor: 1, Behavior: elevator.Moving, Direction: elevator.Up},
+			order: elevator.Order{2: {true, true, false}},
+			want: map[hallCall]time.Duration{
+				{Floor: 2, Direction: request.Up}:   travelDuration / 2,
+				{Floor: 2, Direction: request.Down}: travelDuration/2 + elevator.DoorOpenDuration,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateArrivals(tt.state, tt.order); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("estimateArrivals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
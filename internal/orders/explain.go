@@ -0,0 +1,95 @@
+package orders
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+)
+
+// Reasons why a hall call was assigned to an elevator
+const (
+	// reasonOnlyCandidate is given when only one elevator could be assigned the hall call
+	reasonOnlyCandidate = "only candidate"
+	// reasonLowestCost is given when the assigned elevator has the lowest estimated arrival
+	reasonLowestCost = "lowest estimated arrival"
+	// reasonTotalCost is given when another elevator arrives earlier, but the hall_request_assigner
+	// found a lower total cost when considering all hall calls together
+	reasonTotalCost = "lowest total cost of all hall calls"
+	// reasonKept is given when the hall call was kept with the previously assigned elevator by the hysteresis
+	reasonKept = "kept by hysteresis"
+)
+
+// explainAssignments calculates the cost of every candidate elevator for each assigned hall call
+//
+// The cost of a candidate is the estimated arrival at the hall call if the hall call is added to its order.
+// The kept hall calls are those the stabilizer moved back to their previously assigned elevator.
+func explainAssignments(
+	orders map[elevator.Id]elevator.Order,
+	states map[elevator.Id]elevator.State,
+	kept map[hallCall]bool,
+	reassignments map[hallCall]int,
+) []message.AssignmentDecision {
+	assigned := assignedHallCalls(orders)
+	decisions := make([]message.AssignmentDecision, 0, len(assigned))
+
+	for _, hc := range sortedHallCalls(assigned) {
+		winner := assigned[hc]
+		decision := message.AssignmentDecision{
+			Floor:         hc.Floor,
+			Direction:     hc.Direction,
+			Elevator:      winner,
+			Reassignments: reassignments[hc],
+			Candidates:    make([]message.CandidateCost, 0, len(orders)),
+		}
+
+		winnerCost, _ := hallCallCost(hc, states[winner], orders[winner])
+		isLowest := true
+		for id, o := range orders {
+			cost, ok := hallCallCost(hc, states[id], withHallCall(o, hc))
+			if !ok {
+				continue
+			}
+			decision.Candidates = append(decision.Candidates, message.CandidateCost{Elevator: id, Cost: cost})
+			if id != winner && cost < winnerCost {
+				isLowest = false
+			}
+		}
+		sort.Slice(decision.Candidates, func(i, j int) bool {
+			return decision.Candidates[i].Elevator < decision.Candidates[j].Elevator
+		})
+
+		switch {
+		case kept[hc]:
+			decision.Reason = reasonKept
+		case len(decision.Candidates) == 1:
+			decision.Reason = reasonOnlyCandidate
+		case isLowest:
+			decision.Reason = reasonLowestCost
+		default:
+			decision.Reason = reasonTotalCost
+		}
+
+		decisions = append(decisions, decision)
+	}
+
+	return decisions
+}
+
+// logDecisions logs the assignment decisions with one line per hall call in a key=value format
+func logDecisions(decisions []message.AssignmentDecision) {
+	msg := "[orderserver] [decisions] Assignment decisions:\n"
+	for _, d := range decisions {
+		costs := make([]string, 0, len(d.Candidates))
+		for _, c := range d.Candidates {
+			costs = append(costs, fmt.Sprintf("%v:%v", c.Elevator, c.Cost.Round(time.Millisecond*100)))
+		}
+		msg += fmt.Sprintf("\tfloor=%v direction=%v elevator=%v reason=%q reassignments=%v costs=[%v]\n",
+			d.Floor, d.Direction, d.Elevator, d.Reason, d.Reassignments, strings.Join(costs, " "))
+	}
+	log.Print(msg)
+}
@@ -2,6 +2,7 @@
 package orders
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"reflect"
@@ -9,64 +10,210 @@ import (
 
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
 	"group48.ttk4145.ntnu/elevators/internal/models/request"
 )
 
 // orderRefreshRate is the rate at which the order server will redistribute orders
-// using the latest information from the cache
+// using the latest information from the cache.
+// It is a safety net, as the orders are also recalculated whenever relevant information changes.
 const orderRefreshRate = time.Millisecond * 2000
 
+// orderCoalesceDelay is the time the order server waits after a change before recalculating the orders.
+// Changes that arrive within the delay are coalesced into a single calculation,
+// which bounds the rate at which the hall_request_assigner is executed.
+const orderCoalesceDelay = time.Millisecond * 50
+
 // RunOrderServer is the main function for the order module and should be run as a goroutine
 //
 // The server listens for validated requests, elevator states, alive status updates and
-// stores them in a cache. The server then calculates the orders based on the cache and
-// sends the local orders to the elevator driver.
+// stores them in a cache. Whenever the cache changes, the server calculates the orders based on the cache and
+// sends the local orders to the elevator driver. In addition, the orders are recalculated periodically.
+// With every calculation, the estimated arrival for each hall call is sent to comms to be shared with the peers.
+// A hall call stays with its previously assigned elevator unless another elevator arrives
+// earlier by more than the hysteresis margin. The previously assigned elevator is the one that claimed
+// the hall call in its shared estimates, which are received from the peers through comms.
+// The local orders are also sent to the process pair, so that a backup process can continue serving them.
+// The partition policy decides whether hall calls are served while the network is partitioned.
+// A confirmed hall call that is not served within the stale threshold raises an alarm.
+// The elevator assigned to it gives it up, and all peers move it to another elevator once they receive the estimates.
+// The orders are calculated by the assigner executable, or by the hall_request_assigner of the repo if empty.
+// If explain is set, the cost of every candidate elevator for each hall call is logged and sent to the api.
+// With every calculation, the elevator states, alive peers and orders of all elevators are sent to the api as well,
+// together with the elevator each passenger with a destination call should board.
 func RunOrderServer(
+	ctx context.Context,
 	localPeerId elevator.Id,
+	assigner string,
+	hysteresis time.Duration,
+	explain bool,
+	staleThreshold time.Duration,
+	policy partition.Policy,
 	requestUpdate <-chan message.RequestState,
 	stateUpdate <-chan message.ElevatorState,
+	peerEstimateUpdate <-chan message.PeerEstimates,
 	aliveListUpdate <-chan message.ActivePeers,
 	orderUpdates chan<- message.ServiceOrder,
+	orderBackups chan<- message.ServiceOrder,
+	estimateUpdates chan<- message.HallCallEstimates,
+	decisionUpdates chan<- message.AssignmentDecisions,
+	staleUpdates chan<- message.StaleCalls,
+	clusterUpdates chan<- message.ClusterState,
 ) {
 
+	if assigner == "" {
+		assigner = defaultAssigner
+	}
+	log.Printf("[orderserver] Calculating the orders with %v", assigner)
+
 	// cache stores the latest requests, elevator states and alive information
 	cache := newCache(localPeerId)
 	// old orders stores the last calculated orders and is used to check if the orders have changed
 	oldOrders := make(map[elevator.Id]elevator.Order)
+	// old boardings stores which elevator each destination call should board
+	oldBoardings := make(map[request.Destination]elevator.Id)
+	// old estimates stores the last estimated arrivals and is used to check if the hall display must be updated
+	oldEstimates := make([]message.HallCallEstimate, 0)
+	// old decisions stores the last explained assignments and is used to only log changed decisions
+	oldDecisions := make([]message.AssignmentDecision, 0)
+	// stabilizer keeps hall calls with their previously assigned elevator
+	stabilizer := newAssignmentStabilizer(hysteresis)
+	// claims stores the hall calls each elevator assigned to itself in its shared estimates
+	claims := make(assignmentClaims)
+	// waits measures the wait time of the hall calls to compare it to the estimates
+	waits := newWaitTracker()
+	// watchdog raises alarms for hall calls that are not served in time and reassigns them
+	watchdog := newStaleWatchdog(localPeerId, staleThreshold)
 	// orderRefresh is a ticker that will trigger the order server to recalculate orders
 	orderRefresh := time.NewTicker(orderRefreshRate)
+	// coalesce is a timer that triggers the recalculation after the cache changed
+	coalesce := time.NewTimer(orderCoalesceDelay)
+	coalesce.Stop()
+	isRecalculationPending := false
+
+	// scheduleRecalculation starts the coalesce timer if the cache changed and no recalculation is pending
+	scheduleRecalculation := func(changed bool) {
+		if !changed || isRecalculationPending {
+			return
+		}
+		coalesce.Reset(orderCoalesceDelay)
+		isRecalculationPending = true
+	}
+
+	// recalculate returns early if the context is done while sending the results to the other modules
+	recalculate := func() {
+		if !cache.IsConsistent() || len(cache.AlivePeers) == 0 {
+			return
+		}
+		hr, dr := cache.HallCalculationInput()
+		cr, states := cache.CalculationInput()
+		if len(states) == 0 {
+			// No elevator can take part in the calculation, e.g. because all are initializing
+			return
+		}
+		newOrders := calculateOrders(assigner, withDestinations(hr, dr), cr, states)
+		newOrders, kept := stabilizer.Stabilize(claims.Previous(states), newOrders, states)
+		watchdog.Enforce(newOrders, states, time.Now())
+		select {
+		case staleUpdates <- watchdog.StaleCalls(newOrders, states, time.Now()):
+		case <-ctx.Done():
+			return
+		}
+		newBoardings := assignDestinations(dr, newOrders)
+		select {
+		case clusterUpdates <- cache.ClusterState(newOrders, newBoardings):
+		case <-ctx.Done():
+			return
+		}
+
+		if explain {
+			newDecisions := explainAssignments(newOrders, states, kept, stabilizer.reassignments)
+			select {
+			case decisionUpdates <- message.AssignmentDecisions{Decisions: newDecisions}:
+			case <-ctx.Done():
+				return
+			}
+			if !reflect.DeepEqual(newDecisions, oldDecisions) {
+				logDecisions(newDecisions)
+				oldDecisions = newDecisions
+			}
+		}
+
+		newEstimates := estimateHallCalls(newOrders, states)
+		waits.ProcessEstimates(newEstimates, time.Now())
+		select {
+		case estimateUpdates <- message.HallCallEstimates{Estimates: newEstimates, Abandoned: watchdog.Abandoned()}:
+		case <-ctx.Done():
+			return
+		}
+		// The local claims are updated with the estimates the peers receive, so that all peers use the same claims
+		claims.Update(localPeerId, newEstimates)
+		if !reflect.DeepEqual(newEstimates, oldEstimates) {
+			logHallDisplay(newEstimates)
+			oldEstimates = newEstimates
+		}
+
+		if reflect.DeepEqual(newOrders, oldOrders) && reflect.DeepEqual(newBoardings, oldBoardings) {
+			// Orders have not changed, no need to send an update to the elevator driver
+			return
+		}
+
+		logChangedOrders(oldOrders, newOrders)
+		logChangedBoardings(oldBoardings, newBoardings)
+		localOrder := message.ServiceOrder{
+			Order:        newOrders[localPeerId],
+			Destinations: destinationsOf(localPeerId, newBoardings),
+		}
+		select {
+		case orderUpdates <- localOrder:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case orderBackups <- localOrder:
+		case <-ctx.Done():
+			return
+		}
+
+		oldOrders = newOrders
+		oldBoardings = newBoardings
+	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			log.Printf("[orderserver] Shutting down")
+			return
+
 		case msg := <-requestUpdate:
 			isUnRelevant := msg.Request.Status == request.Unconfirmed || msg.Request.Status == request.Unknown
 			if isUnRelevant {
 				continue
 			}
-			cache.AddRequest(msg.Request)
+			waits.ProcessRequest(msg.Request, time.Now())
+			watchdog.ProcessRequest(msg.Request, time.Now())
+			scheduleRecalculation(cache.AddRequest(msg.Request))
 
 		case msg := <-aliveListUpdate:
-			cache.ProcessAliveUpdate(msg.Peers)
+			aliveChanged := cache.ProcessAliveUpdate(msg.Peers)
+			suspectedChanged := cache.ProcessSuspectedUpdate(msg.Suspected)
+			partitionChanged := cache.ProcessPartitionUpdate(policy.ServesHallCalls(msg.Partitioned, msg.InMajority))
+			scheduleRecalculation(aliveChanged || suspectedChanged || partitionChanged)
 
 		case msg := <-stateUpdate:
-			cache.AddElevatorState(msg.Elevator, msg.State)
+			scheduleRecalculation(cache.AddElevatorState(msg.Elevator, msg.State))
 
-		case <-orderRefresh.C:
-			if !cache.IsConsistent() || len(cache.AlivePeers) == 0 {
-				continue
-			}
-			newOrders := calculateOrders(cache.Hr, cache.Cr, cache.States)
-			if reflect.DeepEqual(newOrders, oldOrders) {
-				// Orders have not changed, no need to send an update to the elevator driver
-				continue
-			}
+		case msg := <-peerEstimateUpdate:
+			claimsChanged := claims.Update(msg.Source, msg.Estimates)
+			abandonedChanged := watchdog.UpdateAbandoned(msg.Source, msg.Abandoned)
+			scheduleRecalculation(claimsChanged || abandonedChanged)
 
-			logChangedOrders(oldOrders, newOrders)
-			orderUpdates <- message.ServiceOrder{
-				Order: newOrders[localPeerId],
-			}
+		case <-coalesce.C:
+			isRecalculationPending = false
+			recalculate()
 
-			oldOrders = newOrders
+		case <-orderRefresh.C:
+			recalculate()
 		}
 
 	}
@@ -0,0 +1,67 @@
+package orders
+
+import (
+	"fmt"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// CacheReplayer rebuilds the cache of the order server from the replayed decisions of the requests module.
+//
+// The orders cannot be recalculated offline, as the states of the peers are not recorded and the
+// hall_request_assigner is an external program. Instead, the recorded orders are checked against the cache,
+// as every call in an order must stem from a confirmed request.
+type CacheReplayer struct {
+	cache  *cache
+	policy partition.Policy
+}
+
+// NewCacheReplayer creates a replayer with an empty cache
+func NewCacheReplayer(local elevator.Id, policy partition.Policy) *CacheReplayer {
+	return &CacheReplayer{cache: newCache(local), policy: policy}
+}
+
+// AddRequest processes a request sent by the requests module
+func (r *CacheReplayer) AddRequest(req request.Request) {
+	if req.Status == request.Unconfirmed || req.Status == request.Unknown {
+		return
+	}
+	r.cache.AddRequest(req)
+}
+
+// ProcessActivePeers processes an update of the alive peers
+func (r *CacheReplayer) ProcessActivePeers(ap message.ActivePeers) {
+	r.cache.ProcessAliveUpdate(ap.Peers)
+	r.cache.ProcessPartitionUpdate(r.policy.ServesHallCalls(ap.Partitioned, ap.InMajority))
+}
+
+// CheckOrder returns a description of every call in the order of the local elevator that the cache cannot explain
+//
+// The order server runs concurrently with the requests module, so an order may lag behind the cache
+// by a few messages. The findings are therefore hints for an investigation rather than errors.
+func (r *CacheReplayer) CheckOrder(msg message.ServiceOrder) []string {
+	hr, dr := r.cache.HallCalculationInput()
+	hr = withDestinations(hr, dr)
+	cr := r.cache.Cr[r.cache.Local]
+
+	findings := make([]string, 0)
+	for f := elevator.Floor(0); f < elevator.NumFloors; f++ {
+		for _, btn := range []elevator.ButtonType{elevator.HallUp, elevator.HallDown} {
+			if msg.Order[f][btn] && !hr[f][btn] {
+				findings = append(findings, fmt.Sprintf("%v at floor %v is ordered, but not confirmed", btn, f))
+			}
+		}
+		if msg.Order[f][elevator.Cab] && !cr[f] {
+			findings = append(findings, fmt.Sprintf("%v at floor %v is ordered, but not confirmed", elevator.Cab, f))
+		}
+	}
+	for _, d := range msg.Destinations {
+		if !dr[d] {
+			findings = append(findings, fmt.Sprintf("destination %v is boarded, but not confirmed", d))
+		}
+	}
+	return findings
+}
@@ -0,0 +1,210 @@
+package orders
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// assignmentStabilizer prevents hall calls from ping-ponging between elevators
+//
+// The hall_request_assigner calculates the orders from scratch every time.
+// A small change in the state of an elevator can therefore move a hall call to another elevator,
+// which makes the previously assigned elevator turn around halfway to the call.
+// The stabilizer keeps a hall call with the previously assigned elevator unless the
+// newly assigned elevator arrives earlier by more than the margin.
+// The previously assigned elevator is taken from the claims shared by all peers, not from the orders
+// the local peer calculated last, so that all peers keep the same hall calls.
+type assignmentStabilizer struct {
+	// margin is the time the new elevator must be faster to take over a hall call
+	margin time.Duration
+
+	// reassignments counts how often a hall call moved to another elevator while it was active
+	reassignments map[hallCall]int
+}
+
+func newAssignmentStabilizer(margin time.Duration) *assignmentStabilizer {
+	return &assignmentStabilizer{
+		margin:        margin,
+		reassignments: make(map[hallCall]int),
+	}
+}
+
+// Stabilize moves hall calls back to their previous elevator if the new assignment is not better by the margin
+//
+// The previous elevators are given by the shared claims, see [assignmentClaims.Previous].
+// The costs are the estimated arrivals at the hall call. The returned orders are a modified copy of the new orders.
+// The hall calls that were moved back to their previous elevator are returned as well.
+func (s *assignmentStabilizer) Stabilize(
+	previous map[hallCall]elevator.Id,
+	newOrders map[elevator.Id]elevator.Order,
+	states map[elevator.Id]elevator.State,
+) (map[elevator.Id]elevator.Order, map[hallCall]bool) {
+	kept := make(map[hallCall]bool)
+	stable := make(map[elevator.Id]elevator.Order, len(newOrders))
+	for id, o := range newOrders {
+		stable[id] = o
+	}
+
+	current := assignedHallCalls(newOrders)
+
+	for _, hc := range sortedHallCalls(current) {
+		newId := current[hc]
+		oldId, ok := previous[hc]
+		if !ok || oldId == newId {
+			continue
+		}
+		if _, ok := stable[oldId]; !ok {
+			// The previous elevator is no longer part of the calculation, e.g. because it died
+			s.countReassignment(hc, oldId, newId)
+			continue
+		}
+
+		keepCost, canKeep := hallCallCost(hc, states[oldId], withHallCall(stable[oldId], hc))
+		newCost, ok := hallCallCost(hc, states[newId], stable[newId])
+		if !ok && canKeep {
+			// Without an estimate for the new elevator, it cannot be shown to arrive earlier
+			stable[newId] = withoutHallCall(stable[newId], hc)
+			stable[oldId] = withHallCall(stable[oldId], hc)
+			kept[hc] = true
+			log.Printf("[orderserver] [stability] Kept %v with elevator %v (%v), as elevator %v has no estimate",
+				hc, oldId, keepCost.Round(time.Millisecond), newId)
+			continue
+		}
+		if canKeep && keepCost <= newCost+s.margin {
+			stable[newId] = withoutHallCall(stable[newId], hc)
+			stable[oldId] = withHallCall(stable[oldId], hc)
+			kept[hc] = true
+			log.Printf("[orderserver] [stability] Kept %v with elevator %v (%v) instead of elevator %v (%v)",
+				hc, oldId, keepCost.Round(time.Millisecond), newId, newCost.Round(time.Millisecond))
+			continue
+		}
+
+		s.countReassignment(hc, oldId, newId)
+	}
+
+	// Hall calls that are no longer assigned have been served, so their counters start over
+	for hc := range s.reassignments {
+		if _, ok := current[hc]; !ok {
+			delete(s.reassignments, hc)
+		}
+	}
+
+	return stable, kept
+}
+
+// assignmentClaims stores the hall calls each elevator claims, i.e. assigned to itself in the estimates it shared last
+//
+// The estimates are broadcast to all peers, so unlike the orders a peer calculated last,
+// the claims are the same on every peer, whenever it joined or calculated its orders.
+type assignmentClaims map[elevator.Id]map[hallCall]bool
+
+// Update stores the claims in the estimates of the elevator and returns whether they changed
+func (c assignmentClaims) Update(id elevator.Id, estimates []message.HallCallEstimate) bool {
+	claimed := make(map[hallCall]bool)
+	for _, e := range estimates {
+		if e.Elevator == id {
+			claimed[hallCall{Floor: e.Floor, Direction: e.Direction}] = true
+		}
+	}
+	if reflect.DeepEqual(c[id], claimed) {
+		return false
+	}
+	c[id] = claimed
+	return true
+}
+
+// Previous returns the elevator that claims each hall call, considering only the elevators with a state
+//
+// Two elevators may claim the same hall call for a moment after it was reassigned.
+// The elevator with the lowest id is returned then, so that all peers agree.
+func (c assignmentClaims) Previous(states map[elevator.Id]elevator.State) map[hallCall]elevator.Id {
+	ids := make([]elevator.Id, 0, len(c))
+	for id := range c {
+		if _, ok := states[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	previous := make(map[hallCall]elevator.Id)
+	for _, id := range ids {
+		for hc := range c[id] {
+			if _, ok := previous[hc]; !ok {
+				previous[hc] = id
+			}
+		}
+	}
+	return previous
+}
+
+// countReassignment increments and logs the reassignment counter for the hall call
+func (s *assignmentStabilizer) countReassignment(hc hallCall, from, to elevator.Id) {
+	s.reassignments[hc]++
+	log.Printf("[orderserver] [stability] Reassigned %v from elevator %v to elevator %v (reassignments: %v)",
+		hc, from, to, s.reassignments[hc])
+}
+
+// hallCallCost returns the estimated arrival of the elevator at the hall call given its order
+//
+// The second return value is false if the elevator does not serve the hall call with the order.
+func hallCallCost(hc hallCall, state elevator.State, o elevator.Order) (time.Duration, bool) {
+	eta, ok := estimateArrivals(state, o)[hc]
+	return eta, ok
+}
+
+// assignedHallCalls returns which elevator is assigned to each hall call
+func assignedHallCalls(orders map[elevator.Id]elevator.Order) map[hallCall]elevator.Id {
+	assigned := make(map[hallCall]elevator.Id)
+	for id, o := range orders {
+		for f := elevator.Floor(0); f < elevator.NumFloors; f++ {
+			if o[f][elevator.HallUp] {
+				assigned[hallCall{Floor: f, Direction: request.Up}] = id
+			}
+			if o[f][elevator.HallDown] {
+				assigned[hallCall{Floor: f, Direction: request.Down}] = id
+			}
+		}
+	}
+	return assigned
+}
+
+// sortedHallCalls returns the hall calls of the assignment in a deterministic order
+func sortedHallCalls(assigned map[hallCall]elevator.Id) []hallCall {
+	hcs := make([]hallCall, 0, len(assigned))
+	for hc := range assigned {
+		hcs = append(hcs, hc)
+	}
+	sort.Slice(hcs, func(i, j int) bool {
+		if hcs[i].Floor != hcs[j].Floor {
+			return hcs[i].Floor < hcs[j].Floor
+		}
+		return hcs[i].Direction < hcs[j].Direction
+	})
+	return hcs
+}
+
+// buttonOf returns the button type of the hall call
+func (hc hallCall) buttonOf() elevator.ButtonType {
+	if hc.Direction == request.Up {
+		return elevator.HallUp
+	}
+	return elevator.HallDown
+}
+
+// withHallCall returns a copy of the order that includes the hall call
+func withHallCall(o elevator.Order, hc hallCall) elevator.Order {
+	o[hc.Floor][hc.buttonOf()] = true
+	return o
+}
+
+// withoutHallCall returns a copy of the order that excludes the hall call
+func withoutHallCall(o elevator.Order, hc hallCall) elevator.Order {
+	o[hc.Floor][hc.buttonOf()] = false
+	return o
+}
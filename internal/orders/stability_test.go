@@ -0,0 +1,112 @@
+package orders
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+func Test_assignmentStabilizer(t *testing.T) {
+	hc := hallCall{Floor: 2, Direction: request.Up}
+	states := map[elevator.Id]elevator.State{
+		1: {Floor: 0, Behavior: elevator.Moving, Direction: elevator.Up},
+		2: {Floor: 3, Behavior: elevator.Idle, Direction: elevator.Stop},
+	}
+	previous := map[hallCall]elevator.Id{hc: 1}
+	newOrders := map[elevator.Id]elevator.Order{1: {}, 2: withHallCall(elevator.Order{}, hc)}
+
+	tests := []struct {
+		name   string
+		margin time.Duration
+		want   elevator.Id
+	}{
+		{name: "Kept within margin", margin: travelDuration, want: 1},
+		{name: "Reassigned outside margin", margin: 0, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAssignmentStabilizer(tt.margin)
+			stable, _ := s.Stabilize(previous, newOrders, states)
+			got := assignedHallCalls(stable)[hc]
+			if got != tt.want {
+				t.Errorf("Stabilize() assigned %v to elevator %v, want %v", hc, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_assignmentStabilizerDifferentHistories(t *testing.T) {
+	hc := hallCall{Floor: 2, Direction: request.Up}
+	states := map[elevator.Id]elevator.State{
+		1: {Floor: 0, Behavior: elevator.Moving, Direction: elevator.Up},
+		2: {Floor: 3, Behavior: elevator.Idle, Direction: elevator.Stop},
+	}
+	newOrders := map[elevator.Id]elevator.Order{1: {}, 2: withHallCall(elevator.Order{}, hc)}
+
+	// Peer A has served the hall call with elevator 2 before, peer B joined just now
+	a := newAssignmentStabilizer(travelDuration)
+	a.Stabilize(map[hallCall]elevator.Id{}, newOrders, states)
+	b := newAssignmentStabilizer(travelDuration)
+
+	// Both peers received the same estimates, in which elevator 1 claims the hall call
+	estimates := []message.HallCallEstimate{{Floor: hc.Floor, Direction: hc.Direction, Elevator: 1, Eta: time.Second}}
+	claimsA, claimsB := make(assignmentClaims), make(assignmentClaims)
+	claimsA.Update(1, estimates)
+	claimsA.Update(2, estimates)
+	claimsB.Update(2, estimates)
+	claimsB.Update(1, estimates)
+
+	stableA, _ := a.Stabilize(claimsA.Previous(states), newOrders, states)
+	stableB, _ := b.Stabilize(claimsB.Previous(states), newOrders, states)
+	if !reflect.DeepEqual(stableA, stableB) {
+		t.Errorf("Stabilize() gave different orders on the peers: %v and %v", stableA, stableB)
+	}
+	if got := assignedHallCalls(stableA)[hc]; got != 1 {
+		t.Errorf("Stabilize() assigned %v to elevator %v, want the claiming elevator 1", hc, got)
+	}
+}
+
+func Test_assignmentStabilizerMissingCost(t *testing.T) {
+	hc := hallCall{Floor: 2, Direction: request.Up}
+	states := map[elevator.Id]elevator.State{
+		1: {Floor: 0, Behavior: elevator.Moving, Direction: elevator.Up},
+		2: {Floor: 3, Behavior: elevator.Idle, Direction: elevator.Stop},
+	}
+	// The new elevator has no order, so there is no estimate of its arrival at the hall call
+	newOrders := map[elevator.Id]elevator.Order{1: {}, 3: withHallCall(elevator.Order{}, hc)}
+
+	s := newAssignmentStabilizer(0)
+	stable, kept := s.Stabilize(map[hallCall]elevator.Id{hc: 1}, newOrders, states)
+	if got := assignedHallCalls(stable)[hc]; got != 1 || !kept[hc] {
+		t.Errorf("Stabilize() assigned %v to elevator %v, want it kept with elevator 1", hc, got)
+	}
+}
+
+func Test_assignmentClaims(t *testing.T) {
+	up := hallCall{Floor: 1, Direction: request.Up}
+	down := hallCall{Floor: 3, Direction: request.Down}
+	states := map[elevator.Id]elevator.State{1: {}, 2: {}}
+
+	claims := make(assignmentClaims)
+	if !claims.Update(2, []message.HallCallEstimate{
+		{Floor: up.Floor, Direction: up.Direction, Elevator: 2},
+		{Floor: down.Floor, Direction: down.Direction, Elevator: 1},
+	}) {
+		t.Errorf("Update() reported no change for new claims")
+	}
+	if claims.Update(2, []message.HallCallEstimate{{Floor: up.Floor, Direction: up.Direction, Elevator: 2, Eta: time.Second}}) {
+		t.Errorf("Update() reported a change for the same claims with another estimate")
+	}
+	claims.Update(1, []message.HallCallEstimate{{Floor: up.Floor, Direction: up.Direction, Elevator: 1}})
+	claims.Update(3, []message.HallCallEstimate{{Floor: down.Floor, Direction: down.Direction, Elevator: 3}})
+
+	// The estimates of elevator 2 about elevator 1 are not a claim, and elevator 3 has no state
+	want := map[hallCall]elevator.Id{up: 1}
+	if got := claims.Previous(states); !reflect.DeepEqual(got, want) {
+		t.Errorf("Previous() = %v, want %v", got, want)
+	}
+}
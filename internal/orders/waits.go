@@ -0,0 +1,117 @@
+package orders
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// estimateHallCalls estimates the arrival of the assigned elevator for each hall call in the orders
+//
+// The estimates are sorted by floor and direction to make them comparable between calculations.
+func estimateHallCalls(orders map[elevator.Id]elevator.Order, states map[elevator.Id]elevator.State) []message.HallCallEstimate {
+	estimates := make([]message.HallCallEstimate, 0)
+	for id, o := range orders {
+		s, ok := states[id]
+		if !ok {
+			continue
+		}
+		for hc, eta := range estimateArrivals(s, o) {
+			estimates = append(estimates, message.HallCallEstimate{
+				Floor:     hc.Floor,
+				Direction: hc.Direction,
+				Elevator:  id,
+				Eta:       eta,
+			})
+		}
+	}
+
+	sort.Slice(estimates, func(i, j int) bool {
+		if estimates[i].Floor != estimates[j].Floor {
+			return estimates[i].Floor < estimates[j].Floor
+		}
+		return estimates[i].Direction < estimates[j].Direction
+	})
+	return estimates
+}
+
+// logHallDisplay logs the estimates in the format of a hall display
+func logHallDisplay(estimates []message.HallCallEstimate) {
+	msg := "[orderserver] [display] Estimated arrivals:\n"
+	for _, e := range estimates {
+		msg += fmt.Sprintf("\tFloor %v %v: elevator %v in %v\n", e.Floor, e.Direction, e.Elevator, e.Eta.Round(time.Millisecond*100))
+	}
+	log.Print(msg)
+}
+
+// waitRecord stores when a hall call was confirmed and which arrival was predicted for it
+type waitRecord struct {
+	confirmed time.Time
+	predicted time.Duration
+	// hasPrediction is false until the first orders including the hall call are calculated
+	hasPrediction bool
+}
+
+// waitTracker measures the wait time of the hall calls to compare it to the predicted arrival
+//
+// The wait time is the time between the hall call being confirmed and it being served.
+// Only the first prediction after confirmation is compared, as this is what a passenger would be shown.
+type waitTracker struct {
+	records map[hallCall]waitRecord
+}
+
+func newWaitTracker() *waitTracker {
+	return &waitTracker{
+		records: make(map[hallCall]waitRecord),
+	}
+}
+
+// ProcessRequest starts or stops the measurement of the wait time for a hall call
+func (w *waitTracker) ProcessRequest(req request.Request, now time.Time) {
+	hall, ok := req.Origin.(request.Hall)
+	if !ok {
+		return
+	}
+	hc := hallCall{Floor: hall.Floor, Direction: hall.Direction}
+
+	switch req.Status {
+	case request.Confirmed:
+		if _, ok := w.records[hc]; !ok {
+			w.records[hc] = waitRecord{confirmed: now}
+		}
+	case request.Absent:
+		r, ok := w.records[hc]
+		if !ok {
+			return
+		}
+		delete(w.records, hc)
+
+		actual := now.Sub(r.confirmed)
+		if !r.hasPrediction {
+			log.Printf("[orderserver] [waits] Hall call %v served after %v without a prediction", hc, actual.Round(time.Millisecond))
+			return
+		}
+		log.Printf("[orderserver] [waits] Hall call %v served after %v, predicted %v (error %v)",
+			hc, actual.Round(time.Millisecond), r.predicted.Round(time.Millisecond), (actual - r.predicted).Round(time.Millisecond))
+	}
+}
+
+// ProcessEstimates stores the first prediction for every hall call that is being measured
+func (w *waitTracker) ProcessEstimates(estimates []message.HallCallEstimate, now time.Time) {
+	for _, e := range estimates {
+		hc := hallCall{Floor: e.Floor, Direction: e.Direction}
+		r, ok := w.records[hc]
+		if !ok || r.hasPrediction {
+			continue
+		}
+		// The prediction is relative to the confirmation to make it comparable to the wait time
+		r.predicted = now.Sub(r.confirmed) + e.Eta
+		r.hasPrediction = true
+		w.records[hc] = r
+	}
+}
@@ -0,0 +1,240 @@
+package orders
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// staleRecord stores the age and the escalation of a confirmed hall call
+type staleRecord struct {
+	confirmed time.Time
+	// level is the number of times the hall call exceeded the threshold
+	level int
+	// isAbandoned is true if the local elevator gave up the hall call, as it did not serve it in time
+	isAbandoned bool
+}
+
+// staleWatchdog detects confirmed hall calls that are not served in time
+//
+// A hall call may stay confirmed forever, e.g. because of a bug, a partition or a stuck assignment.
+// Every time the age of a hall call exceeds another multiple of the threshold, an alarm is raised.
+// The age is measured from the time the local peer learned of the confirmation, so the peers raise their alarms
+// at different times. Therefore, only the elevator assigned to the hall call decides to give it up, with its own alarm.
+// The hall calls an elevator gave up are shared with its estimates, and every peer moves them away from the elevators
+// that gave them up, so that all peers exclude the same elevators. If every elevator gave up a hall call,
+// the exclusions are ignored and the hall call stays with its assigned elevator.
+type staleWatchdog struct {
+	// local identifies the local elevator, the only elevator the watchdog gives hall calls up for
+	local elevator.Id
+	// threshold is the age after which a hall call is stale. The watchdog is disabled if zero.
+	threshold time.Duration
+	records   map[hallCall]*staleRecord
+	// abandoned contains the hall calls each elevator gave up, as shared with its estimates
+	abandoned map[elevator.Id]map[hallCall]bool
+
+	// alarms and reassignments count how often the watchdog intervened since the start
+	alarms        int
+	reassignments int
+}
+
+func newStaleWatchdog(local elevator.Id, threshold time.Duration) *staleWatchdog {
+	return &staleWatchdog{
+		local:     local,
+		threshold: threshold,
+		records:   make(map[hallCall]*staleRecord),
+		abandoned: make(map[elevator.Id]map[hallCall]bool),
+	}
+}
+
+// ProcessRequest starts or stops watching a hall call
+func (w *staleWatchdog) ProcessRequest(req request.Request, now time.Time) {
+	hall, ok := req.Origin.(request.Hall)
+	if !ok {
+		return
+	}
+	hc := hallCall{Floor: hall.Floor, Direction: hall.Direction}
+
+	switch req.Status {
+	case request.Confirmed:
+		if _, ok := w.records[hc]; !ok {
+			w.records[hc] = &staleRecord{confirmed: now}
+		}
+	case request.Absent:
+		if r, ok := w.records[hc]; ok && r.level > 0 {
+			log.Printf("[orderserver] [watchdog] Stale hall call %v served after %v", hc, now.Sub(r.confirmed).Round(time.Millisecond))
+		}
+		delete(w.records, hc)
+	}
+}
+
+// UpdateAbandoned stores the hall calls a peer gave up and returns whether they changed
+func (w *staleWatchdog) UpdateAbandoned(id elevator.Id, halls []request.Hall) bool {
+	abandoned := make(map[hallCall]bool)
+	for _, h := range halls {
+		abandoned[hallCall{Floor: h.Floor, Direction: h.Direction}] = true
+	}
+	if reflect.DeepEqual(w.abandoned[id], abandoned) {
+		return false
+	}
+	w.abandoned[id] = abandoned
+	return true
+}
+
+// Abandoned returns the hall calls the local elevator gave up, to be shared with the peers
+func (w *staleWatchdog) Abandoned() []request.Hall {
+	halls := make([]request.Hall, 0)
+	for _, hc := range w.sortedRecords() {
+		if w.records[hc].isAbandoned {
+			halls = append(halls, request.Hall{Floor: hc.Floor, Direction: hc.Direction})
+		}
+	}
+	return halls
+}
+
+// Enforce raises alarms for stale hall calls and moves them away from the elevators that gave them up
+//
+// The orders are modified in place. Only the elevators with a state take part in the reassignment.
+func (w *staleWatchdog) Enforce(orders map[elevator.Id]elevator.Order, states map[elevator.Id]elevator.State, now time.Time) {
+	if w.threshold <= 0 {
+		return
+	}
+
+	assigned := assignedHallCalls(orders)
+	for _, hc := range w.sortedRecords() {
+		r := w.records[hc]
+		age := now.Sub(r.confirmed)
+		current, isAssigned := assigned[hc]
+
+		level := int(age / w.threshold)
+		if level <= r.level {
+			continue
+		}
+		r.level = level
+		w.alarms++
+		switch {
+		case isAssigned && current == w.local:
+			r.isAbandoned = true
+			log.Printf("[orderserver] [watchdog] ALARM %v: hall call %v is not served after %v, the local elevator gives it up (alarms: %v, reassignments: %v)",
+				r.level, hc, age.Round(time.Millisecond), w.alarms, w.reassignments)
+		case isAssigned:
+			log.Printf("[orderserver] [watchdog] ALARM %v: hall call %v is not served after %v by elevator %v (alarms: %v, reassignments: %v)",
+				r.level, hc, age.Round(time.Millisecond), current, w.alarms, w.reassignments)
+		default:
+			log.Printf("[orderserver] [watchdog] ALARM %v: hall call %v is not served after %v and no elevator is assigned (alarms: %v, reassignments: %v)",
+				r.level, hc, age.Round(time.Millisecond), w.alarms, w.reassignments)
+		}
+	}
+
+	// The local elevator gives up hall calls the same way as the peers, with its shared estimates
+	w.UpdateAbandoned(w.local, w.Abandoned())
+
+	for _, hc := range sortedHallCalls(assigned) {
+		current := assigned[hc]
+		excluded := w.excluded(hc, states)
+		if !excluded[current] {
+			continue
+		}
+
+		next, ok := cheapestElevator(hc, orders, states, excluded)
+		if !ok {
+			continue
+		}
+		orders[current] = withoutHallCall(orders[current], hc)
+		orders[next] = withHallCall(orders[next], hc)
+		w.reassignments++
+		log.Printf("[orderserver] [watchdog] Moved stale hall call %v from elevator %v to elevator %v", hc, current, next)
+	}
+}
+
+// excluded returns the elevators with a state that gave up the hall call
+func (w *staleWatchdog) excluded(hc hallCall, states map[elevator.Id]elevator.State) map[elevator.Id]bool {
+	excluded := make(map[elevator.Id]bool)
+	for id, abandoned := range w.abandoned {
+		if _, ok := states[id]; ok && abandoned[hc] {
+			excluded[id] = true
+		}
+	}
+	return excluded
+}
+
+// StaleCalls returns the hall calls that have exceeded the threshold at least once
+func (w *staleWatchdog) StaleCalls(orders map[elevator.Id]elevator.Order, states map[elevator.Id]elevator.State, now time.Time) message.StaleCalls {
+	assigned := assignedHallCalls(orders)
+	res := message.StaleCalls{
+		Calls:         make([]message.StaleCall, 0),
+		Alarms:        w.alarms,
+		Reassignments: w.reassignments,
+	}
+	for _, hc := range w.sortedRecords() {
+		r := w.records[hc]
+		if r.level == 0 {
+			continue
+		}
+		excluded := make([]elevator.Id, 0)
+		for id := range w.excluded(hc, states) {
+			excluded = append(excluded, id)
+		}
+		sort.Slice(excluded, func(i, j int) bool { return excluded[i] < excluded[j] })
+
+		id, ok := assigned[hc]
+		res.Calls = append(res.Calls, message.StaleCall{
+			Floor:      hc.Floor,
+			Direction:  hc.Direction,
+			Age:        now.Sub(r.confirmed),
+			Level:      r.level,
+			Elevator:   id,
+			IsAssigned: ok,
+			Excluded:   excluded,
+		})
+	}
+	return res
+}
+
+// sortedRecords returns the watched hall calls in a deterministic order
+func (w *staleWatchdog) sortedRecords() []hallCall {
+	hcs := make([]hallCall, 0, len(w.records))
+	for hc := range w.records {
+		hcs = append(hcs, hc)
+	}
+	sort.Slice(hcs, func(i, j int) bool {
+		if hcs[i].Floor != hcs[j].Floor {
+			return hcs[i].Floor < hcs[j].Floor
+		}
+		return hcs[i].Direction < hcs[j].Direction
+	})
+	return hcs
+}
+
+// cheapestElevator returns the elevator that arrives first at the hall call, ignoring the excluded elevators
+func cheapestElevator(
+	hc hallCall,
+	orders map[elevator.Id]elevator.Order,
+	states map[elevator.Id]elevator.State,
+	excluded map[elevator.Id]bool,
+) (elevator.Id, bool) {
+	ids := make([]elevator.Id, 0, len(states))
+	for id := range states {
+		if !excluded[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	best, bestCost, found := elevator.Id(0), time.Duration(0), false
+	for _, id := range ids {
+		cost, ok := hallCallCost(hc, states[id], withHallCall(orders[id], hc))
+		if !ok {
+			continue
+		}
+		if !found || cost < bestCost {
+			best, bestCost, found = id, cost, true
+		}
+	}
+	return best, found
+}
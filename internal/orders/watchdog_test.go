@@ -0,0 +1,117 @@
+package orders
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+func Test_staleWatchdog(t *testing.T) {
+	hc := hallCall{Floor: 2, Direction: request.Up}
+	states := map[elevator.Id]elevator.State{
+		1: {Floor: 2, Behavior: elevator.Idle, Direction: elevator.Stop},
+		2: {Floor: 0, Behavior: elevator.Idle, Direction: elevator.Stop},
+		3: {Floor: 3, Behavior: elevator.Idle, Direction: elevator.Stop},
+	}
+	start := time.Now()
+	threshold := time.Minute
+
+	w := newStaleWatchdog(1, threshold)
+	w.ProcessRequest(request.NewHallRequest(hc.Floor, hc.Direction, request.Confirmed), start)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		// assigned is the elevator the hall call is assigned to before the watchdog intervenes
+		assigned elevator.Id
+		// abandonedBy are the peers that shared that they gave up the hall call
+		abandonedBy []elevator.Id
+		want        elevator.Id
+		alarms      int
+	}{
+		{name: "Not stale", elapsed: threshold / 2, assigned: 1, want: 1, alarms: 0},
+		{name: "First alarm gives up the local elevator", elapsed: threshold, assigned: 1, want: 3, alarms: 1},
+		{name: "Local elevator stays excluded", elapsed: threshold + time.Second, assigned: 1, want: 3, alarms: 1},
+		{name: "Second alarm keeps the peer assigned", elapsed: 2 * threshold, assigned: 3, want: 3, alarms: 2},
+		{name: "Peer gives up", elapsed: 2 * threshold, assigned: 3, abandonedBy: []elevator.Id{3}, want: 2, alarms: 2},
+		{name: "Every elevator gave up", elapsed: 3 * threshold, assigned: 2, abandonedBy: []elevator.Id{2, 3}, want: 2, alarms: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, id := range tt.abandonedBy {
+				w.UpdateAbandoned(id, []request.Hall{{Floor: hc.Floor, Direction: hc.Direction}})
+			}
+			orders := map[elevator.Id]elevator.Order{1: {}, 2: {}, 3: {}}
+			orders[tt.assigned] = withHallCall(orders[tt.assigned], hc)
+
+			w.Enforce(orders, states, start.Add(tt.elapsed))
+			if got := assignedHallCalls(orders)[hc]; got != tt.want {
+				t.Errorf("Enforce() assigned %v to elevator %v, want %v", hc, got, tt.want)
+			}
+			if w.alarms != tt.alarms {
+				t.Errorf("Enforce() raised %v alarms, want %v", w.alarms, tt.alarms)
+			}
+		})
+	}
+
+	w.ProcessRequest(request.NewHallRequest(hc.Floor, hc.Direction, request.Absent), start.Add(4*threshold))
+	if len(w.StaleCalls(map[elevator.Id]elevator.Order{}, states, start).Calls) != 0 {
+		t.Errorf("Expected no stale calls after the hall call was served")
+	}
+	if len(w.Abandoned()) != 0 {
+		t.Errorf("Expected the local elevator to share no abandoned hall calls after the hall call was served")
+	}
+}
+
+func Test_staleWatchdogDifferentConfirmationTimes(t *testing.T) {
+	hc := hallCall{Floor: 2, Direction: request.Up}
+	states := map[elevator.Id]elevator.State{
+		1: {Floor: 2, Behavior: elevator.Idle, Direction: elevator.Stop},
+		2: {Floor: 0, Behavior: elevator.Idle, Direction: elevator.Stop},
+		3: {Floor: 3, Behavior: elevator.Idle, Direction: elevator.Stop},
+	}
+	start := time.Now()
+	threshold := time.Minute
+
+	// Peer 2 joined later and learned of the confirmation half a threshold after peer 1
+	w1 := newStaleWatchdog(1, threshold)
+	w1.ProcessRequest(request.NewHallRequest(hc.Floor, hc.Direction, request.Confirmed), start)
+	w2 := newStaleWatchdog(2, threshold)
+	w2.ProcessRequest(request.NewHallRequest(hc.Floor, hc.Direction, request.Confirmed), start.Add(threshold/2))
+
+	enforce := func(now time.Time) (map[elevator.Id]elevator.Order, map[elevator.Id]elevator.Order) {
+		orders1 := map[elevator.Id]elevator.Order{1: withHallCall(elevator.Order{}, hc), 2: {}, 3: {}}
+		orders2 := map[elevator.Id]elevator.Order{1: withHallCall(elevator.Order{}, hc), 2: {}, 3: {}}
+		w1.Enforce(orders1, states, now)
+		w2.Enforce(orders2, states, now)
+		// The peers exchange their estimates
+		w1.UpdateAbandoned(2, w2.Abandoned())
+		w2.UpdateAbandoned(1, w1.Abandoned())
+		return orders1, orders2
+	}
+
+	// Only the assigned elevator decides to give the hall call up, with its own alarm.
+	// Until its estimates arrive, the other peer keeps the hall call where it is.
+	orders1, orders2 := enforce(start.Add(threshold))
+	if got := assignedHallCalls(orders1)[hc]; got != 3 {
+		t.Errorf("Expected peer 1 to give up %v to elevator 3, got %v", hc, got)
+	}
+	if got := assignedHallCalls(orders2)[hc]; got != 1 {
+		t.Errorf("Expected peer 2 to keep %v with elevator 1 until it receives the estimates, got %v", hc, got)
+	}
+
+	// Once the estimates are shared, both peers exclude the same elevator, although the alarm of peer 2 is later
+	orders1, orders2 = enforce(start.Add(threshold + threshold/4))
+	if !reflect.DeepEqual(orders1, orders2) {
+		t.Errorf("Expected the peers to agree on the orders, got %v and %v", orders1, orders2)
+	}
+	if got := assignedHallCalls(orders2)[hc]; got != 3 {
+		t.Errorf("Expected %v to move to elevator 3, got %v", hc, got)
+	}
+	if w2.alarms != 0 {
+		t.Errorf("Expected no alarm on peer 2 yet, got %v", w2.alarms)
+	}
+}
@@ -0,0 +1,256 @@
+// processpair is a module that lets a backup process take over the local elevator when the primary process crashes.
+//
+// The primary process streams a snapshot of its elevator state, orders and requests to a backup process
+// on the same machine over a local socket. If the stream stops, the backup takes over with the latest snapshot,
+// so that no cab calls are lost and the elevator continues without waiting for the peers to share their state.
+package processpair
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// snapshotInterval is the interval at which the primary sends a snapshot to the backup
+const snapshotInterval = time.Millisecond * 100
+
+// takeoverTimeout is the time without a snapshot after which the backup considers the primary dead.
+// A crashed primary is usually detected earlier, as its socket is closed by the operating system.
+const takeoverTimeout = time.Millisecond * 500
+
+// respawnDelay is the time the primary waits before it spawns a new backup after the backup died
+const respawnDelay = time.Second * 1
+
+// Snapshot is the state of the primary that is needed by the backup to take over
+type Snapshot struct {
+	// Pid is the process id of the primary. The backup kills the primary when taking over,
+	// in case the primary is hung instead of crashed.
+	Pid int
+	// State is the latest state of the local elevator
+	State elevator.State
+	// Order is the latest order of the local elevator
+	Order elevator.Order
+	// Requests are the requests that are currently present
+	Requests []request.Request
+	// Stop is set in the last snapshot of a primary that shuts down gracefully.
+	// The backup exits instead of taking over.
+	Stop bool
+}
+
+func init() {
+	// The origins are sent as interface values and must be registered for gob
+	gob.Register(request.Hall{})
+	gob.Register(request.Cab{})
+	gob.Register(request.Destination{})
+}
+
+// RunBackup blocks while the primary is alive and returns its latest snapshot once it died
+//
+// If no primary is listening, the backup takes over immediately with an empty snapshot.
+// The second return value is false if the backup should exit instead of taking over,
+// which is the case if the primary or the backup itself shut down gracefully.
+func RunBackup(ctx context.Context, port int) (Snapshot, bool) {
+	snapshot := Snapshot{State: elevator.State{Direction: elevator.Stop}}
+
+	conn, err := net.Dial("tcp", address(port))
+	if err != nil {
+		log.Printf("[processpair] No primary found: %v. Taking over", err)
+		return snapshot, true
+	}
+	defer conn.Close()
+	log.Printf("[processpair] Running as backup of the primary at %v", address(port))
+
+	decoder := gob.NewDecoder(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(takeoverTimeout))
+		var next Snapshot
+		err := decoder.Decode(&next)
+		if ctx.Err() != nil {
+			log.Printf("[processpair] Shutting down the backup")
+			return snapshot, false
+		}
+		if err != nil {
+			log.Printf("[processpair] Lost the primary: %v. Taking over with %v requests and state %v",
+				err, len(snapshot.Requests), snapshot.State)
+			killPrimary(snapshot.Pid)
+			return snapshot, true
+		}
+		if next.Stop {
+			log.Printf("[processpair] The primary shut down. Shutting down the backup")
+			return snapshot, false
+		}
+		snapshot = next
+	}
+}
+
+// RunPrimary should be run as a goroutine and streams snapshots of the local node to a backup process
+//
+// The backup is started with the given arguments and respawned whenever it dies.
+// If port is zero, the process pair is disabled, but the updates are still consumed
+// so that the sending modules never block.
+// When the context is done, the backup is told to exit as well.
+func RunPrimary(
+	ctx context.Context,
+	port int,
+	backupArgs []string,
+	fromDriver <-chan message.ElevatorState,
+	fromOrders <-chan message.ServiceOrder,
+	fromRequests <-chan message.RequestState) {
+
+	snapshot := Snapshot{Pid: os.Getpid()}
+	requests := make(map[request.Origin]request.Request)
+	backups := make(chan *gob.Encoder)
+	lost := make(chan bool, 1)
+
+	if port == 0 {
+		log.Printf("[processpair] No port configured, the process pair is disabled")
+	} else {
+		go superviseBackup(ctx, port, backupArgs, backups, lost)
+	}
+
+	var backup *gob.Encoder
+	ticker := time.NewTicker(snapshotInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			if backup != nil {
+				backup.Encode(Snapshot{Pid: snapshot.Pid, Stop: true})
+			}
+			log.Printf("[processpair] Shutting down")
+			return
+
+		case msg := <-fromDriver:
+			snapshot.State = msg.State
+
+		case msg := <-fromOrders:
+			snapshot.Order = msg.Order
+
+		case msg := <-fromRequests:
+			if msg.Request.Status == request.Absent || msg.Request.Status == request.Unknown {
+				delete(requests, msg.Request.Origin)
+			} else {
+				requests[msg.Request.Origin] = msg.Request
+			}
+
+		case b := <-backups:
+			backup = b
+
+		case <-ticker.C:
+			if backup == nil {
+				continue
+			}
+			snapshot.Requests = sortedRequests(requests)
+			if err := backup.Encode(snapshot); err != nil {
+				log.Printf("[processpair] Failed to send snapshot to the backup: %v", err)
+				backup = nil
+				lost <- true
+			}
+		}
+	}
+}
+
+// superviseBackup spawns the backup process, waits for it to connect and respawns it when it is lost
+func superviseBackup(ctx context.Context, port int, args []string, backups chan<- *gob.Encoder, lost <-chan bool) {
+	// The port may still be in use for a moment if the previous primary was killed by this process
+	listener, err := net.Listen("tcp", address(port))
+	for err != nil {
+		log.Printf("[processpair] Failed to listen on %v: %v. Retrying in %v", address(port), err, respawnDelay)
+		time.Sleep(respawnDelay)
+		listener, err = net.Listen("tcp", address(port))
+	}
+	go func() {
+		// Closing the listener unblocks a pending accept
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for ctx.Err() == nil {
+		if err := spawnBackup(args); err != nil {
+			log.Printf("[processpair] Failed to spawn the backup: %v", err)
+			time.Sleep(respawnDelay)
+			continue
+		}
+
+		conn, err := listener.Accept()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("[processpair] Failed to accept the backup: %v", err)
+			continue
+		}
+		log.Printf("[processpair] The backup connected from %v", conn.RemoteAddr())
+		select {
+		case backups <- gob.NewEncoder(conn):
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case <-lost:
+		case <-ctx.Done():
+			// The connection is used for the last snapshot and closed when the process exits
+			return
+		}
+		conn.Close()
+		log.Printf("[processpair] Lost the backup. Respawning in %v", respawnDelay)
+		time.Sleep(respawnDelay)
+	}
+}
+
+// spawnBackup starts the backup as a copy of the running executable
+func spawnBackup(args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Printf("[processpair] Spawned the backup with pid %v", cmd.Process.Pid)
+
+	// The backup is waited for, so that it does not become a zombie when it dies
+	go cmd.Wait()
+	return nil
+}
+
+// killPrimary stops the primary in case it is hung, so that only one process controls the elevator
+func killPrimary(pid int) {
+	if pid == 0 {
+		return
+	}
+	if p, err := os.FindProcess(pid); err == nil {
+		p.Kill()
+	}
+}
+
+// sortedRequests returns the requests in a deterministic order
+func sortedRequests(requests map[request.Origin]request.Request) []request.Request {
+	sorted := make([]request.Request, 0, len(requests))
+	for _, r := range requests {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return fmt.Sprint(sorted[i].Origin) < fmt.Sprint(sorted[j].Origin)
+	})
+	return sorted
+}
+
+func address(port int) string {
+	return fmt.Sprintf("localhost:%d", port)
+}
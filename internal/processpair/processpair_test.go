@@ -0,0 +1,194 @@
+package processpair
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// The takeover tests run the primary and the backup as copies of the test binary,
+// as the backup kills the primary process when it takes over.
+const (
+	// helperEnv is set to the port of the process pair in the helper processes
+	helperEnv = "PROCESSPAIR_HELPER_PORT"
+	// snapshotEnv is the file the backup helper writes the snapshot to when it takes over
+	snapshotEnv = "PROCESSPAIR_HELPER_SNAPSHOT"
+)
+
+// helperState, helperOrder and helperRequest are sent to the primary helper
+var (
+	helperState   = elevator.State{Floor: 2, Behavior: elevator.DoorOpen, Direction: elevator.Stop}
+	helperOrder   = elevator.Order{3: {false, false, true}}
+	helperRequest = request.NewCabRequest(3, 1, request.Confirmed)
+)
+
+func TestMain(m *testing.M) {
+	if port, err := strconv.Atoi(os.Getenv(helperEnv)); err == nil && len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "primary":
+			runHelperPrimary(port)
+		case "backup":
+			runHelperBackup(port)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runHelperPrimary runs the primary with a fixed state until it is killed
+func runHelperPrimary(port int) {
+	fromDriver := make(chan message.ElevatorState, 1)
+	fromOrders := make(chan message.ServiceOrder, 1)
+	fromRequests := make(chan message.RequestState, 1)
+	fromDriver <- message.ElevatorState{Elevator: 1, State: helperState}
+	fromOrders <- message.ServiceOrder{Order: helperOrder}
+	fromRequests <- message.RequestState{Source: 1, Request: helperRequest}
+	RunPrimary(context.Background(), port, []string{"backup"}, fromDriver, fromOrders, fromRequests)
+}
+
+// runHelperBackup runs the backup and writes the snapshot to the snapshot file when it takes over
+func runHelperBackup(port int) {
+	snapshot, ok := RunBackup(context.Background(), port)
+	if !ok {
+		return
+	}
+	path := os.Getenv(snapshotEnv)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return
+	}
+	gob.NewEncoder(f).Encode(snapshot)
+	f.Close()
+	os.Rename(path+".tmp", path)
+}
+
+func TestSnapshotEncoding(t *testing.T) {
+	want := Snapshot{
+		Pid:   42,
+		State: elevator.State{Floor: 2, Behavior: elevator.Moving, Direction: elevator.Up},
+		Order: elevator.Order{3: {false, false, true}},
+		Requests: []request.Request{
+			request.NewCabRequest(3, 1, request.Confirmed),
+			request.NewHallRequest(1, request.Down, request.Unconfirmed),
+			request.NewDestinationRequest(0, 2, request.Confirmed),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(want); err != nil {
+		t.Fatalf("failed to encode snapshot: %v", err)
+	}
+
+	var got Snapshot
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestTakeover checks that the backup takes over with the last snapshot of the primary,
+// both if the primary crashes and if it hangs
+func TestTakeover(t *testing.T) {
+	tests := []struct {
+		name string
+		// stop stops the primary
+		stop func(p *os.Process) error
+		// minDelay is the minimum time from stopping the primary until the backup took over
+		minDelay time.Duration
+	}{
+		{
+			name:     "Crash",
+			stop:     func(p *os.Process) error { return p.Kill() },
+			minDelay: 0,
+		},
+		{
+			name:     "Hang",
+			stop:     func(p *os.Process) error { return p.Signal(syscall.SIGSTOP) },
+			minDelay: takeoverTimeout - snapshotInterval,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := freePort(t)
+			path := filepath.Join(t.TempDir(), "snapshot")
+
+			primary := exec.Command(os.Args[0], "primary")
+			primary.Env = append(os.Environ(), helperEnv+"="+strconv.Itoa(port), snapshotEnv+"="+path)
+			if err := primary.Start(); err != nil {
+				t.Fatalf("failed to start the primary: %v", err)
+			}
+			exited := make(chan error, 1)
+			go func() { exited <- primary.Wait() }()
+			defer primary.Process.Kill()
+
+			// The primary spawns the backup and streams a few snapshots to it
+			time.Sleep(10 * snapshotInterval)
+			if err := tt.stop(primary.Process); err != nil {
+				t.Fatalf("failed to stop the primary: %v", err)
+			}
+			stopped := time.Now()
+
+			var snapshot Snapshot
+			for {
+				if f, err := os.Open(path); err == nil {
+					err = gob.NewDecoder(f).Decode(&snapshot)
+					f.Close()
+					if err != nil {
+						t.Fatalf("failed to decode the snapshot: %v", err)
+					}
+					break
+				}
+				if time.Since(stopped) > 4*takeoverTimeout {
+					t.Fatalf("expected the backup to take over within %v", 4*takeoverTimeout)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if delay := time.Since(stopped); delay < tt.minDelay {
+				t.Errorf("expected the backup to wait for at least %v, took over after %v", tt.minDelay, delay)
+			}
+			want := Snapshot{
+				Pid:      primary.Process.Pid,
+				State:    helperState,
+				Order:    helperOrder,
+				Requests: []request.Request{helperRequest},
+			}
+			if !reflect.DeepEqual(snapshot, want) {
+				t.Errorf("expected %v, got %v", want, snapshot)
+			}
+
+			// The backup kills the primary, so that only one process controls the elevator
+			select {
+			case <-exited:
+			case <-time.After(time.Second):
+				t.Errorf("expected the primary to be killed by the backup")
+			}
+		})
+	}
+}
+
+// freePort returns a port on the loopback interface that is currently not in use
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,112 @@
+package requests
+
+import (
+	"fmt"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// QuorumRule defines how many of the alive peers must acknowledge a request before it is confirmed.
+type QuorumRule int
+
+// QuorumRule constants define the possible rules.
+const (
+	// AllAlive requires the acknowledgement of all alive peers
+	AllAlive QuorumRule = iota
+	// Majority requires the acknowledgement of more than half of the alive peers
+	Majority
+	// NOfM requires the acknowledgement of N of the M alive peers
+	NOfM
+)
+
+// Quorum defines which acknowledgements are needed to confirm a request.
+type Quorum struct {
+	Rule QuorumRule
+	// N is the number of acknowledgements needed by the NOfM rule. It is capped at the number of alive peers.
+	N int
+	// AllowAlone lets the local elevator confirm requests on its own.
+	// Otherwise, at least one other peer must acknowledge a request, so that it is backed up before the button light is turned on.
+	AllowAlone bool
+}
+
+// ConfirmationPolicy defines the quorums needed to confirm requests.
+// Hall and destination requests share a quorum, while cab requests have their own.
+type ConfirmationPolicy struct {
+	Hall Quorum
+	Cab  Quorum
+}
+
+// DefaultConfirmationPolicy requires all alive peers to acknowledge a request.
+// Cab requests may be confirmed by the local elevator alone, as they are only served by it anyway.
+var DefaultConfirmationPolicy = ConfirmationPolicy{
+	Hall: Quorum{Rule: AllAlive},
+	Cab:  Quorum{Rule: AllAlive, AllowAlone: true},
+}
+
+// ParseQuorum converts the name of a rule as used in the config to a Quorum.
+// An empty name results in the rule AllAlive.
+func ParseQuorum(rule string, n int, allowAlone bool) (Quorum, error) {
+	q := Quorum{N: n, AllowAlone: allowAlone}
+	switch rule {
+	case "", "all_alive":
+		q.Rule = AllAlive
+	case "majority":
+		q.Rule = Majority
+	case "n_of_m":
+		if n < 1 {
+			return q, fmt.Errorf("the quorum n_of_m needs a positive n, got %v", n)
+		}
+		q.Rule = NOfM
+	default:
+		return q, fmt.Errorf("unknown quorum rule %q", rule)
+	}
+	return q, nil
+}
+
+// quorum returns the quorum needed to confirm a request of the given origin
+func (p ConfirmationPolicy) quorum(o request.Origin) Quorum {
+	if _, ok := o.(request.Cab); ok {
+		return p.Cab
+	}
+	return p.Hall
+}
+
+// required returns the number of acknowledgements needed to confirm a request
+func (q Quorum) required(numAlive int) int {
+	var required int
+	switch q.Rule {
+	case Majority:
+		required = numAlive/2 + 1
+	case NOfM:
+		required = min(q.N, numAlive)
+	default:
+		required = numAlive
+	}
+
+	if !q.AllowAlone {
+		required = max(required, 2)
+	}
+	return max(required, 1)
+}
+
+// requiresAllAlive returns true if every alive peer must acknowledge a request
+func (q Quorum) requiresAllAlive() bool {
+	return q.Rule == AllAlive
+}
+
+// String returns the quorum as used in the config
+func (q Quorum) String() string {
+	var str string
+	switch q.Rule {
+	case AllAlive:
+		str = "all_alive"
+	case Majority:
+		str = "majority"
+	case NOfM:
+		str = fmt.Sprintf("%v_of_m", q.N)
+	}
+	if q.AllowAlone {
+		str += " (alone allowed)"
+	}
+	return str
+}
@@ -45,28 +45,30 @@ func (lm *ledgerTracker) resetLedgers(origin request.Origin) {
 	log.Printf("[requests] [manager] [ledgers] Reset ledgers for %v", origin)
 }
 
-// isMessageAcknowledged checks if all alive peers have acknowledged the request.
-//
-// A request is acknowledged if one of the following conditions is met:
-//   - A hall request is acknowledged by all alive peers and at least one other peer.
-//   - A cab request is acknowledged by all alive peers (can be only the local elevator).
-func (lm *ledgerTracker) isMessageAcknowledged(o request.Origin, alive []elevator.Id) bool {
-	if len(lm.ledgers[o]) != len(alive) {
-		return false
-	}
-
-	if _, ok := o.(request.Hall); ok && len(lm.ledgers[o]) < 2 {
-		// Hall requests must be acknowledged by all alive peers and at least one other peer.
-		// This is because of the button light contract.
-		// When the local elevator is disconnected, the no redundancy would be present.
-		return false
+// acknowledgers returns the ids of the peers that have acknowledged the request
+func (lm *ledgerTracker) acknowledgers(origin request.Origin) []elevator.Id {
+	ids := make([]elevator.Id, 0, len(lm.ledgers[origin]))
+	for id, ok := range lm.ledgers[origin] {
+		if ok {
+			ids = append(ids, id)
+		}
 	}
+	return ids
+}
 
+// isMessageAcknowledged checks if enough alive peers have acknowledged the request to satisfy the quorum.
+//
+// Acknowledgements of peers that are no longer alive are not counted.
+// Unless the quorum allows the local elevator to confirm alone, at least two peers must acknowledge the request.
+// This is because of the button light contract.
+// When the local elevator is disconnected, the no redundancy would be present.
+func (lm *ledgerTracker) isMessageAcknowledged(o request.Origin, alive []elevator.Id, quorum Quorum) bool {
+	acknowledged := 0
 	for _, id := range alive {
-		if _, ok := lm.ledgers[o][id]; !ok {
-			return false
+		if lm.ledgers[o][id] {
+			acknowledged++
 		}
 	}
 
-	return true
+	return acknowledged >= quorum.required(len(alive))
 }
@@ -2,9 +2,12 @@ package requests
 
 import (
 	"log"
+	"time"
 
+	"group48.ttk4145.ntnu/elevators/internal/audit"
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
 	"group48.ttk4145.ntnu/elevators/internal/models/request"
 )
 
@@ -22,6 +25,13 @@ import (
 //	Absent -> Unconfirmed -> Confirmed -> Absent
 //
 // The possible transitions given an input are implemented in the process method.
+//
+// The confirmation policy defines how many alive peers must acknowledge a request before it is confirmed.
+// When the network is partitioned, the partition policy decides whether hall and destination requests are confirmed.
+// When a peer rejoins, hall and destination requests are merged deterministically for a short time:
+// a confirmed request that the rejoining peer reports as absent is raised again instead of being cleared,
+// as the peer may have served an older instance of the request. Serving a request twice is preferred over losing it.
+// A cab call cancelled by the local elevator before it is confirmed is cancelled once it is confirmed.
 type requestManager struct {
 	// local id is needed to add the local elevator to the ledgers.
 	local elevator.Id
@@ -36,27 +46,124 @@ type requestManager struct {
 	// alivePeers is used to determine if all alive peers have acknowledged a request.
 	// This is needed to move requests from Unconfirmed to Confirmed state.
 	alivePeers []elevator.Id
+
+	// isSynced is false while the local peer joins the other peers.
+	// Until then, requests are not confirmed by the local peer, as it may miss requests the other peers know of.
+	isSynced bool
+
+	// policy decides whether hall and destination requests are confirmed while the network is partitioned
+	policy partition.Policy
+
+	// servesHallCalls is false if the partition policy forbids confirming hall and destination requests
+	servesHallCalls bool
+
+	// allowsConfirmingAlone is false if the partition policy forbids the local elevator to confirm hall and destination requests alone.
+	// It only tightens the quorum of the confirmation policy, which must allow confirming alone as well.
+	allowsConfirmingAlone bool
+
+	// confirmation defines the quorums needed to confirm hall and cab requests
+	confirmation ConfirmationPolicy
+
+	// mergeDeadlines contains the time until which the requests of a rejoined peer are merged
+	mergeDeadlines map[elevator.Id]time.Time
+
+	// pendingCancels contains the cab calls that were cancelled locally while they were unconfirmed
+	pendingCancels map[request.Origin]bool
+
+	// auditLog records every input and status change of a request. It is disabled if nil.
+	auditLog *audit.Logger
+
+	// now returns the current time. It is replaced by the time of the recorded events when replaying an audit log.
+	now func() time.Time
 }
 
+// mergeWindow is the time after a peer rejoined during which its requests are merged
+const mergeWindow = time.Millisecond * 1000
+
 // newRequestManager creates a new request manager
 func newRequestManager(local elevator.Id) *requestManager {
 	return &requestManager{
-		local:          local,
-		statusByOrigin: make(map[request.Origin]request.Status),
-		ledgerTracker:  newLedgerManager(),
-		alivePeers:     make([]elevator.Id, 0),
+		local:           local,
+		statusByOrigin:  make(map[request.Origin]request.Status),
+		ledgerTracker:   newLedgerManager(),
+		alivePeers:      make([]elevator.Id, 0),
+		isSynced:        true,
+		policy:          partition.ServeAll,
+		servesHallCalls: true,
+		// Until the partition is known, the confirmation policy alone decides
+		allowsConfirmingAlone: true,
+		confirmation:          DefaultConfirmationPolicy,
+		mergeDeadlines:        make(map[elevator.Id]time.Time),
+		pendingCancels:        make(map[request.Origin]bool),
+		now:                   time.Now,
 	}
 }
 
+// ProcessActivePeers updates the alive peers and applies the partition policy
+func (rm *requestManager) ProcessActivePeers(ap message.ActivePeers) {
+	rm.auditLog.Peers(ap.Peers, ap.Partitioned, ap.InMajority)
+	rm.UpdateAlivePeers(ap.Peers)
+	rm.UpdatePartition(ap.Partitioned, ap.InMajority)
+}
+
 func (rm *requestManager) UpdateAlivePeers(peers []elevator.Id) {
+	now := rm.now()
+	for _, id := range peers {
+		if id != rm.local && !contains(rm.alivePeers, id) {
+			rm.mergeDeadlines[id] = now.Add(mergeWindow)
+		}
+	}
+
 	rm.alivePeers = peers
 	log.Printf("[requests] [manager] Alive peers updated: %v", rm.alivePeers)
 }
 
+// UpdatePartition applies the partition policy to the current partition of the network
+func (rm *requestManager) UpdatePartition(partitioned, inMajority bool) {
+	rm.servesHallCalls = rm.policy.ServesHallCalls(partitioned, inMajority)
+	rm.allowsConfirmingAlone = rm.policy.AllowsConfirmingAlone(partitioned, inMajority, len(rm.alivePeers))
+	log.Printf("[requests] [manager] Partitioned: %v, in majority: %v (policy %v). Confirming hall calls: %v, alone: %v",
+		partitioned, inMajority, rm.policy, rm.servesHallCalls, rm.allowsConfirmingAlone)
+}
+
+// SetSynced sets whether the local peer has synced with the other peers
+//
+// Once synced, the requests that were acknowledged in the meantime are confirmed and returned.
+func (rm *requestManager) SetSynced(isSynced bool) []request.Request {
+	rm.isSynced = isSynced
+	log.Printf("[requests] [manager] Synced with the other peers: %v", isSynced)
+
+	confirmed := make([]request.Request, 0)
+	if !isSynced {
+		return confirmed
+	}
+	rm.auditLog.Event(audit.KindSynced)
+	for origin, status := range rm.statusByOrigin {
+		if status != request.Unconfirmed || !rm.isAcknowledged(origin) {
+			continue
+		}
+		rm.statusByOrigin[origin] = request.Confirmed
+		log.Printf("[requests] [manager] Request status changed: %v -> %v for %v", status, request.Confirmed, origin)
+		rm.auditLog.Transition(rm.local, origin, status, request.Confirmed, rm.ledgerTracker.acknowledgers(origin))
+		rm.ledgerTracker.resetLedgers(origin)
+		confirmed = append(confirmed, request.Request{Origin: origin, Status: request.Confirmed})
+	}
+	return confirmed
+}
+
+// Restore stores the request with its status as is, without any transitions.
+//
+// It is used to take over the requests of a crashed process.
+func (rm *requestManager) Restore(req request.Request) {
+	rm.statusByOrigin[req.Origin] = req.Status
+	log.Printf("[requests] [manager] Restored request: %v", req)
+}
+
 // Process processes a request message and returns the updated request.
 //
 // Processed requests are stored in the request manager to keep track of the state of each request.
 func (rm *requestManager) Process(msg message.RequestState) request.Request {
+	rm.auditLog.Input(msg.Source, msg.Request)
 	if _, ok := rm.statusByOrigin[msg.Request.Origin]; !ok {
 		rm.statusByOrigin[msg.Request.Origin] = msg.Request.Status
 	}
@@ -79,6 +186,14 @@ func (rm *requestManager) Process(msg message.RequestState) request.Request {
 	if oldStatus != updatedStatus {
 		// The request has changed state, so we log it.
 		log.Printf("[requests] [manager] Request status changed: %v -> %v for %v", oldStatus, updatedStatus, msg.Request.Origin)
+		rm.auditLog.Transition(msg.Source, msg.Request.Origin, oldStatus, updatedStatus, rm.ledgerTracker.acknowledgers(msg.Request.Origin))
+	}
+
+	if msg.Request.Status == request.Unconfirmed && oldStatus != request.Confirmed && updatedStatus == request.Confirmed {
+		// Ledgers are reset as the next time the request reaches the Unconfirmed state,
+		// it must be acknowledged by all peers again.
+		// The reset happens after the audit log recorded which peers acknowledged the request.
+		rm.ledgerTracker.resetLedgers(msg.Request.Origin)
 	}
 
 	msg.Request.Status = updatedStatus // Status must always be updated to create a new request object
@@ -95,18 +210,47 @@ func (rm *requestManager) processUnknown(msg message.RequestState) request.Statu
 // processAbsent processes a request with an Absent status.
 func (rm *requestManager) processAbsent(msg message.RequestState) request.Status {
 	currentStatus := rm.statusByOrigin[msg.Request.Origin]
+	if currentStatus == request.Confirmed && rm.isMerging(msg) {
+		// The rejoining peer may have served an older instance of the request, so it is raised again
+		log.Printf("[requests] [manager] Raising %v again, as the rejoined peer %v reported it absent", msg.Request.Origin, msg.Source)
+		rm.ledgerTracker.resetLedgers(msg.Request.Origin)
+		rm.ledgerTracker.addLedger(msg.Request.Origin, rm.local)
+		return request.Unconfirmed
+	}
 	if currentStatus == request.Confirmed || currentStatus == request.Unknown {
 		// Acknowledgement from the other peers is not needed,
 		// as a request could only have been confirmed if all peers acknowledged it in the first place
 		return request.Absent
 	}
+	if _, ok := msg.Request.Origin.(request.Cab); ok && currentStatus == request.Unconfirmed && msg.Source == rm.local {
+		// Clearing an unconfirmed request would leave the peers that acknowledged it behind,
+		// so the cancel is applied once the request is confirmed
+		log.Printf("[requests] [manager] Cancelling %v once it is confirmed", msg.Request.Origin)
+		rm.pendingCancels[msg.Request.Origin] = true
+	}
 
 	return currentStatus
 }
 
+// PendingCancel returns the cancel of the request if it was cancelled locally before it was confirmed.
+//
+// The cancel is returned once the request is confirmed and must be processed like any other request.
+func (rm *requestManager) PendingCancel(req request.Request) (message.RequestState, bool) {
+	if req.Status != request.Confirmed || !rm.pendingCancels[req.Origin] {
+		return message.RequestState{}, false
+	}
+	delete(rm.pendingCancels, req.Origin)
+	req.Status = request.Absent
+	return message.RequestState{Source: rm.local, Request: req}, true
+}
+
 // processUnconfirmed processes a request with an Unconfirmed status.
 func (rm *requestManager) processUnconfirmed(msg message.RequestState) request.Status {
 	currentStatus := rm.statusByOrigin[msg.Request.Origin]
+	if msg.Source == rm.local {
+		// A new press takes back an earlier cancel
+		delete(rm.pendingCancels, msg.Request.Origin)
+	}
 	if currentStatus == request.Confirmed {
 		// The stored version is already confirmed, so we return it as is
 		return currentStatus
@@ -115,10 +259,8 @@ func (rm *requestManager) processUnconfirmed(msg message.RequestState) request.S
 	rm.ledgerTracker.addLedger(msg.Request.Origin, msg.Source)
 	rm.ledgerTracker.addLedger(msg.Request.Origin, rm.local)
 
-	if rm.ledgerTracker.isMessageAcknowledged(msg.Request.Origin, rm.alivePeers) {
-		// Ledgers are reset as the next time the request reaches the Unconfirmed state,
-		// it must be acknowledged by all peers again.
-		rm.ledgerTracker.resetLedgers(msg.Request.Origin)
+	if rm.isAcknowledged(msg.Request.Origin) {
+		// The ledgers are reset by Process once the transition is recorded
 		return request.Confirmed
 	}
 
@@ -129,6 +271,12 @@ func (rm *requestManager) processUnconfirmed(msg message.RequestState) request.S
 func (rm *requestManager) processConfirmed(msg message.RequestState) request.Status {
 	currentStatus := rm.statusByOrigin[msg.Request.Origin]
 
+	if currentStatus == request.Absent && !rm.confirmation.quorum(msg.Request.Origin).requiresAllAlive() {
+		// The request may have been confirmed without the acknowledgement of the local peer.
+		// As comms only passes on newer versions of a request, it is not an old request that was already cleared.
+		return request.Confirmed
+	}
+
 	if currentStatus != request.Unconfirmed {
 		// Either the request is already confirmed locally, so we can return it as is,
 		// or the stored request is absent. In the latter case, we should not change the status,
@@ -140,3 +288,40 @@ func (rm *requestManager) processConfirmed(msg message.RequestState) request.Sta
 	// This is okay, as the request could only have been confirmed if all peers acknowledged it in the first place.
 	return request.Confirmed
 }
+
+// isAcknowledged checks if the request may be confirmed
+//
+// The local peer must be synced with the other peers, hall and destination requests
+// must be allowed by the partition policy and the quorum of the confirmation policy must be reached.
+// Hall and destination requests are only confirmed alone if both the quorum and the partition policy allow it.
+func (rm *requestManager) isAcknowledged(o request.Origin) bool {
+	if !rm.isSynced {
+		return false
+	}
+	quorum := rm.confirmation.quorum(o)
+	if _, ok := o.(request.Cab); !ok {
+		if !rm.servesHallCalls {
+			return false
+		}
+		quorum.AllowAlone = quorum.AllowAlone && rm.allowsConfirmingAlone
+	}
+	return rm.ledgerTracker.isMessageAcknowledged(o, rm.alivePeers, quorum)
+}
+
+// isMerging checks if the message is a hall or destination request of a peer that rejoined recently
+func (rm *requestManager) isMerging(msg message.RequestState) bool {
+	if _, ok := msg.Request.Origin.(request.Cab); ok {
+		return false
+	}
+	deadline, ok := rm.mergeDeadlines[msg.Source]
+	return ok && rm.now().Before(deadline)
+}
+
+func contains(ids []elevator.Id, id elevator.Id) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
 	"group48.ttk4145.ntnu/elevators/internal/models/request"
 )
 
@@ -76,6 +77,30 @@ func TestRequestManager(t *testing.T) {
 				{update: message.RequestState{Source: 1, Request: request.Request{Origin: request.Cab{Id: 1, Floor: 1}, Status: request.Absent}}, expectedStatus: request.Absent},
 			},
 		},
+		{
+			name:           "OnePeerDestinationCycle",
+			alivePeers:     []elevator.Id{1},
+			initialRequest: request.Request{Origin: request.Destination{From: 0, To: 2}, Status: request.Absent},
+			updates: []struct {
+				update         message.RequestState
+				expectedStatus request.Status
+			}{
+				{update: message.RequestState{Source: 1, Request: request.Request{Origin: request.Destination{From: 0, To: 2}, Status: request.Unconfirmed}}, expectedStatus: request.Unconfirmed},
+			},
+		},
+		{
+			name:           "TwoPeerDestinationCycle",
+			alivePeers:     []elevator.Id{1, 2},
+			initialRequest: request.Request{Origin: request.Destination{From: 0, To: 2}, Status: request.Absent},
+			updates: []struct {
+				update         message.RequestState
+				expectedStatus request.Status
+			}{
+				{update: message.RequestState{Source: 1, Request: request.Request{Origin: request.Destination{From: 0, To: 2}, Status: request.Unconfirmed}}, expectedStatus: request.Unconfirmed},
+				{update: message.RequestState{Source: 2, Request: request.Request{Origin: request.Destination{From: 0, To: 2}, Status: request.Unconfirmed}}, expectedStatus: request.Confirmed},
+				{update: message.RequestState{Source: 2, Request: request.Request{Origin: request.Destination{From: 0, To: 2}, Status: request.Absent}}, expectedStatus: request.Absent},
+			},
+		},
 		{
 			name:           "NoUpdateFromAbsentToConfirmed",
 			alivePeers:     []elevator.Id{1},
@@ -143,3 +168,247 @@ func TestRequestManager(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestManagerSync(t *testing.T) {
+	cab := request.Cab{Id: 1, Floor: 2}
+
+	rm := newRequestManager(elevator.Id(1))
+	rm.alivePeers = []elevator.Id{1}
+	rm.SetSynced(false)
+
+	res := rm.Process(message.RequestState{Source: 1, Request: request.Request{Origin: cab, Status: request.Unconfirmed}})
+	if res.Status != request.Unconfirmed {
+		t.Errorf("Expected %v before the sync, got %v", request.Unconfirmed, res.Status)
+	}
+
+	confirmed := rm.SetSynced(true)
+	if len(confirmed) != 1 || confirmed[0].Origin != cab || confirmed[0].Status != request.Confirmed {
+		t.Errorf("Expected the cab request to be confirmed after the sync, got %v", confirmed)
+	}
+}
+
+func TestRequestManagerPartition(t *testing.T) {
+	hall := request.Hall{Floor: 1, Direction: request.Up}
+	cab := request.Cab{Id: 1, Floor: 2}
+
+	rm := newRequestManager(elevator.Id(1))
+	rm.policy = partition.CabOnly
+	rm.UpdateAlivePeers([]elevator.Id{1})
+	rm.UpdatePartition(true, false)
+
+	res := rm.Process(message.RequestState{Source: 1, Request: request.Request{Origin: hall, Status: request.Unconfirmed}})
+	if res.Status != request.Unconfirmed {
+		t.Errorf("Expected the hall request to stay %v while partitioned, got %v", request.Unconfirmed, res.Status)
+	}
+	res = rm.Process(message.RequestState{Source: 1, Request: request.Request{Origin: cab, Status: request.Unconfirmed}})
+	if res.Status != request.Confirmed {
+		t.Errorf("Expected the cab request to be %v while partitioned, got %v", request.Confirmed, res.Status)
+	}
+
+	rm.policy = partition.ServeAll
+	rm.UpdatePartition(true, false)
+	res = rm.Process(message.RequestState{Source: 1, Request: request.Request{Origin: hall, Status: request.Unconfirmed}})
+	if res.Status != request.Unconfirmed {
+		t.Errorf("Expected the isolated peer to wait for an acknowledgement by default, got %v", res.Status)
+	}
+	rm.confirmation.Hall.AllowAlone = true
+	res = rm.Process(message.RequestState{Source: 1, Request: request.Request{Origin: hall, Status: request.Unconfirmed}})
+	if res.Status != request.Confirmed {
+		t.Errorf("Expected the isolated peer to confirm the hall request if the quorum allows it, got %v", res.Status)
+	}
+
+	// Peer 2 rejoins and reports the hall request as absent, e.g. because it served an older instance of it
+	rm.UpdateAlivePeers([]elevator.Id{1, 2})
+	rm.UpdatePartition(false, true)
+	res = rm.Process(message.RequestState{Source: 2, Request: request.Request{Origin: hall, Status: request.Absent}})
+	if res.Status != request.Unconfirmed {
+		t.Errorf("Expected the hall request to be raised again after the merge, got %v", res.Status)
+	}
+	res = rm.Process(message.RequestState{Source: 2, Request: request.Request{Origin: hall, Status: request.Unconfirmed}})
+	if res.Status != request.Confirmed {
+		t.Errorf("Expected the merged hall request to be confirmed again, got %v", res.Status)
+	}
+}
+
+func TestRequestManagerQuorum(t *testing.T) {
+	hall := request.Hall{Floor: 2, Direction: request.Down}
+	unconfirmed := func(source elevator.Id) message.RequestState {
+		return message.RequestState{Source: source, Request: request.Request{Origin: hall, Status: request.Unconfirmed}}
+	}
+
+	tests := []struct {
+		name       string
+		quorum     Quorum
+		alivePeers []elevator.Id
+		acks       []elevator.Id
+		expected   request.Status
+	}{
+		{name: "AllAliveMissingPeer", quorum: Quorum{Rule: AllAlive}, alivePeers: []elevator.Id{1, 2, 3}, acks: []elevator.Id{2}, expected: request.Unconfirmed},
+		{name: "MajorityReached", quorum: Quorum{Rule: Majority}, alivePeers: []elevator.Id{1, 2, 3}, acks: []elevator.Id{2}, expected: request.Confirmed},
+		{name: "MajorityMissing", quorum: Quorum{Rule: Majority}, alivePeers: []elevator.Id{1, 2, 3, 4, 5}, acks: []elevator.Id{2}, expected: request.Unconfirmed},
+		{name: "NOfMReached", quorum: Quorum{Rule: NOfM, N: 3}, alivePeers: []elevator.Id{1, 2, 3, 4, 5}, acks: []elevator.Id{2, 4}, expected: request.Confirmed},
+		{name: "NOfMCappedAtAlive", quorum: Quorum{Rule: NOfM, N: 3}, alivePeers: []elevator.Id{1, 2}, acks: []elevator.Id{2}, expected: request.Confirmed},
+		{name: "DeadPeerNotCounted", quorum: Quorum{Rule: NOfM, N: 2}, alivePeers: []elevator.Id{1, 3}, acks: []elevator.Id{2}, expected: request.Unconfirmed},
+		{name: "AloneNotAllowed", quorum: Quorum{Rule: AllAlive}, alivePeers: []elevator.Id{1}, acks: []elevator.Id{1}, expected: request.Unconfirmed},
+		{name: "AloneAllowed", quorum: Quorum{Rule: AllAlive, AllowAlone: true}, alivePeers: []elevator.Id{1}, acks: []elevator.Id{1}, expected: request.Confirmed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := newRequestManager(elevator.Id(1))
+			rm.confirmation = ConfirmationPolicy{Hall: tt.quorum, Cab: DefaultConfirmationPolicy.Cab}
+			rm.alivePeers = tt.alivePeers
+
+			var res request.Request
+			for _, id := range tt.acks {
+				res = rm.Process(unconfirmed(id))
+			}
+			if res.Status != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, res.Status)
+			}
+		})
+	}
+}
+
+func TestRequestManagerQuorumWithPartition(t *testing.T) {
+	hall := request.Hall{Floor: 2, Direction: request.Down}
+
+	tests := []struct {
+		name   string
+		quorum Quorum
+		policy partition.Policy
+		peers  message.ActivePeers
+		// acks are the peers that acknowledge the hall request after the aliveness update
+		acks     []elevator.Id
+		expected request.Status
+	}{
+		{name: "HealthyClusterLocalAck", quorum: Quorum{Rule: NOfM, N: 1},
+			peers: message.ActivePeers{Peers: []elevator.Id{1, 2, 3}, InMajority: true}, acks: []elevator.Id{1}, expected: request.Unconfirmed},
+		{name: "HealthyClusterAloneTightened", quorum: Quorum{Rule: NOfM, N: 1, AllowAlone: true},
+			peers: message.ActivePeers{Peers: []elevator.Id{1, 2, 3}, InMajority: true}, acks: []elevator.Id{1}, expected: request.Unconfirmed},
+		{name: "HealthyClusterTwoAcks", quorum: Quorum{Rule: NOfM, N: 1},
+			peers: message.ActivePeers{Peers: []elevator.Id{1, 2, 3}, InMajority: true}, acks: []elevator.Id{1, 2}, expected: request.Confirmed},
+		{name: "SingleElevatorDefault", quorum: DefaultConfirmationPolicy.Hall,
+			peers: message.ActivePeers{Peers: []elevator.Id{1}, InMajority: true}, acks: []elevator.Id{1}, expected: request.Unconfirmed},
+		{name: "SingleElevatorAloneAllowed", quorum: Quorum{Rule: AllAlive, AllowAlone: true},
+			peers: message.ActivePeers{Peers: []elevator.Id{1}, InMajority: true}, acks: []elevator.Id{1}, expected: request.Confirmed},
+		{name: "IsolatedDefault", quorum: DefaultConfirmationPolicy.Hall, policy: partition.ServeAll,
+			peers: message.ActivePeers{Peers: []elevator.Id{1}, Partitioned: true}, acks: []elevator.Id{1}, expected: request.Unconfirmed},
+		{name: "IsolatedAloneAllowed", quorum: Quorum{Rule: AllAlive, AllowAlone: true}, policy: partition.ServeAll,
+			peers: message.ActivePeers{Peers: []elevator.Id{1}, Partitioned: true}, acks: []elevator.Id{1}, expected: request.Confirmed},
+		{name: "IsolatedMinority", quorum: Quorum{Rule: AllAlive, AllowAlone: true}, policy: partition.Majority,
+			peers: message.ActivePeers{Peers: []elevator.Id{1}, Partitioned: true}, acks: []elevator.Id{1}, expected: request.Unconfirmed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := newRequestManager(elevator.Id(1))
+			rm.policy = tt.policy
+			rm.confirmation = ConfirmationPolicy{Hall: tt.quorum, Cab: DefaultConfirmationPolicy.Cab}
+			rm.ProcessActivePeers(tt.peers)
+
+			var res request.Request
+			for _, id := range tt.acks {
+				res = rm.Process(message.RequestState{Source: id, Request: request.Request{Origin: hall, Status: request.Unconfirmed}})
+			}
+			if res.Status != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, res.Status)
+			}
+		})
+	}
+}
+
+func TestRequestManagerConfirmedWithoutLocalAck(t *testing.T) {
+	hall := request.Hall{Floor: 0, Direction: request.Up}
+
+	rm := newRequestManager(elevator.Id(1))
+	rm.confirmation = ConfirmationPolicy{Hall: Quorum{Rule: Majority}, Cab: DefaultConfirmationPolicy.Cab}
+	rm.alivePeers = []elevator.Id{1, 2, 3}
+
+	rm.Process(message.RequestState{Source: 1, Request: request.Request{Origin: hall, Status: request.Absent}})
+	res := rm.Process(message.RequestState{Source: 2, Request: request.Request{Origin: hall, Status: request.Confirmed}})
+	if res.Status != request.Confirmed {
+		t.Errorf("Expected a request confirmed by the majority to be %v, got %v", request.Confirmed, res.Status)
+	}
+}
+
+func TestRequestManagerStaleConfirmed(t *testing.T) {
+	hall := request.Hall{Floor: 1, Direction: request.Up}
+
+	// The stale confirmed request of "Discovered bug 1" in the comms registry tests
+	rm := newRequestManager(elevator.Id(1))
+	rm.alivePeers = []elevator.Id{1, 2}
+
+	rm.Process(message.RequestState{Source: 1, Request: request.Request{Origin: hall, Status: request.Absent}})
+	res := rm.Process(message.RequestState{Source: 2, Request: request.Request{Origin: hall, Status: request.Confirmed}})
+	if res.Status != request.Absent {
+		t.Errorf("Expected a stale confirmed request to leave the request %v, got %v", request.Absent, res.Status)
+	}
+}
+
+func TestRequestManagerCancelCab(t *testing.T) {
+	cab := request.Cab{Id: 1, Floor: 2}
+	state := func(source elevator.Id, status request.Status) message.RequestState {
+		return message.RequestState{Source: source, Request: request.Request{Origin: cab, Status: status}}
+	}
+
+	t.Run("Confirmed", func(t *testing.T) {
+		rm := newRequestManager(elevator.Id(1))
+		rm.alivePeers = []elevator.Id{1, 2}
+		rm.Process(state(1, request.Unconfirmed))
+		if res := rm.Process(state(2, request.Unconfirmed)); res.Status != request.Confirmed {
+			t.Fatalf("Expected %v, got %v", request.Confirmed, res.Status)
+		}
+
+		res := rm.Process(state(1, request.Absent))
+		if res.Status != request.Absent {
+			t.Errorf("Expected the cancelled cab call to be %v, got %v", request.Absent, res.Status)
+		}
+		if _, ok := rm.PendingCancel(res); ok {
+			t.Errorf("Expected no pending cancel for a confirmed cab call")
+		}
+	})
+
+	t.Run("Unconfirmed", func(t *testing.T) {
+		rm := newRequestManager(elevator.Id(1))
+		rm.alivePeers = []elevator.Id{1, 2}
+		rm.Process(state(1, request.Unconfirmed))
+
+		// The double press arrives before peer 2 acknowledged the cab call
+		res := rm.Process(state(1, request.Absent))
+		if res.Status != request.Unconfirmed {
+			t.Fatalf("Expected the cab call to stay %v, got %v", request.Unconfirmed, res.Status)
+		}
+		if _, ok := rm.PendingCancel(res); ok {
+			t.Fatalf("Expected the cancel to wait for the confirmation")
+		}
+
+		res = rm.Process(state(2, request.Unconfirmed))
+		if res.Status != request.Confirmed {
+			t.Fatalf("Expected %v, got %v", request.Confirmed, res.Status)
+		}
+		cancel, ok := rm.PendingCancel(res)
+		if !ok {
+			t.Fatalf("Expected the cancel to be applied once the cab call is confirmed")
+		}
+		if res = rm.Process(cancel); res.Status != request.Absent {
+			t.Errorf("Expected the cancelled cab call to be %v, got %v", request.Absent, res.Status)
+		}
+		if _, ok := rm.PendingCancel(request.Request{Origin: cab, Status: request.Confirmed}); ok {
+			t.Errorf("Expected the cancel to be applied only once")
+		}
+	})
+
+	t.Run("PressedAgain", func(t *testing.T) {
+		rm := newRequestManager(elevator.Id(1))
+		rm.alivePeers = []elevator.Id{1, 2}
+		rm.Process(state(1, request.Unconfirmed))
+		rm.Process(state(1, request.Absent))
+		rm.Process(state(1, request.Unconfirmed))
+
+		res := rm.Process(state(2, request.Unconfirmed))
+		if _, ok := rm.PendingCancel(res); ok || res.Status != request.Confirmed {
+			t.Errorf("Expected a new press to take back the cancel, got %v", res.Status)
+		}
+	})
+}
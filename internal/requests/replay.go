@@ -0,0 +1,49 @@
+package requests
+
+import (
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/audit"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+// Replayer reproduces the decisions of the requests module from the recorded events of an audit log.
+//
+// It processes the events like RunRequestServer, but without channels and with the time of the events
+// instead of the wall clock, so that a replay is deterministic. The decisions are written to the audit log.
+type Replayer struct {
+	requestManager *requestManager
+	now            time.Time
+}
+
+// NewReplayer creates a replayer that starts like a freshly started requests module
+func NewReplayer(local elevator.Id, confirmation ConfirmationPolicy, policy partition.Policy, auditLog *audit.Logger) *Replayer {
+	r := &Replayer{requestManager: newRequestManager(local)}
+	r.requestManager.SetSynced(false)
+	r.requestManager.policy = policy
+	r.requestManager.confirmation = confirmation
+	r.requestManager.auditLog = auditLog
+	r.requestManager.now = func() time.Time { return r.now }
+	return r
+}
+
+// Process processes a recorded request message that was received at time t
+func (r *Replayer) Process(t time.Time, msg message.RequestState) request.Request {
+	r.now = t
+	return r.requestManager.Process(msg)
+}
+
+// ProcessActivePeers processes a recorded update of the alive peers that was received at time t
+func (r *Replayer) ProcessActivePeers(t time.Time, ap message.ActivePeers) {
+	r.now = t
+	r.requestManager.ProcessActivePeers(ap)
+}
+
+// SetSynced processes the recorded end of the join handshake at time t and returns the confirmed requests
+func (r *Replayer) SetSynced(t time.Time) []request.Request {
+	r.now = t
+	return r.requestManager.SetSynced(true)
+}
@@ -0,0 +1,101 @@
+package requests
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/audit"
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
+	"group48.ttk4145.ntnu/elevators/internal/models/request"
+)
+
+func TestReplayer(t *testing.T) {
+	hall := request.Hall{Floor: 1, Direction: request.Up}
+	cab := request.Cab{Id: 1, Floor: 3}
+	state := func(source elevator.Id, o request.Origin, s request.Status) message.RequestState {
+		return message.RequestState{Source: source, Request: request.Request{Origin: o, Status: s}}
+	}
+
+	// Record a session of a live request manager that joins, confirms requests and goes through a partition
+	var recorded bytes.Buffer
+	rm := newRequestManager(elevator.Id(1))
+	rm.SetSynced(false)
+	rm.policy = partition.ServeAll
+	rm.confirmation = DefaultConfirmationPolicy
+	rm.auditLog = audit.NewWriter(&recorded, elevator.Id(1))
+
+	rm.ProcessActivePeers(message.ActivePeers{Peers: []elevator.Id{1, 2}, InMajority: true})
+	rm.Process(state(2, hall, request.Unconfirmed))
+	rm.SetSynced(true)
+	rm.Process(state(1, hall, request.Unconfirmed))
+	rm.Process(state(1, cab, request.Unconfirmed))
+	rm.Process(state(2, cab, request.Unconfirmed))
+	rm.ProcessActivePeers(message.ActivePeers{Peers: []elevator.Id{1}, Partitioned: true})
+	rm.Process(state(1, hall, request.Absent))
+	rm.Process(state(1, hall, request.Unconfirmed))
+	rm.ProcessActivePeers(message.ActivePeers{Peers: []elevator.Id{1, 2}, InMajority: true})
+	rm.Process(state(2, hall, request.Absent))
+
+	records := parseRecords(t, &recorded)
+
+	// Replay the recorded inputs
+	var replayed bytes.Buffer
+	r := NewReplayer(elevator.Id(1), DefaultConfirmationPolicy, partition.ServeAll, audit.NewWriter(&replayed, elevator.Id(1)))
+	for _, rec := range records {
+		switch rec.Kind {
+		case audit.KindInput:
+			origin, err := audit.FromOrigin(*rec.Origin)
+			if err != nil {
+				t.Fatalf("Failed to convert origin: %v", err)
+			}
+			r.Process(rec.Time, state(elevator.Id(rec.Source), origin, audit.ParseStatus(rec.NewStatus)))
+		case audit.KindPeers:
+			peers := make([]elevator.Id, 0)
+			for _, id := range rec.Peers {
+				peers = append(peers, elevator.Id(id))
+			}
+			r.ProcessActivePeers(rec.Time, message.ActivePeers{Peers: peers, Partitioned: rec.Partitioned, InMajority: rec.InMajority})
+		case audit.KindSynced:
+			r.SetSynced(rec.Time)
+		}
+	}
+
+	expected := decisionsOf(records)
+	got := decisionsOf(parseRecords(t, &replayed))
+	if len(expected) == 0 {
+		t.Fatalf("Expected the recorded session to contain decisions")
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Replayed decisions differ from the recorded ones:\nrecorded: %+v\nreplayed: %+v", expected, got)
+	}
+}
+
+func parseRecords(t *testing.T, buf *bytes.Buffer) []audit.Record {
+	records := make([]audit.Record, 0)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r audit.Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Failed to decode record %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// decisionsOf returns the decisions of the records without their time
+func decisionsOf(records []audit.Record) []audit.Record {
+	res := make([]audit.Record, 0)
+	for _, r := range records {
+		if audit.IsDecision(r.Kind) {
+			r.Time = time.Time{}
+			res = append(res, r)
+		}
+	}
+	return res
+}
@@ -2,11 +2,14 @@
 package requests
 
 import (
+	"context"
 	"log"
 
+	"group48.ttk4145.ntnu/elevators/internal/audit"
 	"group48.ttk4145.ntnu/elevators/internal/elevatorio"
 	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
 	"group48.ttk4145.ntnu/elevators/internal/models/message"
+	"group48.ttk4145.ntnu/elevators/internal/models/partition"
 	"group48.ttk4145.ntnu/elevators/internal/models/request"
 )
 
@@ -14,30 +17,86 @@ import (
 //
 // The processing of requests is done by a requestManager, which keeps track of the state of the requests.
 // The button lighting is set for the local elevator if the request is for the local elevator.
+// The confirmation policy defines the quorums needed to confirm hall and cab requests.
+// The partition policy decides whether hall and destination requests are confirmed while the network is partitioned.
+// Every input and status change of a request is written to the audit log.
+// Every status change is sent to the api as well, which streams it to the web dashboard.
+// The restored requests are taken over from a crashed process and are known without waiting for the peers.
+// A cab call cancelled before it was confirmed is cleared as soon as it is confirmed.
 func RunRequestServer(
+	ctx context.Context,
 	local elevator.Id,
+	confirmation ConfirmationPolicy,
+	policy partition.Policy,
+	restored []request.Request,
+	auditLog *audit.Logger,
 	requestStateUpdates <-chan message.RequestState,
 	currentAlivePeers <-chan message.ActivePeers,
+	syncUpdates <-chan message.Synced,
 	notifyComms chan<- message.RequestState,
-	notifyOrders chan<- message.RequestState) {
+	notifyOrders chan<- message.RequestState,
+	notifyProcessPair chan<- message.RequestState,
+	notifyApi chan<- message.RequestState) {
 
 	var requestManager = newRequestManager(local)
+	// Requests are only confirmed once the local peer has synced with the other peers after joining
+	requestManager.SetSynced(false)
+	requestManager.policy = policy
+	requestManager.confirmation = confirmation
+	requestManager.auditLog = auditLog
+	log.Printf("[requests] Confirming hall calls with quorum %v and cab calls with quorum %v", confirmation.Hall, confirmation.Cab)
 
-	for {
-		select {
-		case msg := <-requestStateUpdates:
-			req := requestManager.Process(msg)
+	// publish sets the button lighting and sends the request to the other modules,
+	// followed by its cancel if it was cancelled locally before it was confirmed
+	publish := func(req request.Request) {
+		for {
 			setButtonLighting(local, req)
 
 			uMsg := message.RequestState{
 				Source:  local,
 				Request: req,
 			}
-			notifyComms <- uMsg
-			notifyOrders <- uMsg
+			for _, c := range []chan<- message.RequestState{notifyComms, notifyOrders, notifyProcessPair, notifyApi} {
+				select {
+				case c <- uMsg:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			cancel, ok := requestManager.PendingCancel(req)
+			if !ok {
+				return
+			}
+			req = requestManager.Process(cancel)
+		}
+	}
+
+	for _, req := range restored {
+		requestManager.Restore(req)
+		publish(req)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[requests] Shutting down")
+			return
+
+		case msg := <-requestStateUpdates:
+			if d, ok := msg.Request.Origin.(request.Destination); ok && !d.IsValid() {
+				log.Printf("[requests] Ignoring invalid destination request %v from %v", d, msg.Source)
+				continue
+			}
+			publish(requestManager.Process(msg))
+
+		case <-syncUpdates:
+			for _, req := range requestManager.SetSynced(true) {
+				publish(req)
+			}
 
 		case ap := <-currentAlivePeers:
-			requestManager.UpdateAlivePeers(ap.Peers)
+			requestManager.ProcessActivePeers(ap)
 		}
 	}
 }
@@ -48,6 +107,10 @@ func setButtonLighting(local elevator.Id, req request.Request) {
 		// The request is for another elevator, do not set the button lighting
 		return
 	}
+	if request.IsDestination(req) {
+		// Destination calls are entered on a keypad which has no button lamp
+		return
+	}
 
 	targetState := req.Status == request.Confirmed
 	elevatorio.SetButtonLamp(req.Origin.GetButtonType(), req.Origin.GetFloor(), targetState)
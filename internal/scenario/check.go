@@ -0,0 +1,212 @@
+package scenario
+
+import (
+	"fmt"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+// Result is the outcome of an expectation
+type Result struct {
+	Expectation Expectation
+	Passed      bool
+	// Detail explains when the expectation was met, or why it was not
+	Detail string
+}
+
+// nodeSample is the recorded state of one node
+type nodeSample struct {
+	snapshot   simulator.Snapshot
+	isRunning  bool
+	isIsolated bool
+}
+
+// sample is the recorded state of all nodes at one point of the timeline
+type sample struct {
+	at    time.Duration
+	nodes []nodeSample
+}
+
+// recording contains the samples of a played scenario, ordered by time
+type recording struct {
+	samples []sample
+}
+
+func (r *recording) record(at time.Duration, cluster *simulator.Cluster) {
+	s := sample{at: at, nodes: make([]nodeSample, cluster.Len())}
+	for i := range s.nodes {
+		s.nodes[i] = nodeSample{
+			snapshot:   cluster.Elevator(i).Snapshot(),
+			isRunning:  cluster.IsRunning(i),
+			isIsolated: cluster.IsIsolated(i),
+		}
+	}
+	r.samples = append(r.samples, s)
+}
+
+// window returns the samples from the time of the expectation until its time limit
+func (r *recording) window(from time.Duration, to time.Duration) []sample {
+	res := make([]sample, 0)
+	for _, s := range r.samples {
+		if s.at >= from && s.at <= to {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// check checks all expectations of the scenario against the recording
+func check(s *Scenario, rec *recording) []Result {
+	results := make([]Result, 0, len(s.Expectations))
+	for _, e := range s.Expectations {
+		var r Result
+		switch e.Check {
+		case Served:
+			r = checkServed(e, rec)
+		case AtFloor:
+			r = checkAtFloor(e, rec)
+		case LampSync:
+			r = checkLampSync(e, rec)
+		}
+		r.Expectation = e
+		results = append(results, r)
+	}
+	return results
+}
+
+// checkServed checks that the door opens at the floor of the call,
+// and that afterwards the lamp of the call is off on all running nodes.
+// A cab call must be served by the elevator of its node.
+func checkServed(e Expectation, rec *recording) Result {
+	isCab := e.Button == elevator.Cab
+	var openedAt time.Duration = -1
+
+	for _, s := range rec.window(e.At, e.At+e.Within) {
+		if openedAt < 0 {
+			for i, n := range s.nodes {
+				if isCab && i != e.Node {
+					continue
+				}
+				if n.snapshot.DoorOpen && n.snapshot.Floor == e.Floor {
+					openedAt = s.at
+				}
+			}
+		}
+		if openedAt < 0 {
+			continue
+		}
+
+		isLit, hasRunning := false, false
+		for i, n := range s.nodes {
+			if !n.isRunning || (isCab && i != e.Node) {
+				continue
+			}
+			hasRunning = true
+			isLit = isLit || n.snapshot.Lamps[e.Floor][e.Button]
+		}
+		if hasRunning && !isLit {
+			return Result{Passed: true, Detail: fmt.Sprintf("served after %v", round(s.at-e.At))}
+		}
+	}
+
+	if openedAt < 0 {
+		return Result{Detail: fmt.Sprintf("the door did not open at floor %d within %v", e.Floor, e.Within)}
+	}
+	return Result{Detail: fmt.Sprintf("the door opened after %v, but the lamp was not turned off within %v", round(openedAt-e.At), e.Within)}
+}
+
+// checkAtFloor checks that the floor sensor of the elevator of the node reports the floor
+func checkAtFloor(e Expectation, rec *recording) Result {
+	for _, s := range rec.window(e.At, e.At+e.Within) {
+		if s.nodes[e.Node].snapshot.Floor == e.Floor {
+			return Result{Passed: true, Detail: fmt.Sprintf("reached after %v", round(s.at-e.At))}
+		}
+	}
+	return Result{Detail: fmt.Sprintf("node %d did not reach floor %d within %v", e.Node, e.Floor, e.Within)}
+}
+
+// checkLampSync checks that every time the lamp of the hall call is lit on one node,
+// it is lit on all other nodes within the time limit.
+//
+// Only nodes that run and are connected during the whole time limit must light the lamp.
+// A lamp lit by an isolated node is not compared, as the other nodes can not know about the call.
+// If the call is served before, so that the lamp is off on all nodes again, the lamps are not compared.
+// The expectation fails if the lamp was never lit, as then the call was not confirmed at all.
+func checkLampSync(e Expectation, rec *recording) Result {
+	samples := rec.window(e.At, rec.samples[len(rec.samples)-1].at)
+	isLit := func(n nodeSample) bool { return n.isRunning && n.snapshot.Lamps[e.Floor][e.Button] }
+	anyLit := func(s sample) bool {
+		for _, n := range s.nodes {
+			if isLit(n) {
+				return true
+			}
+		}
+		return false
+	}
+
+	confirmations := 0
+	var slowest time.Duration
+	for i := 1; i < len(samples); i++ {
+		if !anyLit(samples[i]) || anyLit(samples[i-1]) {
+			continue
+		}
+		confirmations++
+		confirmedAt := samples[i].at
+
+		isIsolated := true
+		for _, n := range samples[i].nodes {
+			isIsolated = isIsolated && (!isLit(n) || n.isIsolated)
+		}
+		if isIsolated {
+			continue
+		}
+
+		isConnected := make([]bool, len(samples[i].nodes))
+		litAt := make([]time.Duration, len(samples[i].nodes))
+		for j := range isConnected {
+			isConnected[j] = true
+			litAt[j] = -1
+		}
+		isCleared := false
+		for _, s := range samples[i:] {
+			if s.at > confirmedAt+e.Within {
+				break
+			}
+			if !anyLit(s) {
+				isCleared = true
+				break
+			}
+			for j, n := range s.nodes {
+				isConnected[j] = isConnected[j] && n.isRunning && !n.isIsolated
+				if litAt[j] < 0 && isLit(n) {
+					litAt[j] = s.at - confirmedAt
+				}
+			}
+		}
+		if isCleared {
+			continue
+		}
+
+		for j := range isConnected {
+			if !isConnected[j] {
+				continue
+			}
+			if litAt[j] < 0 {
+				return Result{Detail: fmt.Sprintf("lit %v into the timeline, but not on node %d within %v", round(confirmedAt), j, e.Within)}
+			}
+			slowest = max(slowest, litAt[j])
+		}
+	}
+
+	if confirmations == 0 {
+		return Result{Detail: "the lamp was never lit"}
+	}
+	return Result{Passed: true, Detail: fmt.Sprintf("lit %d time(s), on all nodes after at most %v", confirmations, round(slowest))}
+}
+
+// round rounds a duration to the sample rate for the report
+func round(d time.Duration) time.Duration {
+	return d.Round(sampleRate)
+}
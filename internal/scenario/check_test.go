@@ -0,0 +1,149 @@
+package scenario
+
+import (
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+// frame describes the state of two nodes at one sample of a synthetic recording
+type frame struct {
+	at       time.Duration
+	doorOpen [2]bool
+	floor    [2]elevator.Floor
+	lit      [2]bool
+	isolated [2]bool
+}
+
+// recordFrames creates a recording of two running nodes, where the lamp is the hall up lamp at floor 2
+func recordFrames(frames []frame) *recording {
+	rec := &recording{}
+	for _, f := range frames {
+		s := sample{at: f.at, nodes: make([]nodeSample, 2)}
+		for i := range s.nodes {
+			snapshot := simulator.Snapshot{Floor: f.floor[i], DoorOpen: f.doorOpen[i]}
+			snapshot.Lamps[2][elevator.HallUp] = f.lit[i]
+			s.nodes[i] = nodeSample{snapshot: snapshot, isRunning: true, isIsolated: f.isolated[i]}
+		}
+		rec.samples = append(rec.samples, s)
+	}
+	return rec
+}
+
+func TestCheckServed(t *testing.T) {
+	served := Expectation{Check: Served, Button: elevator.HallUp, Floor: 2, Within: 10 * time.Second}
+
+	tests := []struct {
+		name   string
+		frames []frame
+		passed bool
+	}{
+		{
+			name: "Door opens and lamps turn off",
+			frames: []frame{
+				{at: 0, floor: [2]elevator.Floor{0, 0}},
+				{at: time.Second, floor: [2]elevator.Floor{0, 0}, lit: [2]bool{true, true}},
+				{at: 5 * time.Second, floor: [2]elevator.Floor{2, 0}, doorOpen: [2]bool{true, false}, lit: [2]bool{true, true}},
+				{at: 6 * time.Second, floor: [2]elevator.Floor{2, 0}, doorOpen: [2]bool{true, false}},
+			},
+			passed: true,
+		},
+		{
+			name: "Door opens at another floor",
+			frames: []frame{
+				{at: time.Second, floor: [2]elevator.Floor{1, 0}, doorOpen: [2]bool{true, false}, lit: [2]bool{true, true}},
+				{at: 2 * time.Second, floor: [2]elevator.Floor{1, 0}, doorOpen: [2]bool{true, false}},
+			},
+			passed: false,
+		},
+		{
+			name: "Lamp stays lit on one node",
+			frames: []frame{
+				{at: time.Second, floor: [2]elevator.Floor{2, 0}, doorOpen: [2]bool{true, false}, lit: [2]bool{true, true}},
+				{at: 2 * time.Second, floor: [2]elevator.Floor{2, 0}, doorOpen: [2]bool{true, false}, lit: [2]bool{false, true}},
+			},
+			passed: false,
+		},
+		{
+			name: "Served too late",
+			frames: []frame{
+				{at: time.Second, floor: [2]elevator.Floor{0, 0}, lit: [2]bool{true, true}},
+				{at: 11 * time.Second, floor: [2]elevator.Floor{2, 0}, doorOpen: [2]bool{true, false}},
+			},
+			passed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if r := checkServed(served, recordFrames(tt.frames)); r.Passed != tt.passed {
+				t.Errorf("expected passed: %v, got %v (%v)", tt.passed, r.Passed, r.Detail)
+			}
+		})
+	}
+}
+
+func TestCheckLampSync(t *testing.T) {
+	sync := Expectation{Check: LampSync, Button: elevator.HallUp, Floor: 2, Within: time.Second}
+
+	tests := []struct {
+		name   string
+		frames []frame
+		passed bool
+	}{
+		{
+			name: "Lit on all nodes in time",
+			frames: []frame{
+				{at: 0},
+				{at: time.Second, lit: [2]bool{true, false}},
+				{at: 1500 * time.Millisecond, lit: [2]bool{true, true}},
+			},
+			passed: true,
+		},
+		{
+			name: "Lit on one node only",
+			frames: []frame{
+				{at: 0},
+				{at: time.Second, lit: [2]bool{true, false}},
+				{at: 3 * time.Second, lit: [2]bool{true, false}},
+			},
+			passed: false,
+		},
+		{
+			name: "Served before the other node lit the lamp",
+			frames: []frame{
+				{at: 0},
+				{at: time.Second, lit: [2]bool{true, false}},
+				{at: 1500 * time.Millisecond},
+			},
+			passed: true,
+		},
+		{
+			name: "Lit by an isolated node",
+			frames: []frame{
+				{at: 0, isolated: [2]bool{true, false}},
+				{at: time.Second, lit: [2]bool{true, false}, isolated: [2]bool{true, false}},
+				{at: 3 * time.Second, lit: [2]bool{true, false}, isolated: [2]bool{true, false}},
+			},
+			passed: true,
+		},
+		{
+			name: "Never lit",
+			frames: []frame{
+				{at: 0},
+				{at: 3 * time.Second},
+			},
+			passed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if r := checkLampSync(sync, recordFrames(tt.frames)); r.Passed != tt.passed {
+				t.Errorf("expected passed: %v, got %v (%v)", tt.passed, r.Passed, r.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+package scenario
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+// Parse reads a scenario file
+//
+// The events and expectations are sorted by their time, and events at the same time keep their order.
+func Parse(r io.Reader) (*Scenario, error) {
+	s := &Scenario{
+		Nodes:       1,
+		StartFloors: make(map[int]elevator.Floor),
+		Settings:    make(map[string]json.RawMessage),
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := s.parseLine(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(s.Events, func(i, j int) bool { return s.Events[i].At < s.Events[j].At })
+	sort.SliceStable(s.Expectations, func(i, j int) bool { return s.Expectations[i].At < s.Expectations[j].At })
+	return s, nil
+}
+
+// parseLine parses a header line, an event or an expectation
+func (s *Scenario) parseLine(line string) error {
+	t := &tokens{words: strings.Fields(line)}
+
+	switch t.peek() {
+	case "name":
+		s.Name = strings.TrimSpace(strings.TrimPrefix(line, "name"))
+		return nil
+	case "nodes":
+		t.next()
+		n, err := t.int()
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return fmt.Errorf("a scenario needs at least one node")
+		}
+		s.Nodes = n
+		return t.end()
+	case "duration":
+		t.next()
+		d, err := t.duration()
+		if err != nil {
+			return err
+		}
+		s.Duration = d
+		return t.end()
+	case "position":
+		t.next()
+		node, err := t.int()
+		if err != nil {
+			return err
+		}
+		floor, err := t.floor()
+		if err != nil {
+			return err
+		}
+		s.StartFloors[node] = floor
+		return t.end()
+	case "set":
+		t.next()
+		key := t.next()
+		value := strings.TrimSpace(strings.Join(t.words[t.i:], " "))
+		if key == "" || !json.Valid([]byte(value)) {
+			return fmt.Errorf("expected: set <key> <json value>")
+		}
+		s.Settings[key] = json.RawMessage(value)
+		return nil
+	}
+
+	// Events and expectations start at the beginning of the timeline if no time is given
+	var at time.Duration
+	if strings.HasPrefix(t.peek(), "t=") {
+		d, err := parseDuration(strings.TrimPrefix(t.next(), "t="))
+		if err != nil {
+			return err
+		}
+		at = d
+	}
+	text := strings.Join(t.words[t.i:], " ")
+
+	if t.peek() == "expect" {
+		t.next()
+		e, err := t.expectation()
+		if err != nil {
+			return err
+		}
+		e.At = at
+		e.Text = text
+		s.Expectations = append(s.Expectations, e)
+		return nil
+	}
+
+	e, err := t.event()
+	if err != nil {
+		return err
+	}
+	e.At = at
+	e.Text = text
+	s.Events = append(s.Events, e)
+	return nil
+}
+
+// validate checks that all events and expectations refer to existing nodes
+func (s *Scenario) validate() error {
+	isValid := func(node int) bool { return node >= 0 && node < s.Nodes }
+	for node := range s.StartFloors {
+		if !isValid(node) {
+			return fmt.Errorf("position of unknown node %d", node)
+		}
+	}
+	for _, e := range s.Events {
+		if !isValid(e.Node) {
+			return fmt.Errorf("%q: unknown node %d", e.Text, e.Node)
+		}
+	}
+	for _, e := range s.Expectations {
+		if !isValid(e.Node) {
+			return fmt.Errorf("%q: unknown node %d", e.Text, e.Node)
+		}
+	}
+	return nil
+}
+
+// tokens are the words of a line, consumed from left to right
+type tokens struct {
+	words []string
+	i     int
+}
+
+// peek returns the next word without consuming it, or an empty string at the end of the line
+func (t *tokens) peek() string {
+	if t.i >= len(t.words) {
+		return ""
+	}
+	return t.words[t.i]
+}
+
+// next consumes the next word, or returns an empty string at the end of the line
+func (t *tokens) next() string {
+	w := t.peek()
+	if w != "" {
+		t.i++
+	}
+	return w
+}
+
+// keyword consumes the next word, which must be one of the given words
+func (t *tokens) keyword(words ...string) (string, error) {
+	w := t.next()
+	for _, k := range words {
+		if w == k {
+			return w, nil
+		}
+	}
+	return "", fmt.Errorf("expected %v, got %q", strings.Join(words, " or "), w)
+}
+
+// end returns an error if there are words left on the line
+func (t *tokens) end() error {
+	if w := t.peek(); w != "" {
+		return fmt.Errorf("unexpected %q", w)
+	}
+	return nil
+}
+
+func (t *tokens) int() (int, error) {
+	w := t.next()
+	n, err := strconv.Atoi(w)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number, got %q", w)
+	}
+	return n, nil
+}
+
+func (t *tokens) floor() (elevator.Floor, error) {
+	f, err := t.int()
+	if err != nil {
+		return 0, err
+	}
+	if f < 0 || f >= int(elevator.NumFloors) {
+		return 0, fmt.Errorf("floor %d does not exist", f)
+	}
+	return elevator.Floor(f), nil
+}
+
+func (t *tokens) duration() (time.Duration, error) {
+	return parseDuration(t.next())
+}
+
+// button parses "hall up|down <floor>" or "cab <floor>"
+func (t *tokens) button() (elevator.ButtonType, elevator.Floor, error) {
+	kind, err := t.keyword("hall", "cab")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	btn := elevator.Cab
+	if kind == "hall" {
+		dir, err := t.keyword("up", "down")
+		if err != nil {
+			return 0, 0, err
+		}
+		btn = elevator.HallUp
+		if dir == "down" {
+			btn = elevator.HallDown
+		}
+	}
+
+	floor, err := t.floor()
+	if err != nil {
+		return 0, 0, err
+	}
+	if (btn == elevator.HallUp && floor == elevator.NumFloors-1) || (btn == elevator.HallDown && floor == 0) {
+		return 0, 0, fmt.Errorf("floor %d has no %v button", floor, btn)
+	}
+	return btn, floor, nil
+}
+
+// optionalNode parses "on <node>" if present and returns node 0 otherwise
+func (t *tokens) optionalNode() (int, error) {
+	if t.peek() != "on" {
+		return 0, nil
+	}
+	t.next()
+	return t.int()
+}
+
+// event parses the event of a timeline line
+func (t *tokens) event() (Event, error) {
+	w := t.next()
+	if w == "press" {
+		btn, floor, err := t.button()
+		if err != nil {
+			return Event{}, err
+		}
+		node, err := t.optionalNode()
+		if err != nil {
+			return Event{}, err
+		}
+		return Event{Action: Press, Node: node, Button: btn, Floor: floor}, t.end()
+	}
+
+	action, ok := actionNames[w]
+	if !ok {
+		return Event{}, fmt.Errorf("unknown event %q", w)
+	}
+	node, err := t.int()
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Action: action, Node: node}, t.end()
+}
+
+// expectation parses the expectation following the word expect
+func (t *tokens) expectation() (Expectation, error) {
+	switch t.peek() {
+	case "node":
+		t.next()
+		node, err := t.int()
+		if err != nil {
+			return Expectation{}, err
+		}
+		if _, err := t.keyword("at"); err != nil {
+			return Expectation{}, err
+		}
+		if _, err := t.keyword("floor"); err != nil {
+			return Expectation{}, err
+		}
+		floor, err := t.floor()
+		if err != nil {
+			return Expectation{}, err
+		}
+		within, err := t.within()
+		if err != nil {
+			return Expectation{}, err
+		}
+		return Expectation{Check: AtFloor, Node: node, Floor: floor, Within: within}, t.end()
+
+	case "lamp":
+		t.next()
+		btn, floor, err := t.button()
+		if err != nil {
+			return Expectation{}, err
+		}
+		if btn == elevator.Cab {
+			return Expectation{}, fmt.Errorf("cab lamps are only lit on their own node")
+		}
+		for _, k := range []string{"on", "all"} {
+			if _, err := t.keyword(k); err != nil {
+				return Expectation{}, err
+			}
+		}
+		within, err := t.within()
+		if err != nil {
+			return Expectation{}, err
+		}
+		for _, k := range []string{"of", "confirm"} {
+			if _, err := t.keyword(k); err != nil {
+				return Expectation{}, err
+			}
+		}
+		return Expectation{Check: LampSync, Button: btn, Floor: floor, Within: within}, t.end()
+	}
+
+	btn, floor, err := t.button()
+	if err != nil {
+		return Expectation{}, err
+	}
+	node, err := t.optionalNode()
+	if err != nil {
+		return Expectation{}, err
+	}
+	if _, err := t.keyword("served"); err != nil {
+		return Expectation{}, err
+	}
+	within, err := t.within()
+	if err != nil {
+		return Expectation{}, err
+	}
+	return Expectation{Check: Served, Node: node, Button: btn, Floor: floor, Within: within}, t.end()
+}
+
+// within parses "within <duration>"
+func (t *tokens) within() (time.Duration, error) {
+	if _, err := t.keyword("within"); err != nil {
+		return 0, err
+	}
+	return t.duration()
+}
+
+// parseDuration parses a duration, where a plain number is a number of seconds
+func parseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration, got %q", s)
+	}
+	return d, nil
+}
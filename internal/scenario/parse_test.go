@@ -0,0 +1,105 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+func TestParse(t *testing.T) {
+	input := `
+# Comments and empty lines are ignored
+name obstructed elevator
+nodes 3
+duration 30s
+position 1 3
+set partition_policy "majority"
+
+t=5 obstruct 0          # sorted by time
+t=0 press hall up 2 on 1
+t=3s disconnect 2
+t=0.5 press cab 1
+expect hall up 2 served within 20s
+t=2 expect cab 1 on 0 served within 15s
+t=1 expect node 1 at floor 2 within 10
+expect lamp hall up 2 on all within 1s of confirm
+`
+	s, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.Name != "obstructed elevator" || s.Nodes != 3 || s.Duration != 30*time.Second {
+		t.Errorf("unexpected header: %q, %d nodes, %v", s.Name, s.Nodes, s.Duration)
+	}
+	if s.StartFloors[1] != 3 {
+		t.Errorf("expected node 1 to start at floor 3, got %v", s.StartFloors)
+	}
+	if string(s.Settings["partition_policy"]) != `"majority"` {
+		t.Errorf("unexpected settings: %v", s.Settings)
+	}
+
+	expectedEvents := []Event{
+		{At: 0, Action: Press, Node: 1, Button: elevator.HallUp, Floor: 2},
+		{At: 500 * time.Millisecond, Action: Press, Node: 0, Button: elevator.Cab, Floor: 1},
+		{At: 3 * time.Second, Action: Disconnect, Node: 2},
+		{At: 5 * time.Second, Action: Obstruct, Node: 0},
+	}
+	if len(s.Events) != len(expectedEvents) {
+		t.Fatalf("expected %d events, got %d", len(expectedEvents), len(s.Events))
+	}
+	for i, e := range expectedEvents {
+		e.Text = s.Events[i].Text
+		if s.Events[i] != e {
+			t.Errorf("event %d: expected %+v, got %+v", i, e, s.Events[i])
+		}
+	}
+
+	expectedExpectations := []Expectation{
+		{At: 0, Within: 20 * time.Second, Check: Served, Button: elevator.HallUp, Floor: 2},
+		{At: 0, Within: time.Second, Check: LampSync, Button: elevator.HallUp, Floor: 2},
+		{At: time.Second, Within: 10 * time.Second, Check: AtFloor, Node: 1, Floor: 2},
+		{At: 2 * time.Second, Within: 15 * time.Second, Check: Served, Button: elevator.Cab, Floor: 1},
+	}
+	if len(s.Expectations) != len(expectedExpectations) {
+		t.Fatalf("expected %d expectations, got %d", len(expectedExpectations), len(s.Expectations))
+	}
+	for i, e := range expectedExpectations {
+		e.Text = s.Expectations[i].Text
+		if s.Expectations[i] != e {
+			t.Errorf("expectation %d: expected %+v, got %+v", i, e, s.Expectations[i])
+		}
+	}
+
+	if s.End() != 30*time.Second {
+		t.Errorf("expected the scenario to end after 30s, got %v", s.End())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Unknown event", input: "t=0 explode 1"},
+		{name: "Unknown node", input: "nodes 2\nt=0 kill 2"},
+		{name: "Missing floor", input: "t=0 press hall up"},
+		{name: "Floor out of range", input: "t=0 press cab 9"},
+		{name: "No hall up button at the top floor", input: "t=0 press hall up 3"},
+		{name: "Invalid time", input: "t=soon press cab 1"},
+		{name: "Trailing words", input: "t=0 obstruct 1 now"},
+		{name: "Cab lamp sync", input: "expect lamp cab 1 on all within 1s of confirm"},
+		{name: "Missing time limit", input: "expect hall up 1 served"},
+		{name: "Invalid setting", input: "set partition_policy majority"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("expected an error for %q", tt.input)
+			}
+		})
+	}
+}
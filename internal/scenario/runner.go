@@ -0,0 +1,122 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+// sampleRate is the rate at which the simulated elevators are recorded
+const sampleRate = 20 * time.Millisecond
+
+// Runner runs scenarios with a built elevator binary
+type Runner struct {
+	// Binary is the path of the elevator executable
+	Binary string
+	// Dir is the directory the configs and logs of the nodes are written to
+	Dir string
+	// BasePort is the broadcast port of the nodes. The following ports are used by the simulators and the APIs.
+	BasePort int
+	// Warmup is the time the nodes get to start and find each other before the timeline starts
+	Warmup time.Duration
+	// Simulator defines the physical properties of the simulated elevators
+	Simulator simulator.Config
+}
+
+// Run plays the timeline of the scenario and checks its expectations
+//
+// An error is returned if the simulation could not be set up. A failed expectation is not an error,
+// but reported in the results.
+func (r *Runner) Run(ctx context.Context, s *Scenario) ([]Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cluster, err := simulator.StartCluster(ctx, simulator.ClusterConfig{
+		Binary:      r.Binary,
+		Dir:         r.Dir,
+		BasePort:    r.BasePort,
+		Nodes:       s.Nodes,
+		Elevator:    r.Simulator,
+		StartFloors: s.StartFloors,
+		Settings:    s.Settings,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cluster.Close()
+
+	log.Printf("[scenario] Started %d nodes, waiting %v for them to find each other", s.Nodes, r.Warmup)
+	select {
+	case <-time.After(r.Warmup):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	rec, err := play(ctx, s, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return check(s, rec), nil
+}
+
+// play applies the events of the timeline and records the simulated elevators until the end of the scenario
+func play(ctx context.Context, s *Scenario, cluster *simulator.Cluster) (*recording, error) {
+	rec := &recording{}
+	events := s.Events
+	end := s.End()
+
+	ticker := time.NewTicker(sampleRate)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		now := time.Since(start)
+		for len(events) > 0 && events[0].At <= now {
+			log.Printf("[scenario] t=%v %v", events[0].At, events[0].Text)
+			if err := apply(events[0], cluster); err != nil {
+				return nil, fmt.Errorf("%q: %w", events[0].Text, err)
+			}
+			events = events[1:]
+		}
+		rec.record(now, cluster)
+		if now > end {
+			return rec, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// apply applies an event to its node
+func apply(e Event, cluster *simulator.Cluster) error {
+	elevator := cluster.Elevator(e.Node)
+	switch e.Action {
+	case Press:
+		elevator.Press(e.Button, e.Floor)
+	case Obstruct:
+		elevator.SetObstruction(true)
+	case Unobstruct:
+		elevator.SetObstruction(false)
+	case Stall:
+		elevator.SetStalled(true)
+	case Unstall:
+		elevator.SetStalled(false)
+	case Disconnect:
+		return cluster.SetIsolated(e.Node, true)
+	case Reconnect:
+		return cluster.SetIsolated(e.Node, false)
+	case Kill:
+		cluster.Kill(e.Node)
+	case Stop:
+		cluster.Stop(e.Node)
+	case Start:
+		return cluster.Start(e.Node)
+	}
+	return nil
+}
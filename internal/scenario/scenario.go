@@ -0,0 +1,154 @@
+// scenario is a package that runs end-to-end acceptance tests of a cluster of elevators.
+//
+// A scenario is a text file that describes a timeline of events for a multi-node simulation,
+// like button presses, obstructions, network faults and crashes, together with expectations
+// that must hold, like a hall call being served within a time limit.
+// The runner starts a simulated elevator and a node process for every elevator,
+// plays the timeline and checks the expectations against the recorded simulation.
+//
+// The format is line based, and everything after a # is a comment:
+//
+//	name obstructed elevator
+//	nodes 3
+//	duration 30s
+//	position 1 3
+//	set partition_policy "majority"
+//
+//	t=0 press hall up 2 on 1
+//	t=3 disconnect 2
+//	t=5 obstruct 0
+//	t=0 expect hall up 2 served within 20s
+//	t=0 expect lamp hall up 2 on all within 1s of confirm
+//
+// The header lines give the name, the number of nodes, the duration of the timeline,
+// the start floor of an elevator and config values that are set on all nodes.
+// The time of an event is given in seconds or as a duration, and is relative to the start of the timeline.
+//
+// Events:
+//
+//	press hall up|down <floor> [on <node>]
+//	press cab <floor> [on <node>]
+//	obstruct|unobstruct <node>    toggle the obstruction switch
+//	stall|unstall <node>          stop the motor from moving the car
+//	disconnect|reconnect <node>   cut the node off from the network
+//	kill <node>                   crash the node process
+//	stop <node>                   shut the node process down gracefully
+//	start <node>                  start a killed or stopped node again
+//
+// Expectations, checked from their time on:
+//
+//	expect hall up|down <floor> served within <duration>
+//	expect cab <floor> on <node> served within <duration>
+//	expect node <node> at floor <floor> within <duration>
+//	expect lamp hall up|down <floor> on all within <duration> of confirm
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+// Scenario is a parsed scenario file
+type Scenario struct {
+	Name     string
+	Nodes    int
+	Duration time.Duration
+	// StartFloors contains the floors the elevators start at. Elevators that are not listed start at floor 0.
+	StartFloors map[int]elevator.Floor
+	// Settings contains config values that are set on all nodes
+	Settings     map[string]json.RawMessage
+	Events       []Event
+	Expectations []Expectation
+}
+
+// Action is the kind of an event
+type Action int
+
+const (
+	Press Action = iota
+	Obstruct
+	Unobstruct
+	Stall
+	Unstall
+	Disconnect
+	Reconnect
+	Kill
+	Stop
+	Start
+)
+
+// actionNames maps the words of the scenario format to the actions that take a node as only argument
+var actionNames = map[string]Action{
+	"obstruct":   Obstruct,
+	"unobstruct": Unobstruct,
+	"stall":      Stall,
+	"unstall":    Unstall,
+	"disconnect": Disconnect,
+	"reconnect":  Reconnect,
+	"kill":       Kill,
+	"stop":       Stop,
+	"start":      Start,
+}
+
+// Event is something that happens to a node at a point of the timeline
+type Event struct {
+	At     time.Duration
+	Action Action
+	Node   int
+	// Button and Floor are the pressed button of a press event
+	Button elevator.ButtonType
+	Floor  elevator.Floor
+	// Text is the event as written in the scenario file
+	Text string
+}
+
+// Check is the kind of an expectation
+type Check int
+
+const (
+	// Served expects the call to be served: the door opens at the floor, and afterwards the lamp is off on all running nodes
+	Served Check = iota
+	// AtFloor expects the elevator of the node to reach the floor
+	AtFloor
+	// LampSync expects the lamp of a hall call to be lit on all connected nodes once it is lit on one of them
+	LampSync
+)
+
+// Expectation is a condition that must hold within a time limit from a point of the timeline
+type Expectation struct {
+	At     time.Duration
+	Within time.Duration
+	Check  Check
+	Node   int
+	Button elevator.ButtonType
+	Floor  elevator.Floor
+	// Text is the expectation as written in the scenario file
+	Text string
+}
+
+// End returns the time after which the scenario has no more events or expectations
+func (s *Scenario) End() time.Duration {
+	end := s.Duration
+	for _, e := range s.Events {
+		end = max(end, e.At)
+	}
+	for _, e := range s.Expectations {
+		end = max(end, e.At+e.Within)
+	}
+	return end
+}
+
+func (a Action) String() string {
+	if a == Press {
+		return "press"
+	}
+	for name, action := range actionNames {
+		if action == a {
+			return name
+		}
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
@@ -0,0 +1,255 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+// exitTimeout is the time a node gets to exit before it is killed
+const exitTimeout = 15 * time.Second
+
+// ClusterConfig defines a cluster of simulated elevators
+type ClusterConfig struct {
+	// Binary is the path of the elevator executable
+	Binary string
+	// Dir is the directory the configs and logs of the nodes are written to
+	Dir string
+	// BasePort is the broadcast port of the nodes. The following ports are used by the simulators and the APIs.
+	BasePort int
+	// Nodes is the number of elevators
+	Nodes int
+	// Elevator defines the physical properties of the simulated elevators
+	Elevator Config
+	// StartFloors contains the floors the elevators start at. Elevators that are not listed start at floor 0.
+	StartFloors map[int]elevator.Floor
+	// Settings contains config values that are set on all nodes
+	Settings map[string]json.RawMessage
+}
+
+// Cluster is a simulated elevator together with the process of the node that controls it, for every elevator.
+//
+// The nodes are controlled by the goroutine that started the cluster.
+type Cluster struct {
+	binary string
+	nodes  []*node
+}
+
+// node is a simulated elevator together with the process of the node that controls it
+type node struct {
+	id         int
+	elevator   *Elevator
+	listener   net.Listener
+	configPath string
+	logPath    string
+	apiAddr    string
+
+	cmd *exec.Cmd
+	// exited is closed when the process of the node exited
+	exited chan bool
+	// isIsolated is true while the node is cut off from the network
+	isIsolated bool
+}
+
+// StartCluster starts the simulated elevators and the node processes
+//
+// The node with index i has the id i. The processes are stopped when the cluster is closed.
+func StartCluster(ctx context.Context, config ClusterConfig) (*Cluster, error) {
+	c := &Cluster{binary: config.Binary, nodes: make([]*node, 0, config.Nodes)}
+	for id := 0; id < config.Nodes; id++ {
+		n, err := setupNode(ctx, config, id)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.nodes = append(c.nodes, n)
+		if err := n.start(c.binary); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Len returns the number of nodes
+func (c *Cluster) Len() int {
+	return len(c.nodes)
+}
+
+// Elevator returns the simulated elevator of the node
+func (c *Cluster) Elevator(i int) *Elevator {
+	return c.nodes[i].elevator
+}
+
+// IsRunning returns true if the process of the node runs
+func (c *Cluster) IsRunning(i int) bool {
+	return c.nodes[i].isRunning()
+}
+
+// IsIsolated returns true if the node is cut off from the network
+func (c *Cluster) IsIsolated(i int) bool {
+	return c.nodes[i].isIsolated
+}
+
+// Kill crashes the process of the node
+func (c *Cluster) Kill(i int) {
+	c.nodes[i].stop(syscall.SIGKILL)
+}
+
+// Stop shuts the process of the node down gracefully and waits until it exited
+func (c *Cluster) Stop(i int) {
+	c.nodes[i].stop(syscall.SIGTERM)
+}
+
+// Start starts a killed or stopped node again
+func (c *Cluster) Start(i int) error {
+	n := c.nodes[i]
+	if n.isRunning() {
+		return fmt.Errorf("node %d is already running", n.id)
+	}
+	// A restarted node is connected again, as the network fault was part of the crashed process
+	n.isIsolated = false
+	return n.start(c.binary)
+}
+
+// SetIsolated cuts the node off from the network or connects it again, using the API of the node
+func (c *Cluster) SetIsolated(i int, isIsolated bool) error {
+	return c.nodes[i].setIsolated(isIsolated)
+}
+
+// Close stops all nodes and their simulated elevators
+func (c *Cluster) Close() {
+	for _, n := range c.nodes {
+		n.stop(syscall.SIGTERM)
+		n.listener.Close()
+	}
+}
+
+// setupNode starts the simulated elevator of a node and writes the config of the node
+func setupNode(ctx context.Context, config ClusterConfig, id int) (*node, error) {
+	elevatorConfig := config.Elevator
+	elevatorConfig.StartFloor = config.StartFloors[id]
+	e := New(elevatorConfig)
+
+	elevatorAddr := fmt.Sprintf("localhost:%d", config.BasePort+1+id)
+	listener, err := net.Listen("tcp", elevatorAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the simulator of node %d: %w", id, err)
+	}
+	go e.Serve(ctx, listener)
+
+	n := &node{
+		id:         id,
+		elevator:   e,
+		listener:   listener,
+		configPath: filepath.Join(config.Dir, fmt.Sprintf("node%d.json", id)),
+		logPath:    filepath.Join(config.Dir, fmt.Sprintf("node%d.log", id)),
+		apiAddr:    fmt.Sprintf("localhost:%d", config.BasePort+1+config.Nodes+id),
+	}
+
+	nodeConfig := map[string]any{
+		"elevator_addr":            elevatorAddr,
+		"local_peer_id":            id,
+		"local_port":               config.BasePort,
+		"api_addr":                 n.apiAddr,
+		"cluster_size":             config.Nodes,
+		"assignment_hysteresis_ms": 3000,
+	}
+	for key, value := range config.Settings {
+		nodeConfig[key] = value
+	}
+	b, err := json.MarshalIndent(nodeConfig, "", "  ")
+	if err == nil {
+		err = os.WriteFile(n.configPath, b, 0o644)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// start starts the process of the node, which appends its output to the log of the node
+func (n *node) start(binary string) error {
+	logFile, err := os.OpenFile(n.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(binary, "-config", n.configPath)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return fmt.Errorf("failed to start node %d: %w", n.id, err)
+	}
+
+	n.cmd = cmd
+	n.exited = make(chan bool)
+	go func(exited chan bool) {
+		cmd.Wait()
+		logFile.Close()
+		close(exited)
+	}(n.exited)
+	return nil
+}
+
+// isRunning returns true if the process of the node was started and has not exited
+func (n *node) isRunning() bool {
+	if n.cmd == nil {
+		return false
+	}
+	select {
+	case <-n.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop sends the signal to the process of the node and waits until it exited
+func (n *node) stop(sig syscall.Signal) {
+	if !n.isRunning() {
+		return
+	}
+	n.cmd.Process.Signal(sig)
+	select {
+	case <-n.exited:
+	case <-time.After(exitTimeout):
+		log.Printf("[simulator] Node %d did not exit within %v, killing it", n.id, exitTimeout)
+		n.cmd.Process.Kill()
+		<-n.exited
+	}
+}
+
+// setIsolated simulates a network fault of the node over its API
+func (n *node) setIsolated(isIsolated bool) error {
+	method := http.MethodDelete
+	if isIsolated {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, "http://"+n.apiAddr+"/api/fault/network", nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("the API of node %d answered %v", n.id, res.Status)
+	}
+	n.isIsolated = isIsolated
+	return nil
+}
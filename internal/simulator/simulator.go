@@ -0,0 +1,256 @@
+// simulator is a package that simulates the hardware of an elevator for end-to-end tests.
+//
+// The simulated elevator is served over TCP with the same protocol as the elevator server,
+// so that a node connects to it like to the real hardware. The car moves between the floors
+// while the motor runs, and the floor sensor is active in a small window around every floor.
+// Buttons, the obstruction switch and hardware faults are controlled by the test,
+// and the lamps and the position of the car can be inspected at any time.
+// A cluster starts a simulated elevator together with a node process for every elevator of a test.
+package simulator
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+// tickRate is the rate at which the position of the car is updated
+const tickRate = 5 * time.Millisecond
+
+// Config defines the physical properties of the simulated elevator
+type Config struct {
+	// TravelTime is the time the car needs to travel from one floor to the next
+	TravelTime time.Duration
+	// SensorWidth is the part of the distance between two floors in which the floor sensor is active, centered at the floor
+	SensorWidth float64
+	// PressDuration is the time a pressed button is held down
+	PressDuration time.Duration
+	// StartFloor is the floor the car starts at
+	StartFloor elevator.Floor
+}
+
+// DefaultConfig returns a config that behaves like the simulator of the course
+func DefaultConfig() Config {
+	return Config{
+		TravelTime:    2 * time.Second,
+		SensorWidth:   0.1,
+		PressDuration: 150 * time.Millisecond,
+		StartFloor:    0,
+	}
+}
+
+// Snapshot is the state of the simulated elevator at one point in time
+type Snapshot struct {
+	// Position is the position of the car in floors, e.g. 1.5 is halfway between floor 1 and 2
+	Position float64
+	// Floor is the floor reported by the floor sensor, or -1 between the floors
+	Floor elevator.Floor
+	// Direction is the direction the motor is driven in
+	Direction elevator.MotorDirection
+	// DoorOpen is true if the door open lamp is lit
+	DoorOpen bool
+	// Lamps contains the button lamps, indexed by floor and button type
+	Lamps elevator.Order
+	// FloorIndicator is the floor shown by the floor indicator
+	FloorIndicator elevator.Floor
+	// Obstructed is true if the obstruction switch is active
+	Obstructed bool
+	// Stalled is true if the motor does not move the car
+	Stalled bool
+	// Traveled is the distance in floors the car traveled since the start, a measure of the used energy
+	Traveled float64
+}
+
+// Elevator is a simulated elevator. It is safe for concurrent use.
+type Elevator struct {
+	mtx    sync.Mutex
+	config Config
+
+	position       float64
+	direction      elevator.MotorDirection
+	lamps          elevator.Order
+	doorOpen       bool
+	floorIndicator elevator.Floor
+	obstructed     bool
+	stalled        bool
+	traveled       float64
+
+	// pressedUntil is the time until which a button is held down
+	pressedUntil [elevator.NumFloors][3]time.Time
+}
+
+// New creates a simulated elevator that stands at the start floor
+func New(config Config) *Elevator {
+	return &Elevator{
+		config:   config,
+		position: float64(config.StartFloor),
+	}
+}
+
+// Serve accepts connections of nodes on the listener and serves the elevator to them.
+// It should be run as a goroutine and moves the car until the context is done.
+func (e *Elevator) Serve(ctx context.Context, listener net.Listener) {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	go e.move(ctx)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[simulator] Stopped accepting connections: %v", err)
+			}
+			return
+		}
+		go e.handle(ctx, conn)
+	}
+}
+
+// Press holds the button down for the press duration
+func (e *Elevator) Press(btn elevator.ButtonType, floor elevator.Floor) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.pressedUntil[floor][btn] = time.Now().Add(e.config.PressDuration)
+}
+
+// SetObstruction sets the obstruction switch
+func (e *Elevator) SetObstruction(isObstructed bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.obstructed = isObstructed
+}
+
+// SetStalled makes the motor stop moving the car, although it is still driven, like a broken engine
+func (e *Elevator) SetStalled(isStalled bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.stalled = isStalled
+}
+
+// Snapshot returns the current state of the elevator
+func (e *Elevator) Snapshot() Snapshot {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return Snapshot{
+		Position:       e.position,
+		Floor:          e.sensorLocked(),
+		Direction:      e.direction,
+		DoorOpen:       e.doorOpen,
+		Lamps:          e.lamps,
+		FloorIndicator: e.floorIndicator,
+		Obstructed:     e.obstructed,
+		Stalled:        e.stalled,
+		Traveled:       e.traveled,
+	}
+}
+
+// move updates the position of the car according to the motor until the context is done
+//
+// The car stops at the top and bottom floor, as if it hit the end of the shaft.
+func (e *Elevator) move(ctx context.Context) {
+	ticker := time.NewTicker(tickRate)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.mtx.Lock()
+			if !e.stalled && e.direction != elevator.Stop {
+				position := e.position + float64(e.direction)*float64(now.Sub(last))/float64(e.config.TravelTime)
+				position = math.Max(0, math.Min(float64(elevator.NumFloors-1), position))
+				e.traveled += math.Abs(position - e.position)
+				e.position = position
+			}
+			e.mtx.Unlock()
+			last = now
+		}
+	}
+}
+
+// sensorLocked returns the floor reported by the floor sensor, or -1 if the car is between the floors
+func (e *Elevator) sensorLocked() elevator.Floor {
+	nearest := math.Round(e.position)
+	if math.Abs(e.position-nearest) > e.config.SensorWidth/2 {
+		return -1
+	}
+	return elevator.Floor(nearest)
+}
+
+// handle answers the commands of one node until the connection is closed
+func (e *Elevator) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var cmd [4]byte
+	for {
+		if _, err := io.ReadFull(conn, cmd[:]); err != nil {
+			return
+		}
+		reply, hasReply := e.execute(cmd)
+		if !hasReply {
+			continue
+		}
+		if _, err := conn.Write(reply[:]); err != nil {
+			return
+		}
+	}
+}
+
+// execute executes a command of the elevator server protocol and returns the reply if the command has one
+func (e *Elevator) execute(cmd [4]byte) ([4]byte, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	switch cmd[0] {
+	case 1:
+		e.direction = elevator.MotorDirection(int8(cmd[1]))
+	case 2:
+		if isValidButton(cmd[1], cmd[2]) {
+			e.lamps[cmd[2]][cmd[1]] = cmd[3] != 0
+		}
+	case 3:
+		e.floorIndicator = elevator.Floor(cmd[1])
+	case 4:
+		e.doorOpen = cmd[1] != 0
+	case 5:
+		// The stop button and its lamp are not simulated
+	case 6:
+		isPressed := isValidButton(cmd[1], cmd[2]) && time.Now().Before(e.pressedUntil[cmd[2]][cmd[1]])
+		return [4]byte{6, toByte(isPressed), 0, 0}, true
+	case 7:
+		floor := e.sensorLocked()
+		if floor == -1 {
+			return [4]byte{7, 0, 0, 0}, true
+		}
+		return [4]byte{7, 1, byte(floor), 0}, true
+	case 8:
+		return [4]byte{8, 0, 0, 0}, true
+	case 9:
+		return [4]byte{9, toByte(e.obstructed), 0, 0}, true
+	}
+	return [4]byte{}, false
+}
+
+func isValidButton(btn byte, floor byte) bool {
+	return btn < 3 && int(floor) < int(elevator.NumFloors)
+}
+
+func toByte(a bool) byte {
+	if a {
+		return 1
+	}
+	return 0
+}
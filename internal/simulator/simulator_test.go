@@ -0,0 +1,91 @@
+package simulator
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+func TestProtocol(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := DefaultConfig()
+	config.TravelTime = 200 * time.Millisecond
+	config.PressDuration = time.Second
+	e := New(config)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go e.Serve(ctx, listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	send := func(cmd [4]byte) {
+		if _, err := conn.Write(cmd[:]); err != nil {
+			t.Fatalf("failed to send %v: %v", cmd, err)
+		}
+	}
+	query := func(cmd [4]byte) [4]byte {
+		send(cmd)
+		var reply [4]byte
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			t.Fatalf("failed to read the reply to %v: %v", cmd, err)
+		}
+		return reply
+	}
+
+	if reply := query([4]byte{7, 0, 0, 0}); reply != [4]byte{7, 1, 0, 0} {
+		t.Errorf("expected the car at floor 0, got %v", reply)
+	}
+
+	e.Press(elevator.HallUp, 2)
+	if reply := query([4]byte{6, byte(elevator.HallUp), 2, 0}); reply[1] != 1 {
+		t.Errorf("expected the button to be pressed, got %v", reply)
+	}
+	if reply := query([4]byte{6, byte(elevator.HallDown), 2, 0}); reply[1] != 0 {
+		t.Errorf("expected the other button to be released, got %v", reply)
+	}
+
+	e.SetObstruction(true)
+	if reply := query([4]byte{9, 0, 0, 0}); reply[1] != 1 {
+		t.Errorf("expected the obstruction switch to be active, got %v", reply)
+	}
+
+	send([4]byte{2, byte(elevator.Cab), 3, 1})
+	send([4]byte{4, 1, 0, 0})
+	send([4]byte{1, 1, 0, 0})
+	query([4]byte{8, 0, 0, 0})
+	s := e.Snapshot()
+	if !s.Lamps[3][elevator.Cab] || !s.DoorOpen || s.Direction != elevator.Up {
+		t.Errorf("expected the cab lamp and door lamp lit and the motor running up, got %+v", s)
+	}
+
+	// The car moves up and stops at the top floor
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Snapshot().Floor != elevator.NumFloors-1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if s := e.Snapshot(); s.Position != float64(elevator.NumFloors-1) {
+		t.Errorf("expected the car to stop at the top floor, got position %v", s.Position)
+	}
+
+	// A stalled motor does not move the car
+	e.SetStalled(true)
+	send([4]byte{1, byte(0xff), 0, 0})
+	time.Sleep(100 * time.Millisecond)
+	if s := e.Snapshot(); s.Direction != elevator.Down || s.Position != float64(elevator.NumFloors-1) {
+		t.Errorf("expected the stalled car to stay at the top floor, got %+v", s)
+	}
+}
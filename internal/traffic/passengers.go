@@ -0,0 +1,252 @@
+package traffic
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+// updateRate is the rate at which the passengers look at the simulated elevators
+const updateRate = 20 * time.Millisecond
+
+// repressTimeout is the time after which a passenger presses a button again if its lamp is not lit,
+// e.g. because the node the button belongs to crashed
+const repressTimeout = 3 * time.Second
+
+// Report contains the measurements of a traffic run
+type Report struct {
+	// Passengers is the number of passengers that arrived
+	Passengers int
+	// Delivered is the number of passengers that reached their destination
+	Delivered int
+	// AvgWait and MaxWait are the times from the arrival until boarding of the passengers that boarded
+	AvgWait time.Duration
+	MaxWait time.Duration
+	// AvgTravel and MaxTravel are the times from boarding until reaching the destination of the delivered passengers
+	AvgTravel time.Duration
+	MaxTravel time.Duration
+	// Traveled is the number of floors traveled by all elevators, a measure of the used energy
+	Traveled float64
+}
+
+// state is the progress of a passenger
+type state int
+
+const (
+	notArrived state = iota
+	waiting
+	riding
+	delivered
+)
+
+// passenger is a passenger of a traffic run
+type passenger struct {
+	Arrival
+	state      state
+	car        int
+	boardedAt  time.Duration
+	alightedAt time.Duration
+	// pressedAt is the time the passenger last pressed a button
+	pressedAt time.Duration
+}
+
+// press is a button press of a passenger on the elevator of a node
+type press struct {
+	node   int
+	button elevator.ButtonType
+	floor  elevator.Floor
+}
+
+// car is the state of the elevator of a node as seen by the passengers
+type car struct {
+	snapshot  simulator.Snapshot
+	isRunning bool
+}
+
+// passengers moves the passengers through the simulated elevators
+type passengers struct {
+	rng *rand.Rand
+	all []*passenger
+}
+
+func newPassengers(rng *rand.Rand, arrivals []Arrival) *passengers {
+	p := &passengers{rng: rng, all: make([]*passenger, 0, len(arrivals))}
+	for _, a := range arrivals {
+		p.all = append(p.all, &passenger{Arrival: a})
+	}
+	return p
+}
+
+// update lets the passengers arrive, board and leave the cars, and returns the buttons they press
+//
+// A waiting passenger boards a car whose door is open at the floor of the passenger once the hall lamp
+// of the direction of the passenger is off on that car, i.e. once the car took the call.
+// A passenger presses a button again if its lamp is not lit after the repress timeout.
+func (p *passengers) update(now time.Duration, cars []car) []press {
+	presses := make([]press, 0)
+	for _, ps := range p.all {
+		switch ps.state {
+		case notArrived:
+			if ps.At > now {
+				continue
+			}
+			ps.state = waiting
+			ps.pressedAt = now
+			presses = append(presses, press{node: p.hallPanel(cars), button: ps.hallButton(), floor: ps.From})
+
+		case waiting:
+			boarded := false
+			for i, c := range cars {
+				if c.isRunning && c.snapshot.DoorOpen && c.snapshot.Floor == ps.From && !c.snapshot.Lamps[ps.From][ps.hallButton()] {
+					ps.state = riding
+					ps.car = i
+					ps.boardedAt = now
+					ps.pressedAt = now
+					presses = append(presses, press{node: i, button: elevator.Cab, floor: ps.To})
+					boarded = true
+					break
+				}
+			}
+			if !boarded && now-ps.pressedAt > repressTimeout && !isLitAnywhere(cars, ps.hallButton(), ps.From) {
+				ps.pressedAt = now
+				presses = append(presses, press{node: p.hallPanel(cars), button: ps.hallButton(), floor: ps.From})
+			}
+
+		case riding:
+			c := cars[ps.car]
+			if c.snapshot.DoorOpen && c.snapshot.Floor == ps.To {
+				ps.state = delivered
+				ps.alightedAt = now
+				continue
+			}
+			if now-ps.pressedAt > repressTimeout && !c.snapshot.Lamps[ps.To][elevator.Cab] {
+				ps.pressedAt = now
+				presses = append(presses, press{node: ps.car, button: elevator.Cab, floor: ps.To})
+			}
+		}
+	}
+	return presses
+}
+
+// isDone returns true if all passengers are delivered
+func (p *passengers) isDone() bool {
+	for _, ps := range p.all {
+		if ps.state != delivered {
+			return false
+		}
+	}
+	return true
+}
+
+// report summarizes the wait and travel times of the passengers
+func (p *passengers) report() Report {
+	r := Report{Passengers: len(p.all)}
+	var totalWait, totalTravel time.Duration
+	boarded := 0
+	for _, ps := range p.all {
+		if ps.state == riding || ps.state == delivered {
+			wait := ps.boardedAt - ps.At
+			totalWait += wait
+			r.MaxWait = max(r.MaxWait, wait)
+			boarded++
+		}
+		if ps.state == delivered {
+			travel := ps.alightedAt - ps.boardedAt
+			totalTravel += travel
+			r.MaxTravel = max(r.MaxTravel, travel)
+			r.Delivered++
+		}
+	}
+	if boarded > 0 {
+		r.AvgWait = totalWait / time.Duration(boarded)
+	}
+	if r.Delivered > 0 {
+		r.AvgTravel = totalTravel / time.Duration(r.Delivered)
+	}
+	return r
+}
+
+// hallPanel returns the node whose hall button a passenger presses, a random running node
+func (p *passengers) hallPanel(cars []car) int {
+	running := make([]int, 0, len(cars))
+	for i, c := range cars {
+		if c.isRunning {
+			running = append(running, i)
+		}
+	}
+	if len(running) == 0 {
+		return p.rng.Intn(len(cars))
+	}
+	return running[p.rng.Intn(len(running))]
+}
+
+// hallButton returns the hall button of the direction of the passenger
+func (ps *passenger) hallButton() elevator.ButtonType {
+	if ps.To > ps.From {
+		return elevator.HallUp
+	}
+	return elevator.HallDown
+}
+
+// isLitAnywhere returns true if the lamp is lit on any running node
+func isLitAnywhere(cars []car, btn elevator.ButtonType, floor elevator.Floor) bool {
+	for _, c := range cars {
+		if c.isRunning && c.snapshot.Lamps[floor][btn] {
+			return true
+		}
+	}
+	return false
+}
+
+// Run lets the passengers use the cluster and returns the report
+//
+// The run ends once all passengers are delivered, or when the drain time after the last arrival expired.
+// The floors traveled are counted from the start of the run.
+func Run(ctx context.Context, cluster *simulator.Cluster, rng *rand.Rand, arrivals []Arrival, drain time.Duration) (Report, error) {
+	p := newPassengers(rng, arrivals)
+	end := drain
+	if len(arrivals) > 0 {
+		end += arrivals[len(arrivals)-1].At
+	}
+
+	observe := func() []car {
+		cars := make([]car, cluster.Len())
+		for i := range cars {
+			cars[i] = car{snapshot: cluster.Elevator(i).Snapshot(), isRunning: cluster.IsRunning(i)}
+		}
+		return cars
+	}
+	traveled := func(cars []car) float64 {
+		sum := 0.0
+		for _, c := range cars {
+			sum += c.snapshot.Traveled
+		}
+		return sum
+	}
+
+	startTraveled := traveled(observe())
+	ticker := time.NewTicker(updateRate)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		now := time.Since(start)
+		cars := observe()
+		for _, pr := range p.update(now, cars) {
+			cluster.Elevator(pr.node).Press(pr.button, pr.floor)
+		}
+		if p.isDone() || now > end {
+			r := p.report()
+			r.Traveled = traveled(cars) - startTraveled
+			return r, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return Report{}, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// traffic is a package that generates passenger traffic and measures how well a cluster of elevators serves it.
+//
+// Passengers arrive as a Poisson process, and their origin and destination floors are drawn from an
+// origin-destination matrix. The passengers press the buttons of the simulated elevators like real passengers:
+// they call the elevator in the hall, board the first car that opens its door at their floor and answers their call,
+// press the cab button of their destination and leave the car once the door opens there.
+// The report contains the wait and travel times of the passengers and the floors traveled by the elevators.
+package traffic
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+)
+
+// Arrival is a passenger arriving at a floor who wants to travel to another floor
+type Arrival struct {
+	At   time.Duration
+	From elevator.Floor
+	To   elevator.Floor
+}
+
+// Matrix is an origin-destination matrix. Each entry is the relative number of passengers
+// travelling from the floor of the row to the floor of the column. The diagonal is ignored.
+type Matrix [elevator.NumFloors][elevator.NumFloors]float64
+
+// lobbyWeight is the weight of the trips from or to the lobby in the peak profiles, relative to all other trips
+const lobbyWeight = 8
+
+// Profiles are the predefined origin-destination matrices
+var Profiles = map[string]Matrix{
+	// uniform traffic between all floors
+	"uniform": newMatrix(func(from, to elevator.Floor) float64 { return 1 }),
+	// morning traffic, mostly from the lobby on floor 0 to the other floors
+	"up_peak": newMatrix(func(from, to elevator.Floor) float64 {
+		if from == 0 {
+			return lobbyWeight
+		}
+		return 1
+	}),
+	// evening traffic, mostly from the other floors to the lobby on floor 0
+	"down_peak": newMatrix(func(from, to elevator.Floor) float64 {
+		if to == 0 {
+			return lobbyWeight
+		}
+		return 1
+	}),
+}
+
+func newMatrix(weight func(from, to elevator.Floor) float64) Matrix {
+	var m Matrix
+	for from := range m {
+		for to := range m[from] {
+			if from != to {
+				m[from][to] = weight(elevator.Floor(from), elevator.Floor(to))
+			}
+		}
+	}
+	return m
+}
+
+// Validate returns an error if the matrix has negative weights or no trip between two different floors
+func (m Matrix) Validate() error {
+	total := 0.0
+	for from := range m {
+		for to, w := range m[from] {
+			if w < 0 {
+				return fmt.Errorf("negative weight %v from floor %d to floor %d", w, from, to)
+			}
+			if from != to {
+				total += w
+			}
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("the matrix contains no trips between two different floors")
+	}
+	return nil
+}
+
+// Generate generates the arrivals of the passengers within the duration, ordered by time
+//
+// The passengers arrive as a Poisson process with the given mean rate, and each trip is drawn from the matrix.
+// The same random source generates the same arrivals, so that configurations can be compared with the same traffic.
+func Generate(rng *rand.Rand, perMinute float64, m Matrix, duration time.Duration) []Arrival {
+	type trip struct {
+		from, to elevator.Floor
+		weight   float64
+	}
+	trips := make([]trip, 0)
+	total := 0.0
+	for from := range m {
+		for to, w := range m[from] {
+			if from != to && w > 0 {
+				trips = append(trips, trip{from: elevator.Floor(from), to: elevator.Floor(to), weight: w})
+				total += w
+			}
+		}
+	}
+
+	arrivals := make([]Arrival, 0)
+	if perMinute <= 0 || len(trips) == 0 {
+		return arrivals
+	}
+
+	at := time.Duration(0)
+	for {
+		at += time.Duration(rng.ExpFloat64() / perMinute * float64(time.Minute))
+		if at >= duration {
+			break
+		}
+
+		x := rng.Float64() * total
+		t := trips[len(trips)-1]
+		for _, candidate := range trips {
+			x -= candidate.weight
+			if x < 0 {
+				t = candidate
+				break
+			}
+		}
+		arrivals = append(arrivals, Arrival{At: at, From: t.from, To: t.to})
+	}
+	return arrivals
+}
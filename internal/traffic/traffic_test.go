@@ -0,0 +1,114 @@
+package traffic
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"group48.ttk4145.ntnu/elevators/internal/models/elevator"
+	"group48.ttk4145.ntnu/elevators/internal/simulator"
+)
+
+func TestGenerate(t *testing.T) {
+	var m Matrix
+	m[0][2] = 3
+	m[3][1] = 1
+	m[1][1] = 100 // the diagonal is ignored
+
+	duration := 10 * time.Hour
+	arrivals := Generate(rand.New(rand.NewSource(1)), 2, m, duration)
+
+	// A Poisson process with 2 passengers per minute has 1200 arrivals in 10 hours on average
+	if n := float64(len(arrivals)); math.Abs(n-1200) > 150 {
+		t.Errorf("expected about 1200 arrivals, got %v", n)
+	}
+
+	count := make(map[[2]elevator.Floor]int)
+	last := time.Duration(0)
+	for _, a := range arrivals {
+		if a.At < last || a.At >= duration {
+			t.Fatalf("arrival at %v is out of order or out of the duration", a.At)
+		}
+		last = a.At
+		count[[2]elevator.Floor{a.From, a.To}]++
+	}
+	if len(count) != 2 {
+		t.Errorf("expected only the trips of the matrix, got %v", count)
+	}
+	if ratio := float64(count[[2]elevator.Floor{0, 2}]) / float64(len(arrivals)); math.Abs(ratio-0.75) > 0.05 {
+		t.Errorf("expected 75%% of the trips from floor 0 to 2, got %v", ratio)
+	}
+
+	again := Generate(rand.New(rand.NewSource(1)), 2, m, duration)
+	if !reflect.DeepEqual(arrivals, again) {
+		t.Errorf("expected the same seed to generate the same arrivals")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	for name, m := range Profiles {
+		if err := m.Validate(); err != nil {
+			t.Errorf("profile %v is invalid: %v", name, err)
+		}
+	}
+
+	var empty Matrix
+	empty[2][2] = 1
+	if err := empty.Validate(); err == nil {
+		t.Errorf("expected a matrix without trips to be invalid")
+	}
+}
+
+func TestPassengers(t *testing.T) {
+	p := newPassengers(rand.New(rand.NewSource(1)), []Arrival{{At: time.Second, From: 1, To: 3}})
+	cars := []car{
+		{snapshot: simulator.Snapshot{Floor: 0}, isRunning: true},
+		{snapshot: simulator.Snapshot{Floor: 3}, isRunning: true},
+	}
+
+	if presses := p.update(0, cars); len(presses) != 0 {
+		t.Fatalf("expected no press before the arrival, got %v", presses)
+	}
+	presses := p.update(time.Second, cars)
+	if len(presses) != 1 || presses[0].button != elevator.HallUp || presses[0].floor != 1 {
+		t.Fatalf("expected the hall up button at floor 1 to be pressed, got %v", presses)
+	}
+
+	// The lamp is lit, and car 0 opens its door at floor 1 before it took the call
+	cars[0].snapshot.Lamps[1][elevator.HallUp] = true
+	cars[1].snapshot.Lamps[1][elevator.HallUp] = true
+	cars[0].snapshot.Floor = 1
+	cars[0].snapshot.DoorOpen = true
+	if presses := p.update(5*time.Second, cars); len(presses) != 0 || p.all[0].state != waiting {
+		t.Fatalf("expected the passenger to wait while the call is not taken, got %v", presses)
+	}
+
+	// Car 0 takes the call, so the passenger boards and presses the cab button
+	cars[0].snapshot.Lamps[1][elevator.HallUp] = false
+	presses = p.update(6*time.Second, cars)
+	if len(presses) != 1 || presses[0] != (press{node: 0, button: elevator.Cab, floor: 3}) {
+		t.Fatalf("expected the cab button of car 0 to be pressed, got %v", presses)
+	}
+
+	// The cab lamp does not light up, so the passenger presses again
+	cars[0].snapshot.DoorOpen = false
+	presses = p.update(10*time.Second, cars)
+	if len(presses) != 1 || presses[0].button != elevator.Cab {
+		t.Fatalf("expected the cab button to be pressed again, got %v", presses)
+	}
+
+	cars[0].snapshot.Floor = 3
+	cars[0].snapshot.DoorOpen = true
+	p.update(14*time.Second, cars)
+	if !p.isDone() {
+		t.Fatalf("expected the passenger to be delivered")
+	}
+
+	r := p.report()
+	expected := Report{Passengers: 1, Delivered: 1, AvgWait: 5 * time.Second, MaxWait: 5 * time.Second, AvgTravel: 8 * time.Second, MaxTravel: 8 * time.Second}
+	if r != expected {
+		t.Errorf("expected report %+v, got %+v", expected, r)
+	}
+}
@@ -25,13 +25,16 @@ ELEVATOR_PROGRAM="../cmd/elevator/main.go"
 # Define base ports for the simulator and the Go program
 SIMULATOR_BASE_PORT=5000
 GO_PORT=6000
+# Every instance serves its API and dashboard on its own port, starting at API_BASE_PORT + 1
+API_BASE_PORT=8080
 
 # Define configuration templates
 CONFIG_TEMPLATE='{
     "elevator_addr": "localhost:%d",
     "num_floors": 4,
     "local_peer_id": %d,
-    "local_port": %d
+    "local_port": %d,
+    "api_addr": "localhost:%d"
 }'
 
 # Store PIDs of simulator and Go program instances
@@ -63,7 +66,7 @@ start_elevator_instance() {
     CONFIG_FILE="config_$i.json"
 
     # Create configuration file
-    printf "$CONFIG_TEMPLATE" $SIMULATOR_PORT $i $GO_PORT > $CONFIG_FILE
+    printf "$CONFIG_TEMPLATE" $SIMULATOR_PORT $i $GO_PORT $((API_BASE_PORT + i)) > $CONFIG_FILE
 
     # Calculate positions
     Y_OFFSET=$(( (i - 1) * 300 ))